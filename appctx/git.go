@@ -11,10 +11,15 @@ import (
 	"github.com/jlrickert/cli-toolkit/toolkit"
 )
 
-// findGitRoot attempts to use the git CLI to determine the repository top-level
+// FindGitRoot attempts to use the git CLI to determine the repository top-level
 // directory starting from 'start'. If that fails (git not available, not a git
 // worktree, or command error), it falls back to the original upward filesystem
 // search for a .git entry.
+//
+// The git CLI only sees the real filesystem, so it is used only when the Env
+// in ctx is an OsEnv, possibly wrapped by decorators such as ReadOnlyEnv or
+// DryRunEnv. For other Envs, such as a sandbox TestEnv or MemEnv, the search
+// goes through the Env so jailed repositories are found.
 func FindGitRoot(ctx context.Context, start string) string {
 	lg := mylog.LoggerFromContext(ctx)
 
@@ -26,7 +31,14 @@ func FindGitRoot(ctx context.Context, start string) string {
 	// First, try using git itself to find the top-level directory. Using `-C`
 	// makes git operate relative to the provided path.
 	args := []string{"-C", start, "rev-parse", "--show-toplevel"}
-	if out, err := exec.CommandContext(ctx, "git", args...).Output(); err == nil {
+	if !onDisk(toolkit.EnvFromContext(ctx)) {
+		lg.Log(
+			ctx,
+			slog.LevelDebug,
+			"skipping git rev-parse for non-OS env",
+			slog.String("start", start),
+		)
+	} else if out, err := exec.CommandContext(ctx, "git", args...).Output(); err == nil {
 		if p := strings.TrimSpace(string(out)); p != "" {
 			lg.Log(
 				ctx,
@@ -68,3 +80,18 @@ func FindGitRoot(ctx context.Context, start string) string {
 	lg.Log(ctx, slog.LevelDebug, "git root not found", slog.String("start", start))
 	return ""
 }
+
+// onDisk reports whether env is an OsEnv or decorates one, following
+// Unwrap, so that the git CLI sees the same files as env.
+func onDisk(env toolkit.Env) bool {
+	for {
+		if _, ok := env.(*toolkit.OsEnv); ok {
+			return true
+		}
+		u, ok := env.(interface{ Unwrap() toolkit.Env })
+		if !ok {
+			return false
+		}
+		env = u.Unwrap()
+	}
+}
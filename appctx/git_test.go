@@ -0,0 +1,100 @@
+package appctx_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	proj "github.com/jlrickert/cli-toolkit/appctx"
+	testutils "github.com/jlrickert/cli-toolkit/sandbox"
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFindGitRoot runs git-root detection against repositories created in
+// the sandbox jail. None of them exist on the real filesystem.
+func TestFindGitRoot(t *testing.T) {
+	t.Parallel()
+
+	f := NewSandbox(t,
+		testutils.WithFixture("basic", "repo"),
+		testutils.WithGitRepo("repo"),
+		testutils.WithGitWorktree("repo", "worktrees/feature", "feature"),
+		testutils.WithGitSubmodule("repo", "vendor/lib"),
+		testutils.WithFiles(map[string]string{
+			"repo/vendor/lib/lib.go":           "package lib\n",
+			"worktrees/feature/docs/README.md": "# feature\n",
+			"plain/README.md":                  "# not a repo\n",
+		}),
+	)
+
+	cases := map[string]struct {
+		start string
+		want  string
+	}{
+		"repo root":       {"/home/testuser/repo", "/home/testuser/repo"},
+		"repo subdir":     {"/home/testuser/repo/basic/docs", "/home/testuser/repo"},
+		"repo file":       {"/home/testuser/repo/basic/README.md", "/home/testuser/repo"},
+		"worktree":        {"/home/testuser/worktrees/feature/docs", "/home/testuser/worktrees/feature"},
+		"submodule":       {"/home/testuser/repo/vendor/lib", "/home/testuser/repo/vendor/lib"},
+		"submodule file":  {"/home/testuser/repo/vendor/lib/lib.go", "/home/testuser/repo/vendor/lib"},
+		"outside of repo": {"/home/testuser/plain", ""},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.want, proj.FindGitRoot(f.Context(), tc.start))
+		})
+	}
+}
+
+// TestFindGitRootWrappedOsEnv verifies that decorators around an OsEnv
+// still use the git CLI. git reports the physical path of a repository
+// reached through a symlink, while the fallback search keeps the symlink.
+func TestFindGitRootWrappedOsEnv(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	repo := filepath.Join(dir, "real", "repo")
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, "sub"), 0o755))
+	out, err := exec.Command("git", "init", "-q", repo).CombinedOutput()
+	require.NoError(t, err, string(out))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "real"), filepath.Join(dir, "link")))
+	start := filepath.Join(dir, "link", "repo", "sub")
+
+	base := &toolkit.OsEnv{}
+	for name, env := range map[string]toolkit.Env{
+		"os":        base,
+		"read-only": toolkit.NewReadOnlyEnv(base),
+		"dry-run":   toolkit.NewDryRunEnv(base),
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := toolkit.WithEnv(context.Background(), env)
+			assert.Equal(t, repo, proj.FindGitRoot(ctx, start))
+		})
+	}
+}
+
+// TestNewGitAppContext verifies that the root is detected from the working
+// directory.
+func TestNewGitAppContext(t *testing.T) {
+	t.Parallel()
+
+	f := NewSandbox(t,
+		testutils.WithFixture("basic", "repo"),
+		testutils.WithGitRepo("repo"),
+		testutils.WithWd("repo/basic/docs"),
+	)
+
+	p, err := proj.NewGitAppContext(f.Context(), "myapp")
+	require.NoError(t, err)
+	assert.Equal(t, "/home/testuser/repo", p.Root)
+}
@@ -12,50 +12,205 @@ import (
 type Clock interface {
 	// Now returns the current time.
 	Now() time.Time
+	// Since returns the time elapsed since t.
+	Since(t time.Time) time.Duration
+	// Until returns the duration until t.
+	Until(t time.Time) time.Duration
+	// Sleep pauses the calling goroutine for at least d.
+	Sleep(d time.Duration)
+	// After waits for d to elapse and then sends the current time on the
+	// returned channel.
+	After(d time.Duration) <-chan time.Time
+	// NewTimer returns a Timer that sends the current time on its channel
+	// after at least d.
+	NewTimer(d time.Duration) Timer
+	// NewTicker returns a Ticker that sends the current time on its
+	// channel every d. It panics if d is not positive.
+	NewTicker(d time.Duration) Ticker
+	// AfterFunc calls f after d has elapsed and returns a Timer that can
+	// cancel the call. The Timer channel is not used.
+	AfterFunc(d time.Duration, f func()) Timer
 }
 
-// OsClock is a production Clock that delegates to time.Now.
+// Timer is the Clock counterpart of time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is delivered.
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing. It returns false if the timer
+	// has already expired or been stopped.
+	Stop() bool
+	// Reset changes the timer to expire after d. It returns true if the
+	// timer had been active.
+	Reset(d time.Duration) bool
+}
+
+// Ticker is the Clock counterpart of time.Ticker.
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered.
+	C() <-chan time.Time
+	// Stop turns off the ticker.
+	Stop()
+	// Reset stops the ticker and resets its period to d.
+	Reset(d time.Duration)
+}
+
+// OsClock is a production Clock that delegates to the time package.
 type OsClock struct{}
 
 // Now returns the current wall-clock time.
 func (OsClock) Now() time.Time { return time.Now() }
 
+// Since returns time.Since(t).
+func (OsClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+// Until returns time.Until(t).
+func (OsClock) Until(t time.Time) time.Duration { return time.Until(t) }
+
+// Sleep calls time.Sleep.
+func (OsClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// After returns time.After(d).
+func (OsClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// NewTimer wraps time.NewTimer.
+func (OsClock) NewTimer(d time.Duration) Timer { return osTimer{time.NewTimer(d)} }
+
+// NewTicker wraps time.NewTicker.
+func (OsClock) NewTicker(d time.Duration) Ticker { return osTicker{time.NewTicker(d)} }
+
+// AfterFunc wraps time.AfterFunc.
+func (OsClock) AfterFunc(d time.Duration, f func()) Timer {
+	return osTimer{time.AfterFunc(d, f)}
+}
+
+type osTimer struct{ t *time.Timer }
+
+func (t osTimer) C() <-chan time.Time        { return t.t.C }
+func (t osTimer) Stop() bool                 { return t.t.Stop() }
+func (t osTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+type osTicker struct{ t *time.Ticker }
+
+func (t osTicker) C() <-chan time.Time   { return t.t.C }
+func (t osTicker) Stop()                 { t.t.Stop() }
+func (t osTicker) Reset(d time.Duration) { t.t.Reset(d) }
+
 // TestClock is a simple, mutex-protected, manually-advancable clock useful for
 // tests. It allows deterministic control of Now() by setting an initial time
 // and advancing it as needed.
+//
+// Timers, tickers, Sleep and After wait on the TestClock: they fire only when
+// Advance or Set moves the clock past their deadline. Due timers fire in
+// deadline order, ties in creation order, with Now reporting each deadline as
+// it fires. Use BlockUntil to wait for goroutines to start waiting before
+// advancing.
+//
+// The clock keeps a monotonic reading next to its wall time. Advance and Set
+// move both; Jump moves only the wall time. SetAutoAdvance and SetScale make
+// the clock move on its own for code that polls Now.
 type TestClock struct {
-	mu  sync.Mutex
-	now time.Time
+	mu sync.Mutex
+	// now is the monotonic time; the wall time is now plus offset.
+	now   time.Time
+	start time.Time
+	// pending is the monotonic time advances in progress move the clock to.
+	// Further advances start from it so concurrent ones add up.
+	pending time.Time
+
+	// waiters are the active timers and tickers.
+	waiters []*testWaiter
+	// seq orders waiters with the same deadline.
+	seq uint64
+	// changed is signalled when waiters are added.
+	changed *sync.Cond
+
+	// offset is the wall time minus the monotonic time.
+	offset time.Duration
+	// jumps records the offset in effect from each Jump on.
+	jumps []clockJump
+	// step is added to the clock after every reading.
+	step time.Duration
+	// scale is the clock speed relative to real time since realBase.
+	scale     float64
+	realBase  time.Time
+	realTimer *time.Timer
 }
 
 // NewTestClock constructs a TestClock seeded to the provided time.
 func NewTestClock(initial time.Time) *TestClock {
-	return &TestClock{now: initial}
+	return &TestClock{now: initial, start: initial}
 }
 
 // Now returns the current time of the TestClock.
 func (c *TestClock) Now() time.Time {
+	c.sync()
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	return c.now
+	now := c.now.Add(c.offset)
+	if c.step <= 0 {
+		c.mu.Unlock()
+		return now
+	}
+	target := c.reserveLocked(c.step)
+	if c.dueLocked(target) == nil {
+		c.now = target
+		c.armLocked()
+		c.mu.Unlock()
+		return now
+	}
+	c.mu.Unlock()
+	c.advanceTo(target)
+	return now
 }
 
-// Advance moves the TestClock forward by d.
+// Advance moves the TestClock forward by d, firing the timers and tickers
+// that become due. Concurrent calls add up, even while callbacks of an
+// earlier call are still running.
 func (c *TestClock) Advance(d time.Duration) {
 	c.mu.Lock()
-	c.now = c.now.Add(d)
+	target := c.reserveLocked(d)
 	c.mu.Unlock()
+	c.advanceTo(target)
 }
 
-// Set sets the TestClock to a specific time.
+// reserveLocked returns the target for moving the clock forward by d,
+// counting from the end of any advance still in progress, and records it as
+// pending.
+func (c *TestClock) reserveLocked(d time.Duration) time.Time {
+	base := c.now
+	if c.pending.After(base) {
+		base = c.pending
+	}
+	c.pending = base.Add(d)
+	return c.pending
+}
+
+// Set sets the TestClock to a specific time. Moving forward fires the timers
+// and tickers that become due; moving backward fires nothing. Unlike Jump,
+// Set moves the monotonic reading along with the wall time.
 func (c *TestClock) Set(t time.Time) {
 	c.mu.Lock()
-	c.now = t
+	target := t.Add(-c.offset)
+	if target.After(c.now) {
+		if target.After(c.pending) {
+			c.pending = target
+		}
+		c.mu.Unlock()
+		c.advanceTo(target)
+		return
+	}
+	c.now = target
+	c.pending = target
+	for len(c.jumps) > 0 && c.jumps[len(c.jumps)-1].at.After(target) {
+		c.jumps = c.jumps[:len(c.jumps)-1]
+	}
+	c.armLocked()
 	c.mu.Unlock()
 }
 
 var _ Clock = (*OsClock)(nil)
 var _ Clock = (*TestClock)(nil)
+var _ Timer = osTimer{}
+var _ Ticker = osTicker{}
 
 type clockCtxKey int
 
@@ -27,6 +27,29 @@ func TestTestClockBasics(t *testing.T) {
 	assert.Equal(t, newt, c.Now())
 }
 
+func TestTestClockConcurrentAdvance(t *testing.T) {
+	t.Parallel()
+	initial := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+	c := clock.NewTestClock(initial)
+
+	// A callback holds the first advance halfway while another one runs.
+	reached, release := make(chan struct{}), make(chan struct{})
+	c.AfterFunc(time.Second, func() {
+		close(reached)
+		<-release
+	})
+	done := make(chan struct{})
+	go func() {
+		c.Advance(2 * time.Second)
+		close(done)
+	}()
+	<-reached
+	c.Advance(time.Second)
+	close(release)
+	<-done
+	assert.Equal(t, initial.Add(3*time.Second), c.Now())
+}
+
 func TestWithClockAndClockFromContext(t *testing.T) {
 	initial := time.Date(2019, time.March, 3, 4, 5, 6, 0, time.UTC)
 	tc := clock.NewTestClock(initial)
@@ -0,0 +1,98 @@
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithDeadline is like context.WithDeadline but measures the deadline on the
+// Clock stored in ctx. With a TestClock the returned context is cancelled
+// with context.DeadlineExceeded when the clock is advanced to or past d, so
+// timeouts can be tested without waiting. With the OS clock it is
+// context.WithDeadline.
+func WithDeadline(ctx context.Context, d time.Time) (context.Context, context.CancelFunc) {
+	clk := ClockFromContext(ctx)
+	switch clk.(type) {
+	case *OsClock, OsClock:
+		return context.WithDeadline(ctx, d)
+	}
+	if cur, ok := ctx.Deadline(); ok && cur.Before(d) {
+		// The parent deadline is sooner.
+		return context.WithCancel(ctx)
+	}
+
+	inner, cancel := context.WithCancelCause(ctx)
+	c := &deadlineCtx{
+		Context:  inner,
+		cancel:   cancel,
+		deadline: d,
+		done:     make(chan struct{}),
+	}
+	// AfterFunc runs f right away when d has passed, so the timer is only
+	// recorded if the context is still live.
+	timer := clk.AfterFunc(clk.Until(d), func() {
+		c.finish(context.DeadlineExceeded)
+	})
+	c.mu.Lock()
+	if c.err == nil {
+		c.timer = timer
+	}
+	c.mu.Unlock()
+	// Follow cancellation of the parent.
+	context.AfterFunc(inner, func() { c.finish(inner.Err()) })
+	return c, func() { c.finish(context.Canceled) }
+}
+
+// WithTimeout returns WithDeadline(ctx, now.Add(timeout)), where now is read
+// from the Clock stored in ctx.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return WithDeadline(ctx, ClockFromContext(ctx).Now().Add(timeout))
+}
+
+// deadlineCtx is a context cancelled by a Clock timer. It keeps its own
+// done channel and error so that contexts derived from it observe
+// context.DeadlineExceeded; the embedded context only provides values and
+// the cancellation cause.
+type deadlineCtx struct {
+	context.Context
+	cancel   context.CancelCauseFunc
+	deadline time.Time
+	done     chan struct{}
+
+	mu    sync.Mutex
+	timer Timer
+	err   error
+}
+
+// finish cancels the context with err unless it is already done.
+func (c *deadlineCtx) finish(err error) {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.err = err
+	close(c.done)
+	timer := c.timer
+	c.mu.Unlock()
+
+	c.cancel(err)
+	if timer != nil {
+		timer.Stop()
+	}
+}
+
+func (c *deadlineCtx) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *deadlineCtx) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *deadlineCtx) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
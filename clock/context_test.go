@@ -0,0 +1,71 @@
+package clock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTimeoutUsesTestClock(t *testing.T) {
+	t.Parallel()
+	c := clock.NewTestClock(epoch)
+	parent := clock.WithClock(t.Context(), c)
+
+	ctx, cancel := clock.WithTimeout(parent, time.Minute)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	assert.Equal(t, epoch.Add(time.Minute), deadline)
+
+	c.Advance(59 * time.Second)
+	require.NoError(t, ctx.Err())
+
+	c.Advance(time.Second)
+	<-ctx.Done()
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+	assert.ErrorIs(t, context.Cause(ctx), context.DeadlineExceeded)
+
+	// Cancelling first reports context.Canceled and never fires.
+	ctx, cancel = clock.WithTimeout(parent, time.Minute)
+	cancel()
+	<-ctx.Done()
+	c.Advance(time.Hour)
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+
+	// A deadline in the past is already expired.
+	ctx, cancel = clock.WithDeadline(parent, c.Now().Add(-time.Second))
+	defer cancel()
+	<-ctx.Done()
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+}
+
+func TestWithDeadlineKeepsSoonerParentDeadline(t *testing.T) {
+	t.Parallel()
+	c := clock.NewTestClock(epoch)
+
+	parent, cancelParent := clock.WithTimeout(clock.WithClock(t.Context(), c), time.Second)
+	defer cancelParent()
+	ctx, cancel := clock.WithTimeout(parent, time.Hour)
+	defer cancel()
+
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	assert.Equal(t, epoch.Add(time.Second), deadline)
+
+	c.Advance(time.Second)
+	<-ctx.Done()
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+}
+
+func TestWithTimeoutUsesOsClockByDefault(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := clock.WithTimeout(t.Context(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	assert.ErrorIs(t, ctx.Err(), context.DeadlineExceeded)
+}
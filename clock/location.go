@@ -0,0 +1,63 @@
+package clock
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	// Embed the zone database so TZ resolves on hosts without zoneinfo.
+	_ "time/tzdata"
+)
+
+// LookupEnv reports the value of an environment variable and whether it is
+// set.
+type LookupEnv func(key string) (string, bool)
+
+type lookupEnvCtxKey struct{}
+
+// locations caches loaded zones by TZ value.
+var locations sync.Map
+
+// WithLookupEnv returns a copy of ctx whose environment lookups, such as TZ
+// for Location, go through lookup. toolkit.WithEnv installs the lookup of
+// the injected Env, so callers rarely need it directly.
+func WithLookupEnv(ctx context.Context, lookup LookupEnv) context.Context {
+	return context.WithValue(ctx, lookupEnvCtxKey{}, lookup)
+}
+
+// Location returns the local time zone for ctx, resolved from the TZ
+// variable of the environment in ctx like the time package does for the
+// process: unset means time.Local, empty means UTC, and an unknown zone
+// falls back to UTC. Zones load from the system database or, failing that,
+// the embedded copy. Without an environment in ctx, the process TZ is used.
+func Location(ctx context.Context) *time.Location {
+	lookup := os.LookupEnv
+	if v, ok := ctx.Value(lookupEnvCtxKey{}).(LookupEnv); ok && v != nil {
+		lookup = v
+	}
+	tz, ok := lookup("TZ")
+	if !ok {
+		return time.Local
+	}
+	tz = strings.TrimPrefix(tz, ":")
+	if tz == "" || tz == "UTC" {
+		return time.UTC
+	}
+	if loc, ok := locations.Load(tz); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		loc = time.UTC
+	}
+	locations.Store(tz, loc)
+	return loc
+}
+
+// LocalNow returns the current time of the Clock in ctx in the Location of
+// ctx.
+func LocalNow(ctx context.Context) time.Time {
+	return ClockFromContext(ctx).Now().In(Location(ctx))
+}
@@ -0,0 +1,35 @@
+package clock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocationFromLookupEnv(t *testing.T) {
+	t.Parallel()
+	env := map[string]string{}
+	ctx := clock.WithLookupEnv(context.Background(), func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	})
+	ctx = clock.WithClock(ctx, clock.NewTestClock(epoch))
+
+	assert.Equal(t, time.Local, clock.Location(ctx))
+
+	env["TZ"] = ""
+	assert.Equal(t, time.UTC, clock.Location(ctx))
+
+	env["TZ"] = "America/New_York"
+	assert.Equal(t, "America/New_York", clock.Location(ctx).String())
+	assert.Equal(t, "2024-12-31T19:00:00-05:00", clock.LocalNow(ctx).Format(time.RFC3339))
+
+	env["TZ"] = ":Asia/Tokyo"
+	assert.Equal(t, 9, clock.LocalNow(ctx).Hour())
+
+	env["TZ"] = "Not/AZone"
+	assert.Equal(t, time.UTC, clock.Location(ctx))
+}
@@ -0,0 +1,131 @@
+package clock
+
+import (
+	"time"
+)
+
+// clockJump is a wall-clock jump of a TestClock: from the monotonic time at
+// on, the wall time is the monotonic time plus offset.
+type clockJump struct {
+	at     time.Time
+	offset time.Duration
+}
+
+// Jump moves the wall time of the TestClock by d, which may be negative,
+// without moving its monotonic reading, the way an NTP correction or a
+// manual clock change would. Timers and tickers do not fire or move, and
+// Since and Until keep measuring the time actually elapsed for wall times
+// read from the clock before the jump.
+func (c *TestClock) Jump(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.jumps) == 0 {
+		c.jumps = append(c.jumps, clockJump{})
+	}
+	c.offset += d
+	c.jumps = append(c.jumps, clockJump{at: c.now, offset: c.offset})
+}
+
+// Monotonic returns the monotonic time elapsed since the TestClock was
+// created. Unlike the wall time it is not affected by Jump.
+func (c *TestClock) Monotonic() time.Duration {
+	now := c.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.monoLocked(now, false).Sub(c.start)
+}
+
+// SetAutoAdvance makes every reading of the TestClock through Now, Since or
+// Until move it forward by step once the reading is taken, firing the timers
+// that become due. Code that polls Now waiting for time to pass then makes
+// progress without a goroutine calling Advance. A zero step turns it off.
+func (c *TestClock) SetAutoAdvance(step time.Duration) {
+	if step < 0 {
+		panic("clock: negative step for SetAutoAdvance")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.step = step
+}
+
+// SetScale makes the TestClock follow real time multiplied by scale, on top
+// of Advance and Set: with a scale of 100 a one-minute Sleep returns after
+// 600ms of real time. Timers fire from a background goroutine. A zero scale
+// freezes the clock again.
+func (c *TestClock) SetScale(scale float64) {
+	if scale < 0 {
+		panic("clock: negative scale for SetScale")
+	}
+	c.sync()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scale = scale
+	c.realBase = time.Now()
+	c.armLocked()
+}
+
+// sync moves a scaled clock forward by the real time elapsed since the last
+// sync, multiplied by the scale.
+func (c *TestClock) sync() {
+	c.mu.Lock()
+	if c.scale <= 0 {
+		c.mu.Unlock()
+		return
+	}
+	real := time.Now()
+	target := c.reserveLocked(c.scaledLocked(real.Sub(c.realBase)))
+	c.realBase = real
+	c.mu.Unlock()
+	c.advanceTo(target)
+}
+
+// armLocked sets the real timer of a scaled clock to sync when the earliest
+// waiter is due.
+func (c *TestClock) armLocked() {
+	if c.scale <= 0 || len(c.waiters) == 0 {
+		if c.realTimer != nil {
+			c.realTimer.Stop()
+		}
+		return
+	}
+	next := c.waiters[0].when
+	for _, w := range c.waiters[1:] {
+		if w.when.Before(next) {
+			next = w.when
+		}
+	}
+	virtual := c.now.Add(c.scaledLocked(time.Since(c.realBase)))
+	delay := max(time.Duration(float64(next.Sub(virtual))/c.scale), 0)
+	if c.realTimer == nil {
+		c.realTimer = time.AfterFunc(delay, c.sync)
+	} else {
+		c.realTimer.Reset(delay)
+	}
+}
+
+func (c *TestClock) scaledLocked(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * c.scale)
+}
+
+// monoLocked converts the wall time t to monotonic time using the offset in
+// effect when the clock read it. The latest offset covers readings up to
+// now, or any later time when future is set; wall times the clock never
+// read use the current offset.
+func (c *TestClock) monoLocked(t time.Time, future bool) time.Time {
+	for i := len(c.jumps) - 1; i >= 0; i-- {
+		j := c.jumps[i]
+		m := t.Add(-j.offset)
+		if m.Before(j.at) {
+			continue
+		}
+		if i+1 < len(c.jumps) {
+			if m.After(c.jumps[i+1].at) {
+				continue
+			}
+		} else if !future && m.After(c.now) {
+			continue
+		}
+		return m
+	}
+	return t.Add(-c.offset)
+}
@@ -0,0 +1,104 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestClockAutoAdvance(t *testing.T) {
+	t.Parallel()
+	c := clock.NewTestClock(epoch)
+	c.SetAutoAdvance(time.Second)
+
+	assert.Equal(t, epoch, c.Now())
+	assert.Equal(t, epoch.Add(time.Second), c.Now())
+
+	// A polling loop terminates without anyone calling Advance.
+	fired := c.After(10 * time.Second)
+	start := c.Now()
+	polls := 0
+	for c.Since(start) < 10*time.Second {
+		polls++
+	}
+	assert.Equal(t, 9, polls)
+	assert.Equal(t, epoch.Add(2*time.Second+10*time.Second), <-fired)
+
+	c.SetAutoAdvance(0)
+	assert.Equal(t, c.Now(), c.Now())
+	assert.Panics(t, func() { c.SetAutoAdvance(-time.Second) })
+}
+
+func TestTestClockAutoAdvanceDuringAdvance(t *testing.T) {
+	t.Parallel()
+	c := clock.NewTestClock(epoch)
+
+	// A reading taken while an advance is halfway done adds its step on
+	// top of that advance.
+	reached, release := make(chan struct{}), make(chan struct{})
+	c.AfterFunc(time.Second, func() {
+		close(reached)
+		<-release
+	})
+	done := make(chan struct{})
+	go func() {
+		c.Advance(2 * time.Second)
+		close(done)
+	}()
+	<-reached
+	c.SetAutoAdvance(time.Second)
+	assert.Equal(t, epoch.Add(time.Second), c.Now())
+	close(release)
+	<-done
+	c.SetAutoAdvance(0)
+	assert.Equal(t, epoch.Add(3*time.Second), c.Now())
+}
+
+func TestTestClockScale(t *testing.T) {
+	t.Parallel()
+	c := clock.NewTestClock(epoch)
+	c.SetScale(1000)
+
+	start := time.Now()
+	c.Sleep(time.Minute)
+	assert.Less(t, time.Since(start), 30*time.Second)
+	assert.GreaterOrEqual(t, c.Since(epoch), time.Minute)
+
+	c.SetScale(0)
+	frozen := c.Now()
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, frozen, c.Now())
+	assert.Panics(t, func() { c.SetScale(-1) })
+}
+
+func TestTestClockJump(t *testing.T) {
+	t.Parallel()
+	c := clock.NewTestClock(epoch)
+	timer := c.NewTimer(time.Minute)
+
+	start := c.Now()
+	c.Advance(10 * time.Second)
+	c.Jump(time.Hour)
+	assert.Equal(t, epoch.Add(time.Hour+10*time.Second), c.Now())
+	assert.Equal(t, 10*time.Second, c.Since(start))
+	select {
+	case <-timer.C():
+		t.Fatal("Jump fired a timer")
+	default:
+	}
+
+	mid := c.Now()
+	c.Advance(5 * time.Second)
+	c.Jump(-2 * time.Hour)
+	assert.Equal(t, epoch.Add(-time.Hour+15*time.Second), c.Now())
+	assert.Equal(t, 15*time.Second, c.Since(start))
+	assert.Equal(t, 5*time.Second, c.Since(mid))
+	assert.Equal(t, 15*time.Second, c.Monotonic())
+	assert.Equal(t, 45*time.Second, c.Until(c.Now().Add(45*time.Second)))
+
+	c.Advance(45 * time.Second)
+	require.Equal(t, epoch.Add(-time.Hour+time.Minute), <-timer.C())
+}
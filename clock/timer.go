@@ -0,0 +1,261 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// testWaiter is a timer, ticker or AfterFunc call scheduled on a TestClock.
+type testWaiter struct {
+	when time.Time
+	seq  uint64
+	// period is the ticker period. It is zero for timers.
+	period time.Duration
+	ch     chan time.Time
+	fn     func()
+	active bool
+}
+
+// testTimer implements Timer for TestClock.
+type testTimer struct {
+	clock *TestClock
+	w     *testWaiter
+}
+
+// testTicker implements Ticker for TestClock.
+type testTicker struct {
+	clock *TestClock
+	w     *testWaiter
+}
+
+// Since returns the time elapsed since t according to the TestClock. It is
+// measured on the monotonic reading, so a wall time read from the clock
+// before a Jump still gives the time actually elapsed.
+func (c *TestClock) Since(t time.Time) time.Duration {
+	now := c.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.monoLocked(now, false).Sub(c.monoLocked(t, false))
+}
+
+// Until returns the duration until t according to the TestClock, measured
+// on the monotonic reading like Since.
+func (c *TestClock) Until(t time.Time) time.Duration {
+	now := c.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.monoLocked(t, true).Sub(c.monoLocked(now, false))
+}
+
+// Sleep blocks until the TestClock has been advanced by at least d.
+func (c *TestClock) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	<-c.After(d)
+}
+
+// After returns a channel that receives the clock time once the TestClock
+// has been advanced by at least d.
+func (c *TestClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer returns a Timer that fires once the TestClock has been advanced
+// by at least d. A non-positive d fires immediately.
+func (c *TestClock) NewTimer(d time.Duration) Timer {
+	return &testTimer{clock: c, w: c.schedule(&testWaiter{ch: make(chan time.Time, 1)}, d)}
+}
+
+// NewTicker returns a Ticker that fires every time the TestClock passes a
+// multiple of d. Like time.Ticker it drops ticks for slow receivers: moving
+// the clock across several periods delivers a single tick, for the first
+// of them.
+func (c *TestClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	w := &testWaiter{period: d, ch: make(chan time.Time, 1)}
+	return &testTicker{clock: c, w: c.schedule(w, d)}
+}
+
+// AfterFunc calls f once the TestClock has been advanced by at least d. f
+// runs synchronously in the goroutine calling Advance or Set, or in
+// AfterFunc itself when d is not positive, after the clock lock is released,
+// so the order of calls is deterministic.
+func (c *TestClock) AfterFunc(d time.Duration, f func()) Timer {
+	return &testTimer{clock: c, w: c.schedule(&testWaiter{fn: f}, d)}
+}
+
+// BlockUntil blocks until at least n timers, tickers, Sleep, After or
+// AfterFunc calls are waiting on the clock. Tests use it to make sure a
+// goroutine has parked on the clock before calling Advance.
+func (c *TestClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.condLocked().Wait()
+	}
+}
+
+// condLocked returns the condition signalled when waiters are added.
+func (c *TestClock) condLocked() *sync.Cond {
+	if c.changed == nil {
+		c.changed = sync.NewCond(&c.mu)
+	}
+	return c.changed
+}
+
+// schedule (re)arms w to fire after d and fires it right away when it is
+// already due.
+func (c *TestClock) schedule(w *testWaiter, d time.Duration) *testWaiter {
+	c.mu.Lock()
+	c.scheduleLocked(w, d)
+	now := c.now
+	c.mu.Unlock()
+	if d <= 0 {
+		c.advanceTo(now)
+	}
+	return w
+}
+
+func (c *TestClock) scheduleLocked(w *testWaiter, d time.Duration) {
+	w.when = c.now.Add(d)
+	c.seq++
+	w.seq = c.seq
+	if !w.active {
+		w.active = true
+		c.waiters = append(c.waiters, w)
+	}
+	c.condLocked().Broadcast()
+	c.armLocked()
+}
+
+// stopLocked deactivates w and drops any undelivered tick, so a stopped or
+// reset timer never delivers a stale time. It reports whether w was active.
+func (c *TestClock) stopLocked(w *testWaiter) bool {
+	if w.ch != nil {
+		select {
+		case <-w.ch:
+		default:
+		}
+	}
+	if !w.active {
+		return false
+	}
+	w.active = false
+	for i, other := range c.waiters {
+		if other == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// advanceTo moves the clock to target, firing due waiters one at a time in
+// deadline order. The lock is released while AfterFunc callbacks run.
+func (c *TestClock) advanceTo(target time.Time) {
+	for {
+		c.mu.Lock()
+		next := c.dueLocked(target)
+		if next == nil {
+			// Callbacks reading an auto-advancing clock may have moved it
+			// past target already.
+			if target.After(c.now) {
+				c.now = target
+			}
+			c.armLocked()
+			c.mu.Unlock()
+			return
+		}
+
+		if next.when.After(c.now) {
+			c.now = next.when
+		}
+		now := c.now.Add(c.offset)
+		if next.period > 0 {
+			// Like time.Ticker, skip the periods missed up to target;
+			// their ticks would be dropped anyway.
+			next.when = next.when.Add(next.period)
+			if !next.when.After(target) {
+				missed := target.Sub(next.when)/next.period + 1
+				next.when = next.when.Add(missed * next.period)
+			}
+			c.seq++
+			next.seq = c.seq
+		} else {
+			c.stopLocked(next)
+		}
+		fn := next.fn
+		if fn == nil {
+			select {
+			case next.ch <- now:
+			default:
+			}
+		}
+		c.mu.Unlock()
+
+		if fn != nil {
+			fn()
+		}
+	}
+}
+
+// dueLocked returns the waiter to fire first when the clock moves to target,
+// or nil if none is due by then.
+func (c *TestClock) dueLocked(target time.Time) *testWaiter {
+	var next *testWaiter
+	for _, w := range c.waiters {
+		if w.when.After(target) {
+			continue
+		}
+		if next == nil || w.when.Before(next.when) ||
+			(w.when.Equal(next.when) && w.seq < next.seq) {
+			next = w
+		}
+	}
+	return next
+}
+
+func (t *testTimer) C() <-chan time.Time {
+	return t.w.ch
+}
+
+func (t *testTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.stopLocked(t.w)
+}
+
+func (t *testTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	active := t.clock.stopLocked(t.w)
+	t.clock.mu.Unlock()
+	t.clock.schedule(t.w, d)
+	return active
+}
+
+func (t *testTicker) C() <-chan time.Time {
+	return t.w.ch
+}
+
+func (t *testTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.clock.stopLocked(t.w)
+}
+
+func (t *testTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("clock: non-positive interval for Ticker.Reset")
+	}
+	t.clock.mu.Lock()
+	t.clock.stopLocked(t.w)
+	t.w.period = d
+	t.clock.scheduleLocked(t.w, d)
+	t.clock.mu.Unlock()
+}
+
+var _ Timer = (*testTimer)(nil)
+var _ Ticker = (*testTicker)(nil)
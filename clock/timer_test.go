@@ -0,0 +1,161 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var epoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestTestClockFiresInOrder(t *testing.T) {
+	t.Parallel()
+	c := clock.NewTestClock(epoch)
+
+	var fired []string
+	at := func(name string) func() {
+		return func() { fired = append(fired, name+"@"+c.Since(epoch).String()) }
+	}
+	c.AfterFunc(3*time.Second, at("c"))
+	c.AfterFunc(time.Second, at("a"))
+	c.AfterFunc(2*time.Second, at("b"))
+	c.AfterFunc(time.Second, at("a2"))
+	stopped := c.AfterFunc(2*time.Second, at("never"))
+	require.True(t, stopped.Stop())
+	require.False(t, stopped.Stop())
+
+	c.Advance(1500 * time.Millisecond)
+	assert.Equal(t, []string{"a@1s", "a2@1s"}, fired)
+
+	c.Advance(10 * time.Second)
+	assert.Equal(t, []string{"a@1s", "a2@1s", "b@2s", "c@3s"}, fired)
+	assert.Equal(t, epoch.Add(11500*time.Millisecond), c.Now())
+}
+
+func TestTestClockSleepAndBlockUntil(t *testing.T) {
+	t.Parallel()
+	c := clock.NewTestClock(epoch)
+
+	done := make(chan time.Time)
+	go func() {
+		c.Sleep(5 * time.Minute)
+		done <- c.Now()
+	}()
+	after := c.After(time.Minute)
+
+	c.BlockUntil(2)
+	c.Advance(time.Minute)
+	assert.Equal(t, epoch.Add(time.Minute), <-after)
+	select {
+	case <-done:
+		t.Fatal("Sleep returned early")
+	default:
+	}
+
+	c.Advance(4 * time.Minute)
+	assert.Equal(t, epoch.Add(5*time.Minute), <-done)
+	assert.Equal(t, time.Duration(0), c.Until(epoch.Add(5*time.Minute)))
+}
+
+func TestTestClockTimerStopReset(t *testing.T) {
+	t.Parallel()
+	c := clock.NewTestClock(epoch)
+
+	timer := c.NewTimer(time.Second)
+	c.Advance(time.Second)
+	assert.False(t, timer.Reset(time.Second), "expired timer is not active")
+	select {
+	case <-timer.C():
+		t.Fatal("Reset must drop the stale time")
+	default:
+	}
+
+	c.Advance(time.Second)
+	assert.Equal(t, epoch.Add(2*time.Second), <-timer.C())
+
+	assert.False(t, timer.Stop())
+	assert.False(t, timer.Reset(time.Minute))
+	assert.True(t, timer.Stop())
+	c.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+
+	immediate := c.NewTimer(0)
+	assert.Equal(t, c.Now(), <-immediate.C())
+}
+
+func TestTestClockTicker(t *testing.T) {
+	t.Parallel()
+	c := clock.NewTestClock(epoch)
+
+	ticker := c.NewTicker(time.Second)
+	for i := 1; i <= 3; i++ {
+		c.Advance(time.Second)
+		assert.Equal(t, epoch.Add(time.Duration(i)*time.Second), <-ticker.C())
+	}
+
+	// Ticks are dropped for a slow receiver.
+	c.Advance(5 * time.Second)
+	assert.Equal(t, epoch.Add(4*time.Second), <-ticker.C())
+	select {
+	case <-ticker.C():
+		t.Fatal("expected dropped ticks")
+	default:
+	}
+
+	ticker.Reset(time.Minute)
+	c.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("ticker fired before its new period")
+	default:
+	}
+	c.Advance(time.Minute)
+	<-ticker.C()
+
+	ticker.Stop()
+	c.Advance(time.Hour)
+	select {
+	case <-ticker.C():
+		t.Fatal("stopped ticker fired")
+	default:
+	}
+
+	assert.Panics(t, func() { c.NewTicker(0) })
+
+	// Missed periods are skipped rather than replayed one by one.
+	fast := c.NewTicker(time.Millisecond)
+	start := c.Now()
+	c.Advance(24 * time.Hour)
+	assert.Equal(t, start.Add(time.Millisecond), <-fast.C())
+	c.Advance(time.Millisecond)
+	assert.Equal(t, start.Add(24*time.Hour+time.Millisecond), <-fast.C())
+	fast.Stop()
+}
+
+func TestOsClockTimers(t *testing.T) {
+	t.Parallel()
+	var c clock.Clock = clock.OsClock{}
+
+	start := c.Now()
+	<-c.After(time.Millisecond)
+	c.Sleep(time.Millisecond)
+	assert.GreaterOrEqual(t, c.Since(start), 2*time.Millisecond)
+
+	fired := make(chan struct{})
+	c.AfterFunc(time.Millisecond, func() { close(fired) })
+	<-fired
+
+	ticker := c.NewTicker(time.Millisecond)
+	<-ticker.C()
+	ticker.Stop()
+
+	timer := c.NewTimer(time.Hour)
+	assert.True(t, timer.Stop())
+}
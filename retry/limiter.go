@@ -0,0 +1,79 @@
+package retry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+)
+
+// Limiter is a token-bucket rate limiter. The bucket holds up to burst
+// tokens and gains one token every interval; each event takes a token.
+// Time is read from the clock.Clock stored in the context passed to Allow
+// and Wait, so a Limiter is deterministic under a TestClock. Use one clock
+// per Limiter. A Limiter is safe for concurrent use.
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    int
+	tokens   float64
+	last     time.Time
+	started  bool
+}
+
+// NewLimiter returns a Limiter that allows one event every interval with
+// bursts of up to burst events. It starts with a full bucket. A
+// non-positive interval allows every event and a burst below one is
+// treated as one.
+func NewLimiter(interval time.Duration, burst int) *Limiter {
+	burst = max(burst, 1)
+	return &Limiter{interval: interval, burst: burst, tokens: float64(burst)}
+}
+
+// Allow reports whether an event may happen now, taking a token if so.
+func (l *Limiter) Allow(ctx context.Context) bool {
+	ok, _ := l.take(clock.ClockFromContext(ctx))
+	return ok
+}
+
+// Wait blocks until an event may happen and takes a token for it. It
+// returns ctx.Err() if ctx is done first.
+func (l *Limiter) Wait(ctx context.Context) error {
+	clk := clock.ClockFromContext(ctx)
+	for {
+		ok, delay := l.take(clk)
+		if ok {
+			return nil
+		}
+		if err := wait(ctx, clk, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// take refills the bucket and takes a token. When the bucket is empty it
+// returns how long until the next token.
+func (l *Limiter) take(clk clock.Clock) (bool, time.Duration) {
+	if l.interval <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Read the clock once: readings may move a TestClock, and a clock set
+	// backwards must not drain the bucket.
+	now := clk.Now()
+	if l.started {
+		elapsed := max(now.Sub(l.last), 0)
+		l.tokens = min(l.tokens+float64(elapsed)/float64(l.interval), float64(l.burst))
+	}
+	l.last = now
+	l.started = true
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, 0
+	}
+	return false, max(time.Duration((1-l.tokens)*float64(l.interval)), 1)
+}
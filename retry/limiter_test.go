@@ -0,0 +1,85 @@
+package retry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+	"github.com/jlrickert/cli-toolkit/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	t.Parallel()
+	clk := clock.NewTestClock(epoch)
+	ctx := clock.WithClock(context.Background(), clk)
+	l := retry.NewLimiter(time.Second, 3)
+
+	for range 3 {
+		assert.True(t, l.Allow(ctx))
+	}
+	assert.False(t, l.Allow(ctx))
+
+	clk.Advance(500 * time.Millisecond)
+	assert.False(t, l.Allow(ctx))
+	clk.Advance(500 * time.Millisecond)
+	assert.True(t, l.Allow(ctx))
+
+	// The bucket refills up to burst only.
+	clk.Advance(time.Hour)
+	for range 3 {
+		assert.True(t, l.Allow(ctx))
+	}
+	assert.False(t, l.Allow(ctx))
+
+	assert.True(t, retry.NewLimiter(0, 0).Allow(ctx))
+}
+
+func TestLimiterReadsClockOnce(t *testing.T) {
+	t.Parallel()
+	clk := clock.NewTestClock(epoch)
+	ctx := clock.WithClock(context.Background(), clk)
+	l := retry.NewLimiter(time.Second, 1)
+
+	// Each reading moves the clock by half a token, so a token is earned
+	// every second call.
+	clk.SetAutoAdvance(500 * time.Millisecond)
+	var allowed []bool
+	for range 5 {
+		allowed = append(allowed, l.Allow(ctx))
+	}
+	assert.Equal(t, []bool{true, false, true, false, true}, allowed)
+
+	// Setting the clock backwards does not drain the bucket: one interval
+	// later a token is available again.
+	clk.SetAutoAdvance(0)
+	clk.Set(epoch.Add(-time.Hour))
+	assert.False(t, l.Allow(ctx))
+	clk.Advance(time.Second)
+	assert.True(t, l.Allow(ctx))
+}
+
+func TestLimiterWait(t *testing.T) {
+	t.Parallel()
+	clk := clock.NewTestClock(epoch)
+	ctx := clock.WithClock(context.Background(), clk)
+	l := retry.NewLimiter(time.Minute, 1)
+
+	require.NoError(t, l.Wait(ctx))
+
+	done := make(chan time.Time, 1)
+	go func() {
+		if err := l.Wait(ctx); err == nil {
+			done <- clk.Now()
+		}
+	}()
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	assert.Equal(t, epoch.Add(time.Minute), <-done)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, l.Wait(cctx), context.Canceled)
+}
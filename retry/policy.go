@@ -0,0 +1,96 @@
+package retry
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Policy decides whether and when Do retries a failed operation.
+type Policy interface {
+	// Next returns the delay before retry n, counting from 1, given the
+	// time elapsed since the first attempt started. It returns false to
+	// stop retrying.
+	Next(n int, elapsed time.Duration) (time.Duration, bool)
+}
+
+// PolicyFunc adapts a function to the Policy interface.
+type PolicyFunc func(n int, elapsed time.Duration) (time.Duration, bool)
+
+// Next calls f(n, elapsed).
+func (f PolicyFunc) Next(n int, elapsed time.Duration) (time.Duration, bool) {
+	return f(n, elapsed)
+}
+
+// Constant returns a Policy that waits d before every retry and never gives
+// up on its own. Combine it with MaxAttempts or MaxElapsed.
+func Constant(d time.Duration) Policy {
+	return PolicyFunc(func(int, time.Duration) (time.Duration, bool) {
+		return d, true
+	})
+}
+
+// Exponential returns a Policy that waits initial before the first retry
+// and doubles the delay for each further retry, up to limit. A
+// non-positive limit leaves the delay uncapped. It never gives up on its
+// own.
+func Exponential(initial, limit time.Duration) Policy {
+	return PolicyFunc(func(n int, _ time.Duration) (time.Duration, bool) {
+		d := initial
+		for i := 1; i < n && d < math.MaxInt64/2; i++ {
+			d *= 2
+			if limit > 0 && d >= limit {
+				break
+			}
+		}
+		if limit > 0 && d > limit {
+			d = limit
+		}
+		return d, true
+	})
+}
+
+// Jitter returns a Policy that shortens each delay of p by a random amount
+// of up to fraction of it, so that a fraction of 1 picks delays uniformly
+// between zero and the delay of p. Randomness comes from a generator seeded
+// with seed, making the sequence of delays reproducible in tests. The
+// returned Policy is safe for concurrent use.
+func Jitter(p Policy, fraction float64, seed uint64) Policy {
+	fraction = min(max(fraction, 0), 1)
+	var mu sync.Mutex
+	rng := rand.New(rand.NewPCG(seed, seed))
+	return PolicyFunc(func(n int, elapsed time.Duration) (time.Duration, bool) {
+		d, ok := p.Next(n, elapsed)
+		if !ok || d <= 0 {
+			return d, ok
+		}
+		mu.Lock()
+		r := rng.Float64()
+		mu.Unlock()
+		return d - time.Duration(float64(d)*fraction*r), true
+	})
+}
+
+// MaxAttempts returns a Policy that follows p but gives up once the
+// operation has been tried n times in total.
+func MaxAttempts(p Policy, n int) Policy {
+	return PolicyFunc(func(retry int, elapsed time.Duration) (time.Duration, bool) {
+		if retry >= n {
+			return 0, false
+		}
+		return p.Next(retry, elapsed)
+	})
+}
+
+// MaxElapsed returns a Policy that follows p but gives up when the next
+// retry would start more than limit after the first attempt.
+func MaxElapsed(p Policy, limit time.Duration) Policy {
+	return PolicyFunc(func(n int, elapsed time.Duration) (time.Duration, bool) {
+		d, ok := p.Next(n, elapsed)
+		if !ok || elapsed+d > limit {
+			return 0, false
+		}
+		return d, true
+	})
+}
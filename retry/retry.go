@@ -0,0 +1,86 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+	"github.com/jlrickert/cli-toolkit/mylog"
+)
+
+// permanentError marks an error that must not be retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so that Do returns it right away instead of retrying.
+// Do unwraps it again; a nil err stays nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Do calls op until it returns nil, returns an error wrapped with
+// Permanent, or policy gives up, and then returns the last error. Delays
+// between attempts are measured on the clock.Clock stored in ctx, so tests
+// drive retries by advancing a TestClock. When ctx is done while waiting,
+// the returned error wraps both ctx.Err() and the last error of op.
+func Do(ctx context.Context, policy Policy, op func(ctx context.Context) error) error {
+	clk := clock.ClockFromContext(ctx)
+	lg := mylog.LoggerFromContext(ctx)
+	start := clk.Now()
+
+	for n := 1; ; n++ {
+		err := op(ctx)
+		if err == nil {
+			return nil
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+
+		delay, ok := policy.Next(n, clk.Since(start))
+		if !ok {
+			return err
+		}
+		lg.Log(
+			ctx,
+			slog.LevelDebug,
+			"retrying",
+			slog.Int("attempt", n),
+			slog.Duration("delay", delay),
+			slog.Any("error", err),
+		)
+		if waitErr := wait(ctx, clk, delay); waitErr != nil {
+			return fmt.Errorf("%w: last error: %w", waitErr, err)
+		}
+	}
+}
+
+// wait blocks for d on clk or until ctx is done, returning ctx.Err() in the
+// latter case.
+func wait(ctx context.Context, clk clock.Clock, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d <= 0 {
+		return nil
+	}
+	timer := clk.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,124 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+	"github.com/jlrickert/cli-toolkit/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var epoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var errFlaky = errors.New("flaky")
+
+func delays(p retry.Policy, n int) []time.Duration {
+	var out []time.Duration
+	var elapsed time.Duration
+	for i := 1; i <= n; i++ {
+		d, ok := p.Next(i, elapsed)
+		if !ok {
+			break
+		}
+		out = append(out, d)
+		elapsed += d
+	}
+	return out
+}
+
+func TestPolicies(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t,
+		[]time.Duration{time.Second, time.Second, time.Second},
+		delays(retry.Constant(time.Second), 3))
+	assert.Equal(t,
+		[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second},
+		delays(retry.Exponential(time.Second, 5*time.Second), 5))
+	assert.Equal(t,
+		[]time.Duration{time.Second, time.Second},
+		delays(retry.MaxAttempts(retry.Constant(time.Second), 3), 10))
+	assert.Equal(t,
+		[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		delays(retry.MaxElapsed(retry.Exponential(time.Second, 0), 10*time.Second), 10))
+
+	huge := delays(retry.Exponential(time.Second, 0), 200)
+	assert.Positive(t, huge[len(huge)-1])
+}
+
+func TestJitterIsSeeded(t *testing.T) {
+	t.Parallel()
+	base := retry.Exponential(time.Second, time.Minute)
+
+	a := delays(retry.Jitter(base, 0.5, 42), 8)
+	b := delays(retry.Jitter(base, 0.5, 42), 8)
+	c := delays(retry.Jitter(base, 0.5, 7), 8)
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+
+	for i, d := range a {
+		want, _ := base.Next(i+1, 0)
+		assert.LessOrEqual(t, d, want)
+		assert.GreaterOrEqual(t, d, want/2)
+	}
+}
+
+func TestDoRetriesOnClock(t *testing.T) {
+	t.Parallel()
+	clk := clock.NewTestClock(epoch)
+	ctx := clock.WithClock(context.Background(), clk)
+
+	var at []time.Duration
+	done := make(chan error, 1)
+	go func() {
+		policy := retry.MaxAttempts(retry.Exponential(time.Second, 0), 4)
+		done <- retry.Do(ctx, policy, func(context.Context) error {
+			at = append(at, clk.Since(epoch))
+			return errFlaky
+		})
+	}()
+	for _, d := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		clk.BlockUntil(1)
+		clk.Advance(d)
+	}
+
+	require.ErrorIs(t, <-done, errFlaky)
+	assert.Equal(t, []time.Duration{0, time.Second, 3 * time.Second, 7 * time.Second}, at)
+}
+
+func TestDoStops(t *testing.T) {
+	t.Parallel()
+	ctx := clock.WithClock(context.Background(), clock.NewTestClock(epoch))
+
+	calls := 0
+	err := retry.Do(ctx, retry.Constant(0), func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errFlaky
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = retry.Do(ctx, retry.Constant(0), func(context.Context) error {
+		calls++
+		return retry.Permanent(errFlaky)
+	})
+	assert.Equal(t, errFlaky, err)
+	assert.Equal(t, 1, calls)
+	assert.NoError(t, retry.Permanent(nil))
+
+	cctx, cancel := context.WithCancel(ctx)
+	err = retry.Do(cctx, retry.Constant(time.Hour), func(context.Context) error {
+		cancel()
+		return errFlaky
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, errFlaky)
+}
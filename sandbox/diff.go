@@ -0,0 +1,157 @@
+package sandbox
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffCells bounds the size of the table used to diff the changed middle
+// of two texts. Larger inputs get a one-line note instead of a diff.
+const maxDiffCells = 1 << 20
+
+// unifiedDiff returns a unified diff turning want into got, labelled
+// "want" and "got". It returns an empty string when the texts are equal.
+// Common leading and trailing lines are skipped and the rest is diffed with
+// a longest common subsequence table. When that table would exceed
+// maxDiffCells, a note giving the size of the changed region is returned
+// instead, so comparing large files stays cheap.
+func unifiedDiff(want, got string) string {
+	if want == got {
+		return ""
+	}
+	a := splitLines(want)
+	b := splitLines(got)
+
+	// Only the lines between the common prefix and suffix need the table.
+	lo := 0
+	for lo < len(a) && lo < len(b) && a[lo] == b[lo] {
+		lo++
+	}
+	aHi, bHi := len(a), len(b)
+	for aHi > lo && bHi > lo && a[aHi-1] == b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	n, m := aHi-lo, bHi-lo
+	if (n+1)*(m+1) > maxDiffCells {
+		return fmt.Sprintf("--- want\n+++ got\n(diff omitted: lines %d-%d of want and %d-%d of got differ)\n",
+			lo+1, aHi, lo+1, bHi)
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// a[lo+i:aHi] and b[lo+j:bHi].
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[lo+i] == b[lo+j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// Build the edit script. Each op is ' ', '-' or '+'; deletions come
+	// before insertions.
+	type edit struct {
+		op   byte
+		line string
+		ai   int
+		bi   int
+	}
+	var edits []edit
+	for i := range lo {
+		edits = append(edits, edit{' ', a[i], i, i})
+	}
+	i, j := lo, lo
+	for i < aHi || j < bHi {
+		switch {
+		case i < aHi && j < bHi && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i], i, j})
+			i++
+			j++
+		case i < aHi && (j == bHi || lcs[i-lo+1][j-lo] >= lcs[i-lo][j-lo+1]):
+			edits = append(edits, edit{'-', a[i], i, j})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j], i, j})
+			j++
+		}
+	}
+	for ; i < len(a); i, j = i+1, j+1 {
+		edits = append(edits, edit{' ', a[i], i, j})
+	}
+
+	var sb strings.Builder
+	sb.WriteString("--- want\n+++ got\n")
+	for k := 0; k < len(edits); {
+		if edits[k].op == ' ' {
+			k++
+			continue
+		}
+		// Extend the hunk while changes are within 2*diffContext lines of
+		// each other.
+		start := max(k-diffContext, 0)
+		end := k
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(edits) && edits[next].op == ' ' {
+				next++
+			}
+			if next == len(edits) || next-end > 2*diffContext {
+				end = min(end+diffContext, len(edits))
+				break
+			}
+			end = next
+		}
+
+		var aLen, bLen int
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				aLen++
+			}
+			if e.op != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(edits[start].ai, aLen), hunkRange(edits[start].bi, bLen))
+		for _, e := range edits[start:end] {
+			sb.WriteByte(e.op)
+			sb.WriteString(e.line)
+			sb.WriteByte('\n')
+		}
+		k = end
+	}
+	return sb.String()
+}
+
+// hunkRange formats the start and length of a hunk side. Line numbers are
+// one based; an empty side refers to the line before it.
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// splitLines splits s into lines without their terminating newlines.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,167 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	iofs "io/fs"
+	"path/filepath"
+
+	"github.com/jlrickert/cli-toolkit/toolkit"
+)
+
+// gitDefaultBranch is the branch HEAD points at in sandbox repositories.
+const gitDefaultBranch = "main"
+
+// WithGitRepo returns a SandboxOption that creates an empty git repository
+// at path. The repository is laid out directly through the sandbox Env, so
+// no git binary is needed and it works for in-memory sandboxes. HEAD points
+// at an unborn main branch; the layout is enough for git-root detection and
+// for the git CLI to recognise the repository.
+func WithGitRepo(path string) SandboxOption {
+	return func(f *Sandbox) {
+		f.t.Helper()
+		ctx := f.Context()
+		dir, err := toolkit.ResolvePath(ctx, path, false)
+		if err != nil {
+			f.t.Fatalf("WithGitRepo: resolve %s failed: %v", path, err)
+		}
+		if err := initGitDir(ctx, filepath.Join(dir, ".git"), gitDefaultBranch, ""); err != nil {
+			f.t.Fatalf("WithGitRepo: init %s failed: %v", dir, err)
+		}
+	}
+}
+
+// WithGitWorktree returns a SandboxOption that adds a linked worktree at path
+// for the repository created at repo, checked out on branch. As with
+// `git worktree add`, path/.git is a file pointing at
+// repo/.git/worktrees/<name>, where name is the base name of path. An empty
+// branch defaults to that name. Paths stored in the files are absolute paths
+// as seen inside the sandbox.
+func WithGitWorktree(repo, path, branch string) SandboxOption {
+	return func(f *Sandbox) {
+		f.t.Helper()
+		ctx := f.Context()
+		gitDir, err := sandboxGitDir(ctx, repo)
+		if err != nil {
+			f.t.Fatalf("WithGitWorktree: %v", err)
+		}
+		dir, err := toolkit.ResolvePath(ctx, path, false)
+		if err != nil {
+			f.t.Fatalf("WithGitWorktree: resolve %s failed: %v", path, err)
+		}
+		if branch == "" {
+			branch = filepath.Base(dir)
+		}
+
+		admin := filepath.Join(gitDir, "worktrees", filepath.Base(dir))
+		err = writeGitFiles(ctx, map[string]string{
+			filepath.Join(admin, "HEAD"):      "ref: refs/heads/" + branch + "\n",
+			filepath.Join(admin, "commondir"): "../..\n",
+			filepath.Join(admin, "gitdir"):    filepath.Join(dir, ".git") + "\n",
+			filepath.Join(dir, ".git"):        "gitdir: " + admin + "\n",
+		})
+		if err != nil {
+			f.t.Fatalf("WithGitWorktree: %s failed: %v", path, err)
+		}
+	}
+}
+
+// WithGitSubmodule returns a SandboxOption that adds a submodule at path,
+// relative to the repository created at repo. Like a submodule cloned by
+// git, its git directory lives in repo/.git/modules/<path>, path/.git is a
+// file with a relative gitdir, and the submodule is listed in
+// repo/.gitmodules.
+func WithGitSubmodule(repo, path string) SandboxOption {
+	return func(f *Sandbox) {
+		f.t.Helper()
+		ctx := f.Context()
+		gitDir, err := sandboxGitDir(ctx, repo)
+		if err != nil {
+			f.t.Fatalf("WithGitSubmodule: %v", err)
+		}
+		root := filepath.Dir(gitDir)
+		dir := filepath.Join(root, filepath.FromSlash(path))
+		modDir := filepath.Join(gitDir, "modules", filepath.FromSlash(path))
+
+		worktree, err := filepath.Rel(modDir, dir)
+		if err != nil {
+			f.t.Fatalf("WithGitSubmodule: %v", err)
+		}
+		link, err := filepath.Rel(dir, modDir)
+		if err != nil {
+			f.t.Fatalf("WithGitSubmodule: %v", err)
+		}
+		if err := initGitDir(ctx, modDir, gitDefaultBranch,
+			"\tworktree = "+filepath.ToSlash(worktree)+"\n"); err != nil {
+			f.t.Fatalf("WithGitSubmodule: init %s failed: %v", modDir, err)
+		}
+
+		modules := filepath.Join(root, ".gitmodules")
+		existing, err := toolkit.ReadFile(ctx, modules)
+		if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+			f.t.Fatalf("WithGitSubmodule: %v", err)
+		}
+		slashPath := filepath.ToSlash(path)
+		err = writeGitFiles(ctx, map[string]string{
+			filepath.Join(dir, ".git"): "gitdir: " + filepath.ToSlash(link) + "\n",
+			modules: string(existing) +
+				"[submodule \"" + slashPath + "\"]\n" +
+				"\tpath = " + slashPath + "\n" +
+				"\turl = ./" + slashPath + "\n",
+		})
+		if err != nil {
+			f.t.Fatalf("WithGitSubmodule: %s failed: %v", path, err)
+		}
+	}
+}
+
+// sandboxGitDir returns the .git directory of the repository at repo.
+func sandboxGitDir(ctx context.Context, repo string) (string, error) {
+	dir, err := toolkit.ResolvePath(ctx, repo, false)
+	if err != nil {
+		return "", err
+	}
+	gitDir := filepath.Join(dir, ".git")
+	info, err := toolkit.Stat(ctx, gitDir, false)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", &iofs.PathError{
+			Op:   "git",
+			Path: gitDir,
+			Err:  errors.New("not a repository created by WithGitRepo"),
+		}
+	}
+	return gitDir, nil
+}
+
+// initGitDir lays out a git directory at gitDir with HEAD on branch. core
+// holds extra lines for the [core] section of the config.
+func initGitDir(ctx context.Context, gitDir, branch, core string) error {
+	for _, dir := range []string{"objects/info", "objects/pack", "refs/heads", "refs/tags"} {
+		if err := toolkit.Mkdir(ctx, filepath.Join(gitDir, filepath.FromSlash(dir)), 0o755, true); err != nil {
+			return err
+		}
+	}
+	return writeGitFiles(ctx, map[string]string{
+		filepath.Join(gitDir, "HEAD"): "ref: refs/heads/" + branch + "\n",
+		filepath.Join(gitDir, "config"): "[core]\n" +
+			"\trepositoryformatversion = 0\n" +
+			"\tfilemode = true\n" +
+			"\tbare = false\n" +
+			"\tlogallrefupdates = true\n" +
+			core,
+		filepath.Join(gitDir, "description"): "Unnamed repository; edit this file 'description' to name the repository.\n",
+	})
+}
+
+// writeGitFiles writes each file in files, creating parent directories.
+func writeGitFiles(ctx context.Context, files map[string]string) error {
+	for name, data := range files {
+		if err := toolkit.WriteFile(ctx, name, []byte(data), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package sandbox_test
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tu "github.com/jlrickert/cli-toolkit/sandbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSandbox_WithGit verifies the repository, worktree and submodule
+// layouts created in the jail.
+func TestSandbox_WithGit(t *testing.T) {
+	t.Parallel()
+
+	sandbox := tu.NewSandbox(t, nil,
+		tu.WithGitRepo("~/repo"),
+		tu.WithGitWorktree("~/repo", "~/feature", ""),
+		tu.WithGitSubmodule("~/repo", "lib/sub"),
+		tu.WithGitSubmodule("~/repo", "vendor/tool"),
+	)
+
+	assert.Equal(t, "ref: refs/heads/main\n", string(sandbox.MustReadFile("~/repo/.git/HEAD")))
+	assert.Equal(t, "gitdir: /home/testuser/repo/.git/worktrees/feature\n",
+		string(sandbox.MustReadFile("~/feature/.git")))
+	assert.Equal(t, "ref: refs/heads/feature\n",
+		string(sandbox.MustReadFile("~/repo/.git/worktrees/feature/HEAD")))
+	assert.Equal(t, "gitdir: ../../.git/modules/lib/sub\n",
+		string(sandbox.MustReadFile("~/repo/lib/sub/.git")))
+	modules := string(sandbox.MustReadFile("~/repo/.gitmodules"))
+	assert.Contains(t, modules, "[submodule \"lib/sub\"]\n\tpath = lib/sub\n")
+	assert.Contains(t, modules, "[submodule \"vendor/tool\"]\n\tpath = vendor/tool\n")
+
+	// The git CLI recognises the layouts that do not depend on paths inside
+	// the jail.
+	git, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not installed")
+	}
+	jail := sandbox.GetJail()
+	for dir, want := range map[string]string{
+		"home/testuser/repo":         "home/testuser/repo",
+		"home/testuser/repo/lib/sub": "home/testuser/repo/lib/sub",
+	} {
+		cmd := exec.Command(git, "-C", filepath.Join(jail, dir), "rev-parse", "--show-toplevel")
+		cmd.Env = []string{"HOME=" + jail, "GIT_CONFIG_NOSYSTEM=1"}
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		got, err := filepath.EvalSymlinks(strings.TrimSpace(string(out)))
+		require.NoError(t, err)
+		wantDir, err := filepath.EvalSymlinks(filepath.Join(jail, want))
+		require.NoError(t, err)
+		assert.Equal(t, wantDir, got)
+	}
+}
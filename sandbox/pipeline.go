@@ -6,6 +6,8 @@ import (
 	"errors"
 	"sync"
 	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
 )
 
 // PipelineStage represents a single stage in a pipeline.
@@ -176,8 +178,11 @@ func (p *Pipeline) Run(ctx context.Context) *PipelineResult {
 // RunWithTimeout executes the pipeline with a deadline. If the
 // deadline is exceeded before completion, execution is cancelled and
 // context.DeadlineExceeded is returned in the result.
+//
+// The timeout is measured on the clock in ctx, so with a sandbox context it
+// expires only when the sandbox TestClock is advanced past it.
 func (p *Pipeline) RunWithTimeout(ctx context.Context, timeout time.Duration) *PipelineResult {
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	ctx, cancel := clock.WithTimeout(ctx, timeout)
 	defer cancel()
 	return p.Run(ctx)
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	tu "github.com/jlrickert/cli-toolkit/sandbox"
 	"github.com/jlrickert/cli-toolkit/toolkit"
@@ -80,3 +81,27 @@ func TestPipeline_TwoStages(t *testing.T) {
 	assert.Equal(t, "C:ALPHA\nC:BETA\nC:GAMMA\n", string(result.Stdout))
 	assert.Equal(t, outBuf.String(), string(result.Stdout))
 }
+
+// TestPipeline_RunWithTimeout verifies that the timeout is driven by the
+// sandbox clock.
+func TestPipeline_RunWithTimeout(t *testing.T) {
+	t.Parallel()
+
+	sandbox := tu.NewSandbox(t, nil)
+	waiter := func(ctx context.Context, s *toolkit.Stream) (int, error) {
+		<-ctx.Done()
+		return 1, ctx.Err()
+	}
+	pipeline := tu.NewPipeline(tu.Stage("waiter", waiter))
+
+	done := make(chan *tu.PipelineResult)
+	go func() {
+		done <- pipeline.RunWithTimeout(sandbox.Context(), time.Minute)
+	}()
+
+	sandbox.BlockUntil(1)
+	sandbox.Advance(time.Minute)
+	result := <-done
+	require.ErrorIs(t, result.Err, context.DeadlineExceeded)
+	assert.Equal(t, 1, result.ExitCode)
+}
@@ -16,6 +16,17 @@ import (
 // command-line arguments, returning an error on failure.
 type Runner func(ctx context.Context, stream *toolkit.Stream) (int, error)
 
+// argsKey is the context key for the arguments of a running Process.
+type argsKey struct{}
+
+// Args returns the command-line arguments of the Process running the
+// Runner that received ctx, as set with SetArgs. Like os.Args the first
+// element is the command name. It returns nil when no arguments were set.
+func Args(ctx context.Context) []string {
+	args, _ := ctx.Value(argsKey{}).([]string)
+	return args
+}
+
 // ProcessResult holds the outcome of process execution including any
 // error, exit code, and captured stdout and stderr output.
 type ProcessResult struct {
@@ -224,6 +235,7 @@ func (p *Process) Run(ctx context.Context) *ProcessResult {
 		}
 	}
 
+	args := p.args
 	p.mu.Unlock()
 
 	// Build the stream
@@ -236,6 +248,9 @@ func (p *Process) Run(ctx context.Context) *ProcessResult {
 	}
 
 	// Execute the runner
+	if args != nil {
+		ctx = context.WithValue(ctx, argsKey{}, args)
+	}
 	exitCode, err := p.runner(ctx, stream)
 
 	// Close pipe writers if they exist
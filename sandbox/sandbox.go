@@ -30,9 +30,10 @@ type Sandbox struct {
 	ctx  context.Context
 
 	logger *mylog.TestHandler
-	env    *toolkit.TestEnv
+	env    toolkit.Env
 	clock  *clock.TestClock
 	hasher *toolkit.MD5Hasher
+	faults *toolkit.FaultEnv
 }
 
 // SandboxOptions holds optional settings provided to NewSandbox.
@@ -44,27 +45,36 @@ type SandboxOptions struct {
 	Home string
 	// User is the username. Defaults to testuser.
 	User string
+	// InMemory backs the sandbox with a toolkit.MemEnv instead of a TestEnv
+	// jailed to a temporary directory. Nothing is written to disk.
+	InMemory bool
 }
 
 // NewSandbox constructs a Sandbox and applies given options. Cleanup is
 // registered with t.Cleanup so callers do not need to call a cleanup
 // function.
 func NewSandbox(t *testing.T, options *SandboxOptions, opts ...SandboxOption) *Sandbox {
-	jail := t.TempDir()
-
 	var home string
 	var user string
 	var data embed.FS
+	var inMemory bool
 	if options != nil {
 		home = options.Home
 		user = options.User
 		data = options.Data
+		inMemory = options.InMemory
 	}
-	env := toolkit.NewTestEnv(jail, home, user)
 
 	lg, handler := mylog.NewTestLogger(t, mylog.ParseLevel("debug"))
 	clk := clock.NewTestClock(
 		time.Date(2025, 10, 15, 12, 30, 0, 0, time.UTC))
+
+	var env toolkit.Env
+	if inMemory {
+		env = toolkit.NewMemEnv(clk, home, user)
+	} else {
+		env = toolkit.NewTestEnv(t.TempDir(), home, user)
+	}
 	hasher := &toolkit.MD5Hasher{}
 
 	// Populate common temp env vars.
@@ -130,6 +140,26 @@ func WithClock(t0 time.Time) SandboxOption {
 	}
 }
 
+// WithClockAutoAdvance returns a SandboxOption that makes every reading of
+// the sandbox clock move it forward by step, so code polling Now for
+// elapsed time makes progress. See clock.TestClock.SetAutoAdvance.
+func WithClockAutoAdvance(step time.Duration) SandboxOption {
+	return func(f *Sandbox) {
+		f.t.Helper()
+		f.clock.SetAutoAdvance(step)
+	}
+}
+
+// WithClockScale returns a SandboxOption that runs the sandbox clock at
+// scale times real time. See clock.TestClock.SetScale.
+func WithClockScale(scale float64) SandboxOption {
+	return func(f *Sandbox) {
+		f.t.Helper()
+		f.clock.SetScale(scale)
+		f.t.Cleanup(func() { f.clock.SetScale(0) })
+	}
+}
+
 // WithEnvMap returns a SandboxOption that seeds multiple environment
 // variables from a map.
 func WithEnvMap(m map[string]string) SandboxOption {
@@ -156,17 +186,161 @@ func WithFixture(fixture string, path string) SandboxOption {
 			f.t.Fatalf("WithFixture: source %s not found: %v", src, err)
 		}
 
-		p, _ := toolkit.ResolvePath(f.Context(), path, false)
-		dst := filepath.Join(f.GetJail(), p)
-		if err := copyEmbedDir(f.data, src, dst); err != nil {
+		dst, _ := toolkit.ResolvePath(f.Context(), path, false)
+		err := toolkit.CopyFS(f.Context(), f.data, src, dst, &toolkit.CopyOptions{
+			Overwrite: true,
+			FileMode:  0o644,
+			DirMode:   0o755,
+		})
+		if err != nil {
 			f.t.Fatalf("WithFixture: copy %s -> %s failed: %v",
 				src, dst, err)
 		}
 	}
 }
 
+// WithTxtar returns a SandboxOption that materializes a txtar archive below
+// path in the sandbox. Marker lines may carry the annotations described by
+// TreeFromTxtar, so a single inline archive can hold files with modes,
+// symlinks and empty directories:
+//
+//	tu.WithTxtar(`
+//	-- config.yaml --
+//	name: demo
+//	-- bin/run mode=0755 --
+//	#!/bin/sh
+//	-- current -> releases/v2 --
+//	`, "~/app")
+func WithTxtar(archive string, path string) SandboxOption {
+	return func(f *Sandbox) {
+		f.t.Helper()
+		tree, err := TreeFromTxtar([]byte(archive))
+		if err != nil {
+			f.t.Fatalf("WithTxtar: %v", err)
+		}
+		if err := f.WriteTree(path, tree); err != nil {
+			f.t.Fatalf("WithTxtar: write to %s failed: %v", path, err)
+		}
+	}
+}
+
+// WithFiles returns a SandboxOption that writes each value of files to the
+// sandbox path given by its key. Keys are resolved like other sandbox paths
+// and accept the TreeFromTxtar annotations, for example "~/bin/run
+// mode=0755", "~/cache/" for an empty directory or "~/current -> v2" for a
+// symlink, whose value is ignored.
+func WithFiles(files map[string]string) SandboxOption {
+	return func(f *Sandbox) {
+		f.t.Helper()
+		tree := make(Tree, len(files))
+		for key, data := range files {
+			name, entry, err := parseTreeHeader(key)
+			if err != nil {
+				f.t.Fatalf("WithFiles: %v", err)
+			}
+			if !entry.Dir && entry.Link == "" {
+				entry.Data = data
+			}
+			tree[name] = entry
+		}
+		if err := f.WriteTree("", tree); err != nil {
+			f.t.Fatalf("WithFiles: %v", err)
+		}
+	}
+}
+
+// WithFaults returns a SandboxOption that wraps the sandbox Env in a
+// toolkit.FaultEnv configured with opts. Unless opts sets a clock, latency
+// is spent on a private TestClock, so slow calls take no real time and do
+// not fire timers on the sandbox clock. Options applied earlier, such as
+// WithFixture, are not affected by the rules. Use Faults to add rules later.
+func WithFaults(opts *toolkit.FaultOptions) SandboxOption {
+	return func(f *Sandbox) {
+		f.t.Helper()
+		o := toolkit.FaultOptions{}
+		if opts != nil {
+			o = *opts
+		}
+		if o.Clock == nil {
+			o.Clock = clock.NewTestClock(f.clock.Now())
+		}
+		f.faults = toolkit.NewFaultEnv(f.env, &o)
+		f.env = f.faults
+		f.ctx = toolkit.WithEnv(f.ctx, f.env)
+	}
+}
+
+// Faults returns the FaultEnv installed by WithFaults, or nil.
+func (sandbox *Sandbox) Faults() *toolkit.FaultEnv {
+	return sandbox.faults
+}
+
+// lookupEnv returns the first Env implementing T, starting with env and
+// following Unwrap through any decorators such as toolkit.FaultEnv.
+func lookupEnv[T any](env toolkit.Env) (T, bool) {
+	for {
+		if v, ok := env.(T); ok {
+			return v, true
+		}
+		u, ok := env.(interface{ Unwrap() toolkit.Env })
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		env = u.Unwrap()
+	}
+}
+
+// GetJail returns the on-disk jail backing the sandbox. It is empty when the
+// sandbox is backed by an in-memory Env.
 func (sandbox *Sandbox) GetJail() string {
-	return sandbox.env.GetJail()
+	if j, ok := lookupEnv[interface{ GetJail() string }](sandbox.env); ok {
+		return j.GetJail()
+	}
+	return ""
+}
+
+// snapshotter is implemented by toolkit.TestEnv and toolkit.MemEnv.
+type snapshotter interface {
+	Snapshot() (*toolkit.Snapshot, error)
+	Restore(snap *toolkit.Snapshot) error
+}
+
+// SandboxSnapshot is the state captured by Sandbox.Snapshot.
+type SandboxSnapshot struct {
+	env *toolkit.Snapshot
+	now time.Time
+}
+
+// Snapshot captures the sandbox Env, including its whole filesystem, and the
+// test clock. Build an expensive fixture once, snapshot it, and Restore it
+// into the sandbox of each test or subtest.
+func (sandbox *Sandbox) Snapshot() *SandboxSnapshot {
+	sandbox.t.Helper()
+	s, ok := lookupEnv[snapshotter](sandbox.env)
+	if !ok {
+		sandbox.t.Fatalf("Snapshot: %s does not support snapshots", sandbox.env.Name())
+	}
+	snap, err := s.Snapshot()
+	if err != nil {
+		sandbox.t.Fatalf("Snapshot failed: %v", err)
+	}
+	return &SandboxSnapshot{env: snap, now: sandbox.clock.Now()}
+}
+
+// Restore replaces the sandbox Env state and filesystem with snap and sets
+// the test clock to the time it was taken. snap may come from another
+// sandbox.
+func (sandbox *Sandbox) Restore(snap *SandboxSnapshot) {
+	sandbox.t.Helper()
+	s, ok := lookupEnv[snapshotter](sandbox.env)
+	if !ok {
+		sandbox.t.Fatalf("Restore: %s does not support snapshots", sandbox.env.Name())
+	}
+	if err := s.Restore(snap.env); err != nil {
+		sandbox.t.Fatalf("Restore failed: %v", err)
+	}
+	sandbox.clock.Set(snap.now)
 }
 
 // Context returns the sandbox context.
@@ -201,7 +375,7 @@ func (sandbox *Sandbox) MustReadFile(rel string) []byte {
 
 func (sandbox *Sandbox) AtomicWriteFile(rel string, data []byte, perm os.FileMode) error {
 	sandbox.t.Helper()
-	if sandbox.GetJail() == "" {
+	if _, ok := sandbox.env.(*toolkit.TestEnv); ok && sandbox.GetJail() == "" {
 		return fmt.Errorf("no jail set")
 	}
 	return toolkit.AtomicWriteFile(sandbox.Context(), rel, data, perm)
@@ -243,76 +417,57 @@ func (sandbox *Sandbox) cleanup() {
 // DumpJailTree logs a tree of files and directories rooted at the sandbox's
 // Jail. Only directories with no children and files are logged. maxDepth
 // limits recursion depth; maxDepth <= 0 means unlimited depth.
+//
+// The tree is walked through the sandbox Env so paths are logged as seen
+// from inside the jail.
 func (sandbox *Sandbox) DumpJailTree(maxDepth int) {
 	sandbox.t.Helper()
-	if sandbox.GetJail() == "" {
-		sandbox.t.Log("DumpJailTree: no jail set")
-		return
-	}
 
-	sandbox.t.Logf("Jail tree: %s", sandbox.GetJail())
+	jail := sandbox.GetJail()
+	if jail == "" {
+		jail = sandbox.env.Name()
+	}
+	sandbox.t.Logf("Jail tree: %s", jail)
 
 	// First pass: collect all paths and determine which dirs have children
 	type pathInfo struct {
 		path  string
 		isDir bool
-		depth int
 	}
 	var paths []pathInfo
-	hasDirChild := make(map[string]bool)
-
-	err := filepath.WalkDir(sandbox.GetJail(), func(p string, d iofs.DirEntry,
-		err error) error {
-		if err != nil {
-			sandbox.t.Logf("  error: %v", err)
-			return nil
-		}
+	hasChild := make(map[string]bool)
 
-		var path string
-		if p == "." {
-			path = "/"
-		} else {
-			// TODO: Handle the error
-			path, _ = toolkit.ResolvePath(sandbox.Context(), p, false)
-		}
+	root := string(os.PathSeparator)
+	err := toolkit.WalkDir(sandbox.Context(), root,
+		func(path string, d iofs.DirEntry, err error) error {
+			if err != nil {
+				sandbox.t.Logf("  error: %v", err)
+				return nil
+			}
+			if path == root {
+				return nil
+			}
 
-		// Apply depth limit when requested.
-		if maxDepth > 0 {
-			depth := strings.Count(path, string(os.PathSeparator)) + 1
-			if depth > maxDepth {
+			// Apply depth limit when requested.
+			depth := strings.Count(path, string(os.PathSeparator))
+			if maxDepth > 0 && depth > maxDepth {
 				if d.IsDir() {
 					return filepath.SkipDir
 				}
 				return nil
 			}
-		}
-
-		if d.IsDir() {
-			depth := strings.Count(path, string(os.PathSeparator)) + 1
-			paths = append(paths, pathInfo{
-				path:  path,
-				isDir: true,
-				depth: depth,
-			})
-		} else {
-			paths = append(paths, pathInfo{
-				path:  path,
-				isDir: false,
-			})
-			// Mark parent as having children
-			parent := filepath.Dir(path)
-			hasDirChild[parent] = true
-		}
 
-		return nil
-	})
+			paths = append(paths, pathInfo{path: path, isDir: d.IsDir()})
+			hasChild[filepath.Dir(path)] = true
+			return nil
+		})
 
 	// Second pass: log only files and leaf directories
 	for _, pi := range paths {
 		if !pi.isDir {
 			// Always log files
 			sandbox.t.Logf("  %s", pi.path)
-		} else if !hasDirChild[pi.path] {
+		} else if !hasChild[pi.path] {
 			// Log directories with no children
 			sandbox.t.Logf("  %s/", pi.path)
 		}
@@ -323,12 +478,33 @@ func (sandbox *Sandbox) DumpJailTree(maxDepth int) {
 	}
 }
 
+// DumpTxtar logs the tree below root as a txtar archive, including file
+// contents, modes and symlinks. The output can be pasted into WithTxtar or a
+// golden file used by AssertTxtar.
+func (sandbox *Sandbox) DumpTxtar(root string) {
+	sandbox.t.Helper()
+	tree, err := sandbox.readTree(root)
+	if err != nil {
+		sandbox.t.Logf("DumpTxtar %s failed: %v", root, err)
+		return
+	}
+	sandbox.t.Logf("Jail tree %s:\n%s", root, tree.Txtar())
+}
+
 // Advance advances the sandbox test clock by the given duration.
 func (sandbox *Sandbox) Advance(d time.Duration) {
 	sandbox.t.Helper()
 	sandbox.clock.Advance(d)
 }
 
+// BlockUntil blocks until at least n timers, tickers or sleeps are waiting
+// on the sandbox test clock. Call it before Advance when code under test
+// waits on the clock from another goroutine.
+func (sandbox *Sandbox) BlockUntil(n int) {
+	sandbox.t.Helper()
+	sandbox.clock.BlockUntil(n)
+}
+
 // Now returns the current time from the sandbox test clock.
 func (sandbox *Sandbox) Now() time.Time {
 	sandbox.t.Helper()
@@ -354,33 +530,3 @@ func (sandbox *Sandbox) GetHome() (string, error) {
 	sandbox.t.Helper()
 	return sandbox.env.GetHome()
 }
-
-// copyEmbedDir recursively copies a directory tree from an embedded FS
-// to dst.
-func copyEmbedDir(fsys embed.FS, src, dst string) error {
-	entries, err := iofs.ReadDir(fsys, src)
-	if err != nil {
-		return err
-	}
-	if err := os.MkdirAll(dst, 0o755); err != nil {
-		return err
-	}
-	for _, e := range entries {
-		s := filepath.Join(src, e.Name())
-		d := filepath.Join(dst, e.Name())
-		if e.IsDir() {
-			if err := copyEmbedDir(fsys, s, d); err != nil {
-				return err
-			}
-			continue
-		}
-		data, err := fsys.ReadFile(s)
-		if err != nil {
-			return err
-		}
-		if err := os.WriteFile(d, data, 0o644); err != nil {
-			return err
-		}
-	}
-	return nil
-}
@@ -1,8 +1,12 @@
 package sandbox_test
 
 import (
+	"fmt"
+	"io/fs"
 	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/jlrickert/cli-toolkit/clock"
 	"github.com/jlrickert/cli-toolkit/mylog"
@@ -89,6 +93,20 @@ func TestSandbox_ContextCarriesClock(t *testing.T) {
 	require.False(t, now.IsZero())
 }
 
+// TestSandbox_WithClockAutoAdvance verifies that polling the sandbox clock
+// moves it forward.
+func TestSandbox_WithClockAutoAdvance(t *testing.T) {
+	t.Parallel()
+
+	sandbox := tu.NewSandbox(t, nil, tu.WithClockAutoAdvance(time.Second))
+	clk := clock.ClockFromContext(sandbox.Context())
+
+	start := clk.Now()
+	for clk.Since(start) < time.Minute {
+	}
+	require.GreaterOrEqual(t, sandbox.Now().Sub(start), time.Minute)
+}
+
 // TestSandbox_ContextCarriesEnv verifies that the test environment is
 // available from the context.
 func TestSandbox_ContextCarriesEnv(t *testing.T) {
@@ -217,3 +235,112 @@ func TestSandbox_ResolvePath(t *testing.T) {
 		})
 	}
 }
+
+// TestSandbox_InMemory verifies that a sandbox can be backed by a MemEnv
+// and still load fixtures and read and write files.
+func TestSandbox_InMemory(t *testing.T) {
+	t.Parallel()
+
+	sandbox := tu.NewSandbox(t, &tu.SandboxOptions{
+		Data:     testdata,
+		InMemory: true,
+	}, tu.WithFixture("example", "~/fixtures/example"))
+
+	_, ok := toolkit.EnvFromContext(sandbox.Context()).(*toolkit.MemEnv)
+	require.True(t, ok)
+	require.Empty(t, sandbox.GetJail())
+
+	data := sandbox.MustReadFile("fixtures/example/example.txt")
+	require.NotEmpty(t, data)
+
+	sandbox.MustWriteFile("out/result.txt", []byte("ok"), 0o644)
+	require.Equal(t, []byte("ok"), sandbox.MustReadFile("out/result.txt"))
+	require.NoError(t, sandbox.AtomicWriteFile("out/atomic.txt", []byte("a"), 0o644))
+}
+
+// TestSandbox_WithFaults verifies that fault rules apply to operations made
+// through the sandbox context after the option is applied.
+func TestSandbox_WithFaults(t *testing.T) {
+	t.Parallel()
+
+	sandbox := tu.NewSandbox(t, &tu.SandboxOptions{Data: testdata},
+		tu.WithFixture("example", "~/fixtures/example"),
+		tu.WithFaults(&toolkit.FaultOptions{Rules: []toolkit.FaultRule{
+			{Op: "ReadFile", Path: "example.txt", Err: syscall.EACCES, Latency: time.Minute},
+		}}))
+	require.NotEmpty(t, sandbox.GetJail())
+
+	start := sandbox.Now()
+	fired := clock.ClockFromContext(sandbox.Context()).After(time.Second)
+	_, err := sandbox.ReadFile("fixtures/example/example.txt")
+	require.ErrorIs(t, err, syscall.EACCES)
+	require.Equal(t, start, sandbox.Now(), "latency leaves the sandbox clock alone")
+	select {
+	case <-fired:
+		t.Fatal("latency fired a sandbox timer")
+	default:
+	}
+
+	sandbox.Faults().ClearRules()
+	require.NotEmpty(t, sandbox.MustReadFile("fixtures/example/example.txt"))
+}
+
+// TestSandbox_WithFaultsLockAndWatch verifies that locks and watchers taken
+// through WithFaults still use the TestEnv lock table and event hub.
+func TestSandbox_WithFaultsLockAndWatch(t *testing.T) {
+	t.Parallel()
+
+	sandbox := tu.NewSandbox(t, nil, tu.WithFaults(nil))
+	ctx := sandbox.Context()
+
+	l, err := toolkit.Lock(ctx, "~/app.yaml", nil)
+	require.NoError(t, err)
+	_, err = toolkit.Lock(ctx, "~/app.yaml", nil)
+	require.ErrorIs(t, err, toolkit.ErrLockTimeout)
+	_, err = sandbox.ReadFile("~/app.yaml.lock")
+	require.ErrorIs(t, err, fs.ErrNotExist, "no lock file is created")
+	require.NoError(t, l.Unlock())
+
+	w, err := toolkit.NewWatcher(ctx, nil)
+	require.NoError(t, err)
+	defer w.Close()
+	require.NoError(t, w.Add("~"))
+	sandbox.MustWriteFile("~/app.yaml", []byte("a: 1"), 0o644)
+	select {
+	case ev := <-w.Events():
+		require.Equal(t, toolkit.WatchEvent{Path: sandbox.ResolvePath("~/app.yaml"), Op: toolkit.WatchCreate}, ev)
+	default:
+		t.Fatal("no event delivered synchronously")
+	}
+}
+
+// TestSandbox_SnapshotRestore verifies that a fixture built once can be
+// restored into the sandboxes of several subtests.
+func TestSandbox_SnapshotRestore(t *testing.T) {
+	t.Parallel()
+
+	base := tu.NewSandbox(t, &tu.SandboxOptions{Data: testdata},
+		tu.WithFixture("example", "~/fixtures/example"),
+		tu.WithEnv("APP_MODE", "fixture"))
+	base.MustWriteFile("state.json", []byte("{}"), 0o600)
+	base.Advance(time.Hour)
+	snap := base.Snapshot()
+
+	for _, inMemory := range []bool{false, true} {
+		t.Run(fmt.Sprintf("in-memory=%t", inMemory), func(t *testing.T) {
+			t.Parallel()
+			sandbox := tu.NewSandbox(t, &tu.SandboxOptions{InMemory: inMemory})
+			sandbox.Restore(snap)
+
+			require.Equal(t, base.Now(), sandbox.Now())
+			require.NotEmpty(t, sandbox.MustReadFile("fixtures/example/example.txt"))
+			require.Equal(t, []byte("{}"), sandbox.MustReadFile("state.json"))
+			env := toolkit.EnvFromContext(sandbox.Context())
+			require.Equal(t, "fixture", env.Get("APP_MODE"))
+
+			// Changes do not leak back into the snapshot.
+			sandbox.MustWriteFile("state.json", []byte("[]"), 0o600)
+		})
+	}
+	require.Equal(t, []byte("{}"), base.MustReadFile("state.json"))
+}
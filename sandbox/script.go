@@ -0,0 +1,436 @@
+package sandbox
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/toolkit"
+)
+
+// ScriptOptions configures RunScripts.
+type ScriptOptions struct {
+	// Commands maps command names to the Runners started by exec.
+	Commands map[string]Runner
+	// Sandbox is passed to NewSandbox for the sandbox of each script.
+	Sandbox *SandboxOptions
+	// Setup holds options applied to the sandbox of each script.
+	Setup []SandboxOption
+}
+
+// RunScripts runs every *.txtar file in the host directory dir as a script,
+// each in a parallel subtest with a fresh Sandbox. See Sandbox.RunScript for
+// the script language. With -sandbox.update, cmp failures against files of
+// the archive rewrite those files in the script.
+func RunScripts(t *testing.T, dir string, opts *ScriptOptions) {
+	t.Helper()
+	if opts == nil {
+		opts = &ScriptOptions{}
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.txtar"))
+	if err != nil {
+		t.Fatalf("RunScripts: %v", err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("RunScripts: no scripts found in %s", dir)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".txtar")
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("RunScripts: %v", err)
+			}
+			sandbox := NewSandbox(t, opts.Sandbox, opts.Setup...)
+			s := newScriptState(sandbox, filepath.Base(file), data, opts.Commands)
+			s.file = file
+			s.run()
+		})
+	}
+}
+
+// RunScript runs a testscript-style script against the sandbox. script is
+// a txtar archive: the comment holds the script and the files are written
+// to the working directory before it starts. Each line is a command,
+// optionally prefixed with ! to expect failure. Words are separated by
+// spaces, may be quoted with single quotes (two single quotes make a literal
+// quote) and have $VAR expanded from the sandbox Env outside quotes. #
+// starts a comment.
+//
+// The commands are:
+//
+//	exec name args...   run the Runner registered as name; the arguments
+//	                    are available through Args. A registered name
+//	                    can also be used directly as a command.
+//	stdin file          use file as stdin of the next exec
+//	cmp a b             compare files; a may be stdout or stderr
+//	stdout regexp       match the stdout of the last exec
+//	stderr regexp       match the stderr of the last exec
+//	exists path...      check that the paths exist
+//	env KEY=VALUE...    set variables; env KEY logs the value
+//	cd dir              change the working directory
+//	advance duration    advance the sandbox clock, for example 5m
+//
+// Commands share the sandbox Env, clock and logger. The test fails at the
+// first command that does not behave as expected.
+func (sandbox *Sandbox) RunScript(script string, commands map[string]Runner) {
+	sandbox.t.Helper()
+	newScriptState(sandbox, "script", []byte(script), commands).run()
+}
+
+// scriptState holds the state of a running script.
+type scriptState struct {
+	sandbox  *Sandbox
+	commands map[string]Runner
+
+	// name is used in failure messages.
+	name string
+	// file is the host file the script came from. It is empty for inline
+	// scripts, which cannot be updated.
+	file    string
+	archive *txtarArchive
+	dirty   bool
+
+	stdin  []byte
+	stdout []byte
+	stderr []byte
+}
+
+func newScriptState(sandbox *Sandbox, name string, data []byte, commands map[string]Runner) *scriptState {
+	return &scriptState{
+		sandbox:  sandbox,
+		commands: commands,
+		name:     name,
+		archive:  parseTxtar(data),
+	}
+}
+
+// scriptCommand implements a built-in script command. neg is true when the
+// command was prefixed with !.
+type scriptCommand func(s *scriptState, neg bool, args []string) error
+
+var scriptBuiltins = map[string]scriptCommand{
+	"advance": (*scriptState).cmdAdvance,
+	"cd":      (*scriptState).cmdCd,
+	"cmp":     (*scriptState).cmdCmp,
+	"env":     (*scriptState).cmdEnv,
+	"exec":    (*scriptState).cmdExec,
+	"exists":  (*scriptState).cmdExists,
+	"stderr":  (*scriptState).cmdStderr,
+	"stdin":   (*scriptState).cmdStdin,
+	"stdout":  (*scriptState).cmdStdout,
+}
+
+func (s *scriptState) run() {
+	t := s.sandbox.t
+	t.Helper()
+
+	tree := make(Tree, len(s.archive.Files))
+	for _, f := range s.archive.Files {
+		name, entry, err := parseTreeHeader(f.Name)
+		if err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if !entry.Dir && entry.Link == "" {
+			entry.Data = string(f.Data)
+		}
+		tree[name] = entry
+	}
+	if err := s.sandbox.WriteTree("", tree); err != nil {
+		t.Fatalf("%s: write files: %v", s.name, err)
+	}
+
+	for i, line := range strings.Split(string(s.archive.Comment), "\n") {
+		words, err := s.split(line)
+		if err != nil {
+			t.Fatalf("%s:%d: %v", s.name, i+1, err)
+		}
+		if len(words) == 0 {
+			continue
+		}
+		t.Logf("> %s", strings.TrimSpace(line))
+		if err := s.exec(words); err != nil {
+			t.Fatalf("%s:%d: %s: %v", s.name, i+1, strings.TrimSpace(line), err)
+		}
+	}
+
+	if s.dirty {
+		if err := os.WriteFile(s.file, s.archive.format(), 0o644); err != nil {
+			t.Fatalf("%s: update failed: %v", s.name, err)
+		}
+		t.Logf("%s: updated golden files", s.file)
+	}
+}
+
+// exec runs a single parsed command line.
+func (s *scriptState) exec(words []string) error {
+	neg := false
+	if words[0] == "!" {
+		neg = true
+		words = words[1:]
+		if len(words) == 0 {
+			return fmt.Errorf("missing command after !")
+		}
+	}
+	if cmd, ok := scriptBuiltins[words[0]]; ok {
+		return cmd(s, neg, words[1:])
+	}
+	if _, ok := s.commands[words[0]]; ok {
+		return s.cmdExec(neg, words)
+	}
+	return fmt.Errorf("unknown command %q", words[0])
+}
+
+// split splits a script line into words, handling single quotes, comments
+// and variable expansion.
+func (s *scriptState) split(line string) ([]string, error) {
+	ctx := s.sandbox.Context()
+	var words []string
+	var word, plain strings.Builder
+	inWord, quoted := false, false
+	flush := func() {
+		word.WriteString(toolkit.ExpandEnv(ctx, plain.String()))
+		plain.Reset()
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quoted && c == '\'':
+			if i+1 < len(line) && line[i+1] == '\'' {
+				word.WriteByte('\'')
+				i++
+				continue
+			}
+			quoted = false
+		case quoted:
+			word.WriteByte(c)
+		case c == '\'':
+			flush()
+			quoted, inWord = true, true
+		case c == '#' && !inWord:
+			i = len(line)
+		case c == ' ' || c == '\t' || c == '\r':
+			if inWord {
+				flush()
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			plain.WriteByte(c)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		flush()
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+func (s *scriptState) cmdExec(neg bool, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: exec name [args...]")
+	}
+	runner, ok := s.commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	p := NewProcess(runner, false)
+	p.SetArgs(args)
+	p.SetStdin(bytes.NewReader(s.stdin))
+	s.stdin = nil
+	res := p.Run(s.sandbox.Context())
+	s.stdout, s.stderr = res.Stdout, res.Stderr
+	if len(s.stdout) > 0 {
+		s.sandbox.t.Logf("[stdout]\n%s", s.stdout)
+	}
+	if len(s.stderr) > 0 {
+		s.sandbox.t.Logf("[stderr]\n%s", s.stderr)
+	}
+
+	failed := res.Err != nil || res.ExitCode != 0
+	switch {
+	case failed && !neg && res.Err != nil:
+		return fmt.Errorf("unexpected failure: exit code %d: %w", res.ExitCode, res.Err)
+	case failed && !neg:
+		return fmt.Errorf("unexpected failure: exit code %d", res.ExitCode)
+	case !failed && neg:
+		return fmt.Errorf("unexpected success")
+	}
+	return nil
+}
+
+func (s *scriptState) cmdStdin(neg bool, args []string) error {
+	if neg || len(args) != 1 {
+		return fmt.Errorf("usage: stdin file")
+	}
+	data, err := s.sandbox.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	s.stdin = data
+	return nil
+}
+
+// content returns the data named by a cmp argument.
+func (s *scriptState) content(name string) ([]byte, error) {
+	switch name {
+	case "stdout":
+		return s.stdout, nil
+	case "stderr":
+		return s.stderr, nil
+	}
+	return s.sandbox.ReadFile(name)
+}
+
+func (s *scriptState) cmdCmp(neg bool, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: cmp a b")
+	}
+	got, err := s.content(args[0])
+	if err != nil {
+		return err
+	}
+	want, err := s.content(args[1])
+	if err != nil {
+		return err
+	}
+	equal := bytes.Equal(got, want)
+	switch {
+	case neg && equal:
+		return fmt.Errorf("%s and %s do not differ", args[0], args[1])
+	case neg || equal:
+		return nil
+	case updating() && s.updateFile(args[1], got):
+		return s.sandbox.WriteFile(args[1], got, 0o644)
+	}
+	return fmt.Errorf("%s and %s differ:\n%s", args[0], args[1],
+		unifiedDiff(string(want), string(got)))
+}
+
+// updateFile replaces the archive file name with data. It reports false when
+// the script did not come from a file or does not contain name.
+func (s *scriptState) updateFile(name string, data []byte) bool {
+	if s.file == "" {
+		return false
+	}
+	for i, f := range s.archive.Files {
+		if n, _, err := parseTreeHeader(f.Name); err == nil && n == filepath.ToSlash(filepath.Clean(name)) {
+			s.archive.Files[i].Data = data
+			s.dirty = true
+			return true
+		}
+	}
+	return false
+}
+
+func (s *scriptState) cmdStdout(neg bool, args []string) error {
+	return s.match("stdout", s.stdout, neg, args)
+}
+
+func (s *scriptState) cmdStderr(neg bool, args []string) error {
+	return s.match("stderr", s.stderr, neg, args)
+}
+
+// match checks data against the regular expression in args. The expression
+// is compiled in multi-line mode so ^ and $ match at line boundaries.
+func (s *scriptState) match(name string, data []byte, neg bool, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s regexp", name)
+	}
+	re, err := regexp.Compile("(?m)" + args[0])
+	if err != nil {
+		return err
+	}
+	matched := re.Match(data)
+	switch {
+	case matched && neg:
+		return fmt.Errorf("unexpected match for %#q in %s", args[0], name)
+	case !matched && !neg:
+		return fmt.Errorf("no match for %#q in %s", args[0], name)
+	}
+	return nil
+}
+
+func (s *scriptState) cmdExists(neg bool, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: exists path...")
+	}
+	for _, p := range args {
+		_, err := toolkit.Lstat(s.sandbox.Context(), p)
+		switch {
+		case err == nil && neg:
+			return fmt.Errorf("%s unexpectedly exists", p)
+		case err != nil && !neg:
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *scriptState) cmdEnv(neg bool, args []string) error {
+	if neg {
+		return fmt.Errorf("usage: env KEY=VALUE...")
+	}
+	env := toolkit.EnvFromContext(s.sandbox.Context())
+	if len(args) == 0 {
+		environ := env.Environ()
+		slices.Sort(environ)
+		s.sandbox.t.Logf("%s", strings.Join(environ, "\n"))
+		return nil
+	}
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			s.sandbox.t.Logf("%s=%s", key, env.Get(key))
+			continue
+		}
+		if err := env.Set(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *scriptState) cmdCd(neg bool, args []string) error {
+	if neg || len(args) != 1 {
+		return fmt.Errorf("usage: cd dir")
+	}
+	ctx := s.sandbox.Context()
+	dir, err := toolkit.ResolvePath(ctx, args[0], true)
+	if err != nil {
+		return err
+	}
+	info, err := toolkit.EnvFromContext(ctx).Stat(dir, true)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", args[0])
+	}
+	s.sandbox.Setwd(dir)
+	return nil
+}
+
+func (s *scriptState) cmdAdvance(neg bool, args []string) error {
+	if neg || len(args) != 1 {
+		return fmt.Errorf("usage: advance duration")
+	}
+	d, err := time.ParseDuration(args[0])
+	if err != nil {
+		return err
+	}
+	s.sandbox.Advance(d)
+	return nil
+}
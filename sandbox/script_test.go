@@ -0,0 +1,90 @@
+package sandbox_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+	tu "github.com/jlrickert/cli-toolkit/sandbox"
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptCommands are the Runners available to the test scripts.
+var scriptCommands = map[string]tu.Runner{
+	"greet": func(ctx context.Context, s *toolkit.Stream) (int, error) {
+		greeting := toolkit.EnvFromContext(ctx).Get("GREETING")
+		if greeting == "" {
+			greeting = "hello"
+		}
+		names := tu.Args(ctx)[1:]
+		if len(names) == 0 {
+			sc := bufio.NewScanner(s.In)
+			for sc.Scan() {
+				names = append(names, sc.Text())
+			}
+		}
+		for _, name := range names {
+			fmt.Fprintf(s.Out, "%s %s\n", greeting, name)
+		}
+		return 0, nil
+	},
+	"now": func(ctx context.Context, s *toolkit.Stream) (int, error) {
+		fmt.Fprintln(s.Out, clock.ClockFromContext(ctx).Now().Format(time.RFC3339))
+		return 0, nil
+	},
+	"fail": func(ctx context.Context, s *toolkit.Stream) (int, error) {
+		fmt.Fprintln(s.Err, "boom")
+		return 1, nil
+	},
+	"pwd": func(ctx context.Context, s *toolkit.Stream) (int, error) {
+		wd, err := toolkit.EnvFromContext(ctx).Getwd()
+		fmt.Fprintln(s.Out, wd)
+		return 0, err
+	},
+}
+
+// TestScripts runs the scripts in testdata/scripts.
+func TestScripts(t *testing.T) {
+	t.Parallel()
+
+	tu.RunScripts(t, "testdata/scripts", &tu.ScriptOptions{
+		Commands: scriptCommands,
+	})
+}
+
+// TestSandbox_RunScript verifies inline scripts share the sandbox state.
+func TestSandbox_RunScript(t *testing.T) {
+	t.Parallel()
+
+	sandbox := tu.NewSandbox(t, &tu.SandboxOptions{InMemory: true})
+	sandbox.RunScript(`
+env NAME=ada
+greet $NAME '$NAME' 'it''s'
+cmp stdout want
+
+# Comments and blank lines are ignored.
+-- want --
+hello ada
+hello $NAME
+hello it's
+`[1:], scriptCommands)
+}
+
+// TestArgs verifies that Runners see the arguments set on their Process.
+func TestArgs(t *testing.T) {
+	t.Parallel()
+
+	var got []string
+	p := tu.NewProcess(func(ctx context.Context, s *toolkit.Stream) (int, error) {
+		got = tu.Args(ctx)
+		return 0, nil
+	}, false)
+	p.SetArgs([]string{"cmd", "-v", "file"})
+	p.Run(t.Context())
+	assert.Equal(t, []string{"cmd", "-v", "file"}, got)
+	assert.Nil(t, tu.Args(t.Context()))
+}
@@ -0,0 +1,540 @@
+package sandbox
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	iofs "io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jlrickert/cli-toolkit/toolkit"
+)
+
+// update is set by running tests with -sandbox.update. AssertFixture and
+// AssertTxtar then rewrite their golden files from the sandbox instead of
+// comparing against them. A boolean -update flag defined by the test
+// package is honoured as well.
+var update = flag.Bool("sandbox.update", false, "rewrite sandbox golden fixtures")
+
+// updating reports whether golden fixtures should be rewritten.
+func updating() bool {
+	if *update {
+		return true
+	}
+	if f := flag.Lookup("update"); f != nil {
+		if g, ok := f.Value.(flag.Getter); ok {
+			v, _ := g.Get().(bool)
+			return v
+		}
+	}
+	return false
+}
+
+// TreeEntry describes a single file, directory or symlink in a Tree.
+type TreeEntry struct {
+	// Data is the content of a regular file.
+	Data string
+	// Mode holds the permission bits. Zero means the mode is not checked
+	// when the entry is part of an expected tree.
+	Mode os.FileMode
+	// Link is the target of a symlink. A non-empty Link makes the entry a
+	// symlink.
+	Link string
+	// Dir marks the entry as a directory.
+	Dir bool
+}
+
+// Tree is a filesystem tree keyed by slash separated paths relative to the
+// tree root. Parent directories of entries are implied and only need to be
+// listed to check their mode or to expect an empty directory.
+type Tree map[string]TreeEntry
+
+// TreeFromMap returns a Tree with a regular file for each key of m holding
+// the value as its content. Keys ending in "/" are directories.
+func TreeFromMap(m map[string]string) Tree {
+	tree := make(Tree, len(m))
+	for name, data := range m {
+		if strings.HasSuffix(name, "/") {
+			tree[path.Clean(name)] = TreeEntry{Dir: true}
+			continue
+		}
+		tree[path.Clean(name)] = TreeEntry{Data: data}
+	}
+	return tree
+}
+
+// TreeFromFS returns the Tree rooted at dir in fsys. Modes are left
+// unchecked because filesystems such as embed.FS do not record them. Empty
+// directories are included; embed.FS cannot hold them.
+func TreeFromFS(fsys iofs.FS, dir string) (Tree, error) {
+	tree := Tree{}
+	err := iofs.WalkDir(fsys, dir, func(p string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+		rel := strings.TrimPrefix(p, dir+"/")
+		if dir == "." {
+			rel = p
+		}
+		switch {
+		case d.IsDir():
+			entries, err := iofs.ReadDir(fsys, p)
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				tree[rel] = TreeEntry{Dir: true}
+			}
+		case d.Type()&iofs.ModeSymlink != 0:
+			target, err := iofs.ReadLink(fsys, p)
+			if err != nil {
+				return err
+			}
+			tree[rel] = TreeEntry{Link: target}
+		default:
+			data, err := iofs.ReadFile(fsys, p)
+			if err != nil {
+				return err
+			}
+			tree[rel] = TreeEntry{Data: string(data)}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// TreeFromTxtar parses a txtar archive into a Tree. The file name in each
+// marker line may carry annotations:
+//
+//	-- bin/run mode=0755 --
+//	-- cache/ --
+//	-- current -> releases/v2 --
+//
+// A trailing slash makes the entry a directory, "-> target" a symlink and
+// "mode=" sets the expected permission bits in octal. The archive comment is
+// ignored.
+func TreeFromTxtar(data []byte) (Tree, error) {
+	tree := Tree{}
+	for _, f := range parseTxtar(data).Files {
+		name, entry, err := parseTreeHeader(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		if name == "." || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("txtar entry %q: path must be relative", f.Name)
+		}
+		if !entry.Dir && entry.Link == "" {
+			entry.Data = string(f.Data)
+		}
+		tree[name] = entry
+	}
+	return tree, nil
+}
+
+// parseTreeHeader parses an annotated txtar file name or WithFiles key into
+// a cleaned path and an entry without data.
+func parseTreeHeader(header string) (string, TreeEntry, error) {
+	var entry TreeEntry
+	fields := strings.Fields(header)
+	if n := len(fields); n > 1 && strings.HasPrefix(fields[n-1], "mode=") {
+		mode, err := strconv.ParseUint(strings.TrimPrefix(fields[n-1], "mode="), 8, 32)
+		if err != nil {
+			return "", entry, fmt.Errorf("txtar entry %q: invalid mode: %w", header, err)
+		}
+		entry.Mode = os.FileMode(mode) & os.ModePerm
+		header = strings.TrimSpace(strings.TrimSuffix(header, fields[n-1]))
+	}
+	if name, target, ok := strings.Cut(header, " -> "); ok {
+		header = strings.TrimSpace(name)
+		entry.Link = strings.TrimSpace(target)
+	}
+	if strings.HasSuffix(header, "/") {
+		entry.Dir = true
+	}
+	return path.Clean(header), entry, nil
+}
+
+// Txtar returns the tree as a txtar archive using the annotations understood
+// by TreeFromTxtar. Only non-default modes are written: 0644 for files and
+// 0755 for directories are left out. Directories are written only when they
+// are empty or carry a mode, since the others are implied by their contents.
+// txtar cannot represent a missing final newline, so one is added.
+func (tree Tree) Txtar() []byte {
+	a := &txtarArchive{}
+	for _, name := range tree.names() {
+		e := tree[name]
+		if e.Dir && tree.hasChildren(name) && (e.Mode == 0 || e.Mode == 0o755) {
+			continue
+		}
+		a.Files = append(a.Files, txtarFile{
+			Name: formatTreeHeader(name, e, true),
+			Data: []byte(e.Data),
+		})
+	}
+	return a.format()
+}
+
+// formatTreeHeader returns the annotated txtar file name of an entry. When
+// omitDefault is true the default modes are not annotated.
+func formatTreeHeader(name string, e TreeEntry, omitDefault bool) string {
+	var def os.FileMode = 0o644
+	switch {
+	case e.Link != "":
+		return name + " -> " + e.Link
+	case e.Dir:
+		name += "/"
+		def = 0o755
+	}
+	if e.Mode == 0 || (omitDefault && e.Mode == def) {
+		return name
+	}
+	return fmt.Sprintf("%s mode=%04o", name, e.Mode)
+}
+
+// names returns the sorted entry names.
+func (tree Tree) names() []string {
+	return slices.Sorted(maps.Keys(tree))
+}
+
+// hasChildren reports whether any entry lies below dir.
+func (tree Tree) hasChildren(dir string) bool {
+	for name := range tree {
+		if strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// listing renders the tree as a stable txtar-like text used for diffs.
+// Every mode that is set is shown and a missing final newline is marked the
+// way diff does.
+func (tree Tree) listing() string {
+	var sb strings.Builder
+	for _, name := range tree.names() {
+		e := tree[name]
+		sb.WriteString("-- " + formatTreeHeader(name, e, false) + " --\n")
+		if e.Data == "" {
+			continue
+		}
+		sb.WriteString(e.Data)
+		if !strings.HasSuffix(e.Data, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+	return sb.String()
+}
+
+// ReadTree returns the files, directories and symlinks below root in the
+// sandbox with their permission bits. Symlinks are not followed. It fails
+// the test when root cannot be walked.
+func (sandbox *Sandbox) ReadTree(root string) Tree {
+	sandbox.t.Helper()
+	tree, err := sandbox.readTree(root)
+	if err != nil {
+		sandbox.t.Fatalf("ReadTree %s failed: %v", root, err)
+	}
+	return tree
+}
+
+func (sandbox *Sandbox) readTree(root string) (Tree, error) {
+	ctx := sandbox.Context()
+	abs, err := toolkit.ResolvePath(ctx, root, true)
+	if err != nil {
+		return nil, err
+	}
+	tree := Tree{}
+	err = toolkit.WalkDir(ctx, abs, func(p string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == abs {
+			return nil
+		}
+		rel, err := filepath.Rel(abs, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mode := info.Mode().Perm()
+		switch {
+		case d.IsDir():
+			tree[rel] = TreeEntry{Dir: true, Mode: mode}
+		case d.Type()&iofs.ModeSymlink != 0:
+			target, err := toolkit.Readlink(ctx, p)
+			if err != nil {
+				return err
+			}
+			tree[rel] = TreeEntry{Link: filepath.ToSlash(target)}
+		default:
+			data, err := toolkit.ReadFile(ctx, p)
+			if err != nil {
+				return err
+			}
+			tree[rel] = TreeEntry{Data: string(data), Mode: mode}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// WriteTree materializes tree below root in the sandbox, replacing existing
+// files and symlinks. Entries without a mode get 0644 for files and 0755 for
+// directories. With an empty root the names are resolved like any other
+// sandbox path, so they may start with ~ or be absolute.
+func (sandbox *Sandbox) WriteTree(root string, tree Tree) error {
+	sandbox.t.Helper()
+	ctx := sandbox.Context()
+	var dirs []string
+	for _, name := range tree.names() {
+		e := tree[name]
+		p := filepath.Join(root, filepath.FromSlash(name))
+		switch {
+		case e.Dir:
+			// Modes are applied last so read-only directories can be
+			// populated first.
+			if err := toolkit.Mkdir(ctx, p, 0o755, true); err != nil {
+				return err
+			}
+			dirs = append(dirs, name)
+		case e.Link != "":
+			if err := toolkit.Mkdir(ctx, filepath.Dir(p), 0o755, true); err != nil {
+				return err
+			}
+			err := toolkit.Remove(ctx, p, false)
+			if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+				return err
+			}
+			if err := toolkit.Symlink(ctx, filepath.FromSlash(e.Link), p); err != nil {
+				return err
+			}
+		default:
+			mode := cmp.Or(e.Mode, 0o644)
+			if err := toolkit.WriteFile(ctx, p, []byte(e.Data), mode); err != nil {
+				return err
+			}
+			if err := toolkit.Chmod(ctx, p, mode); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range slices.Backward(dirs) {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := toolkit.Chmod(ctx, p, cmp.Or(tree[name].Mode, 0o755)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compareTrees returns got trimmed to what want describes: modes are kept
+// only where want sets one and directories only where want lists them or
+// they are empty.
+func compareTrees(want, got Tree) Tree {
+	out := make(Tree, len(got))
+	for name, g := range got {
+		w, listed := want[name]
+		if g.Dir && !listed && got.hasChildren(name) {
+			continue
+		}
+		if !listed || w.Mode == 0 {
+			g.Mode = 0
+		}
+		out[name] = g
+	}
+	return out
+}
+
+// DiffTree describes how got differs from want: the missing, extra and
+// changed entries followed by a unified diff (-want +got) of both trees. It
+// returns an empty string when they match. Modes are compared only for
+// entries of want that set one, and directories only when want lists them or
+// they are empty in got.
+func DiffTree(want, got Tree) string {
+	got = compareTrees(want, got)
+	if maps.Equal(want, got) {
+		return ""
+	}
+	var missing, extra, changed []string
+	for _, name := range want.names() {
+		g, ok := got[name]
+		switch {
+		case !ok:
+			missing = append(missing, name)
+		case g != want[name]:
+			changed = append(changed, name)
+		}
+	}
+	for _, name := range got.names() {
+		if _, ok := want[name]; !ok {
+			extra = append(extra, name)
+		}
+	}
+
+	var sb strings.Builder
+	for _, group := range []struct {
+		label string
+		names []string
+	}{{"missing", missing}, {"extra", extra}, {"changed", changed}} {
+		if len(group.names) > 0 {
+			fmt.Fprintf(&sb, "%s: %s\n", group.label, strings.Join(group.names, ", "))
+		}
+	}
+	sb.WriteString("\n")
+	sb.WriteString(unifiedDiff(want.listing(), got.listing()))
+	return sb.String()
+}
+
+// AssertTree compares the tree below root in the sandbox with want and
+// reports any difference, as described by DiffTree, as a test error. It
+// returns whether the trees matched.
+func (sandbox *Sandbox) AssertTree(root string, want Tree) bool {
+	sandbox.t.Helper()
+	got, err := sandbox.readTree(root)
+	if err != nil {
+		sandbox.t.Errorf("AssertTree %s: %v", root, err)
+		return false
+	}
+	if msg := DiffTree(want, got); msg != "" {
+		sandbox.t.Errorf("AssertTree %s mismatch:\n%s", root, msg)
+		return false
+	}
+	return true
+}
+
+// AssertFixture compares the tree below root with the fixture directory
+// data/<fixture> of the sandbox Data filesystem, like AssertTree. With
+// -sandbox.update the fixture directory is instead rewritten on disk from
+// the sandbox, relative to the package directory; rebuild the test binary
+// to embed the new contents. embed.FS cannot hold symlinks or empty
+// directories, so such fixtures should use AssertTxtar.
+func (sandbox *Sandbox) AssertFixture(root string, fixture string) bool {
+	sandbox.t.Helper()
+	dir := path.Join("data", fixture)
+	if updating() {
+		got := sandbox.ReadTree(root)
+		if err := writeFixtureDir(filepath.FromSlash(dir), got); err != nil {
+			sandbox.t.Fatalf("AssertFixture: update %s failed: %v", dir, err)
+		}
+		return true
+	}
+	want, err := TreeFromFS(sandbox.data, dir)
+	if err != nil {
+		sandbox.t.Fatalf("AssertFixture: fixture %s: %v", dir, err)
+	}
+	return sandbox.AssertTree(root, want)
+}
+
+// writeFixtureDir replaces dir on the host filesystem with tree. The tree
+// is written to a temporary sibling of dir first and swapped in once
+// complete, so a failure leaves the existing fixture untouched.
+func writeFixtureDir(dir string, tree Tree) error {
+	names := tree.names()
+	for _, name := range names {
+		if tree[name].Link != "" {
+			return fmt.Errorf("%s: embed.FS cannot hold symlinks", name)
+		}
+	}
+
+	parent := filepath.Dir(dir)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(parent, "."+filepath.Base(dir)+".update-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Chmod(tmp, 0o755); err != nil {
+		return err
+	}
+	for _, name := range names {
+		e := tree[name]
+		p := filepath.Join(tmp, filepath.FromSlash(name))
+		if e.Dir {
+			if err := os.MkdirAll(p, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, []byte(e.Data), 0o644); err != nil {
+			return err
+		}
+	}
+
+	old := tmp + ".old"
+	if err := os.Rename(dir, old); err != nil && !errors.Is(err, iofs.ErrNotExist) {
+		return err
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		_ = os.Rename(old, dir)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// AssertTxtar compares the tree below root with the txtar archive in the
+// host file golden, like AssertTree. See TreeFromTxtar for the annotations
+// used for modes, symlinks and empty directories. Because txtar always ends
+// files with a newline, a missing final newline is not reported. With
+// -sandbox.update the golden file is rewritten from the sandbox instead.
+func (sandbox *Sandbox) AssertTxtar(root string, golden string) bool {
+	sandbox.t.Helper()
+	if updating() {
+		got := sandbox.ReadTree(root)
+		if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+			sandbox.t.Fatalf("AssertTxtar: update %s failed: %v", golden, err)
+		}
+		if err := os.WriteFile(golden, got.Txtar(), 0o644); err != nil {
+			sandbox.t.Fatalf("AssertTxtar: update %s failed: %v", golden, err)
+		}
+		return true
+	}
+	data, err := os.ReadFile(golden)
+	if err != nil {
+		sandbox.t.Fatalf("AssertTxtar: %v (run with -sandbox.update to create it)", err)
+	}
+	want, err := TreeFromTxtar(data)
+	if err != nil {
+		sandbox.t.Fatalf("AssertTxtar: %s: %v", golden, err)
+	}
+	got, err := sandbox.readTree(root)
+	if err != nil {
+		sandbox.t.Errorf("AssertTxtar %s: %v", root, err)
+		return false
+	}
+	for name, e := range got {
+		if !e.Dir && e.Link == "" {
+			e.Data = string(fixTxtarNL([]byte(e.Data)))
+			got[name] = e
+		}
+	}
+	if msg := DiffTree(want, got); msg != "" {
+		sandbox.t.Errorf("AssertTxtar %s mismatch against %s:\n%s", root, golden, msg)
+		return false
+	}
+	return true
+}
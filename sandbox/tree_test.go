@@ -0,0 +1,195 @@
+package sandbox_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	tu "github.com/jlrickert/cli-toolkit/sandbox"
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedTree writes a small tree with a custom mode, a symlink and an empty
+// directory below ~/out.
+func seedTree(t *testing.T, sandbox *tu.Sandbox) {
+	t.Helper()
+	ctx := sandbox.Context()
+	sandbox.MustWriteFile("~/out/README.md", []byte("# out\n"), 0o644)
+	sandbox.MustWriteFile("~/out/bin/run", []byte("#!/bin/sh\n"), 0o755)
+	require.NoError(t, toolkit.Chmod(ctx, "~/out/bin/run", 0o755))
+	require.NoError(t, toolkit.Symlink(ctx, "README.md", "~/out/latest"))
+	require.NoError(t, toolkit.Mkdir(ctx, "~/out/cache", 0o755, true))
+}
+
+// TestSandbox_AssertTree verifies trees expressed as maps, Tree values and
+// inline txtar archives on disk and in memory.
+func TestSandbox_AssertTree(t *testing.T) {
+	t.Parallel()
+
+	for name, inMemory := range map[string]bool{"jail": false, "in-memory": true} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			sandbox := tu.NewSandbox(t, &tu.SandboxOptions{InMemory: inMemory})
+			seedTree(t, sandbox)
+
+			sandbox.AssertTree("~/out", tu.Tree{
+				"README.md": {Data: "# out\n"},
+				"bin/run":   {Data: "#!/bin/sh\n", Mode: 0o755},
+				"latest":    {Link: "README.md"},
+				"cache":     {Dir: true},
+			})
+
+			want, err := tu.TreeFromTxtar([]byte(`generated by seedTree
+-- README.md --
+# out
+-- bin/run mode=0755 --
+#!/bin/sh
+-- cache/ --
+-- latest -> README.md --
+`))
+			require.NoError(t, err)
+			sandbox.AssertTree("~/out", want)
+
+			// Txtar round trips the tree read from the sandbox.
+			dumped, err := tu.TreeFromTxtar(sandbox.ReadTree("~/out").Txtar())
+			require.NoError(t, err)
+			assert.Equal(t, want, dumped)
+
+			sandbox.AssertTree("~/out/bin", tu.TreeFromMap(map[string]string{
+				"run": "#!/bin/sh\n",
+			}))
+		})
+	}
+}
+
+// TestSandbox_AssertFixture verifies comparison against an embedded
+// fixture directory.
+func TestSandbox_AssertFixture(t *testing.T) {
+	t.Parallel()
+
+	sandbox := tu.NewSandbox(t, &tu.SandboxOptions{Data: testdata},
+		tu.WithFixture("example", "~/out"))
+
+	sandbox.AssertFixture("~/out", "example")
+}
+
+// TestSandbox_AssertTxtar verifies comparison against a golden txtar file.
+// Run with -sandbox.update to regenerate it.
+func TestSandbox_AssertTxtar(t *testing.T) {
+	t.Parallel()
+
+	sandbox := tu.NewSandbox(t, nil)
+	seedTree(t, sandbox)
+
+	sandbox.AssertTxtar("~/out", "testdata/tree.txtar")
+}
+
+// TestDiffTree verifies that mismatches name the affected entries and
+// include a unified diff.
+func TestDiffTree(t *testing.T) {
+	t.Parallel()
+
+	want := tu.Tree{
+		"a.txt":   {Data: "one\ntwo\nthree\n"},
+		"b.txt":   {Data: "b\n"},
+		"bin/run": {Data: "x\n", Mode: 0o755},
+	}
+	got := tu.Tree{
+		"a.txt":   {Data: "one\n2\nthree\n", Mode: 0o644},
+		"bin":     {Dir: true, Mode: 0o755},
+		"bin/run": {Data: "x\n", Mode: 0o644},
+		"c.txt":   {Data: "c", Mode: 0o600},
+	}
+
+	assert.Empty(t, tu.DiffTree(want, want))
+
+	diff := tu.DiffTree(want, got)
+	assert.Contains(t, diff, "missing: b.txt\n")
+	assert.Contains(t, diff, "extra: c.txt\n")
+	assert.Contains(t, diff, "changed: a.txt, bin/run\n")
+	assert.Contains(t, diff, "--- want\n+++ got\n")
+	assert.Contains(t, diff, " one\n-two\n+2\n three\n")
+	assert.Contains(t, diff, "--- bin/run mode=0755 --\n+-- bin/run mode=0644 --\n")
+	assert.Contains(t, diff, "+-- c.txt --\n+c\n+\\ No newline at end of file\n")
+	assert.NotContains(t, diff, "bin/ ")
+}
+
+// TestDiffTree_LargeFiles verifies that large files are diffed around the
+// changed region only and that a diff too large to compute is summarized.
+func TestDiffTree_LargeFiles(t *testing.T) {
+	t.Parallel()
+
+	lines := func(n int, format string) string {
+		var sb strings.Builder
+		for i := range n {
+			fmt.Fprintf(&sb, format+"\n", i)
+		}
+		return sb.String()
+	}
+	big := lines(5000, "line %d")
+
+	edited := strings.Replace(big, "line 2500\n", "edited\n", 1)
+	diff := tu.DiffTree(tu.Tree{"a.txt": {Data: big}}, tu.Tree{"a.txt": {Data: edited}})
+	assert.Contains(t, diff, "@@ -2499,7 +2499,7 @@\n line 2497\n line 2498\n line 2499\n-line 2500\n+edited\n")
+
+	diff = tu.DiffTree(
+		tu.Tree{"a.txt": {Data: big}},
+		tu.Tree{"a.txt": {Data: lines(5000, "other %d")}},
+	)
+	assert.Contains(t, diff, "changed: a.txt\n")
+	assert.Contains(t, diff, "(diff omitted: lines 2-5001 of want and 2-5001 of got differ)\n")
+}
+
+// TestSandbox_WithTxtar verifies that inline archives are materialized with
+// modes, symlinks and empty directories.
+func TestSandbox_WithTxtar(t *testing.T) {
+	t.Parallel()
+
+	archive := `
+-- README.md --
+# out
+-- bin/run mode=0755 --
+#!/bin/sh
+-- cache/ --
+-- latest -> README.md --
+-- secret mode=0600 --
+s3cr3t
+`
+	for name, inMemory := range map[string]bool{"jail": false, "in-memory": true} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			sandbox := tu.NewSandbox(t, &tu.SandboxOptions{InMemory: inMemory},
+				tu.WithTxtar(archive, "~/out"))
+
+			want, err := tu.TreeFromTxtar([]byte(archive))
+			require.NoError(t, err)
+			sandbox.AssertTree("~/out", want)
+			assert.Equal(t, "# out\n", string(sandbox.MustReadFile("~/out/latest")))
+			sandbox.DumpTxtar("~/out")
+		})
+	}
+}
+
+// TestSandbox_WithFiles verifies that literal maps are written to sandbox
+// paths.
+func TestSandbox_WithFiles(t *testing.T) {
+	t.Parallel()
+
+	sandbox := tu.NewSandbox(t, nil, tu.WithFiles(map[string]string{
+		"~/app/config.yaml":         "name: demo\n",
+		"~/app/bin/run mode=0755":   "#!/bin/sh\n",
+		"~/app/current -> releases": "",
+		"~/app/releases/":           "",
+		"/etc/app.conf":             "global\n",
+	}))
+
+	sandbox.AssertTree("~/app", tu.Tree{
+		"config.yaml": {Data: "name: demo\n", Mode: 0o644},
+		"bin/run":     {Data: "#!/bin/sh\n", Mode: 0o755},
+		"current":     {Link: "releases"},
+		"releases":    {Dir: true, Mode: 0o755},
+	})
+	assert.Equal(t, "global\n", string(sandbox.MustReadFile("/etc/app.conf")))
+}
@@ -0,0 +1,89 @@
+package sandbox
+
+import (
+	"bytes"
+	"strings"
+)
+
+// txtarFile is a single file in a txtar archive.
+type txtarFile struct {
+	Name string
+	Data []byte
+}
+
+// txtarArchive is a parsed txtar archive: a free form comment followed by a
+// sequence of files, each introduced by a "-- name --" marker line. The
+// format matches golang.org/x/tools/txtar.
+type txtarArchive struct {
+	Comment []byte
+	Files   []txtarFile
+}
+
+// parseTxtar parses data as a txtar archive. Parsing never fails; text
+// before the first marker is the comment.
+func parseTxtar(data []byte) *txtarArchive {
+	a := &txtarArchive{}
+	var name string
+	a.Comment, name, data = findTxtarMarker(data)
+	for name != "" {
+		f := txtarFile{Name: name}
+		f.Data, name, data = findTxtarMarker(data)
+		a.Files = append(a.Files, f)
+	}
+	return a
+}
+
+// findTxtarMarker returns the data before the next marker line, the name in
+// that marker and the data after it. name is empty when there is no marker.
+func findTxtarMarker(data []byte) (before []byte, name string, after []byte) {
+	var i int
+	for {
+		if n, ok := txtarMarkerName(data[i:]); ok {
+			end := bytes.IndexByte(data[i:], '\n')
+			if end < 0 {
+				return data[:i], n, nil
+			}
+			return data[:i], n, data[i+end+1:]
+		}
+		j := bytes.IndexByte(data[i:], '\n')
+		if j < 0 {
+			return fixTxtarNL(data), "", nil
+		}
+		i += j + 1
+	}
+}
+
+// txtarMarkerName reports whether line starts with a marker and returns the
+// file name it holds.
+func txtarMarkerName(line []byte) (string, bool) {
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	s := string(line)
+	if !strings.HasPrefix(s, "-- ") || !strings.HasSuffix(s, " --") || len(s) < 7 {
+		return "", false
+	}
+	name := strings.TrimSpace(s[3 : len(s)-3])
+	return name, name != ""
+}
+
+// fixTxtarNL adds a final newline to non-empty data that lacks one.
+func fixTxtarNL(data []byte) []byte {
+	if len(data) == 0 || data[len(data)-1] == '\n' {
+		return data
+	}
+	return append(bytes.Clone(data), '\n')
+}
+
+// format returns the textual form of the archive. Files whose data does not
+// end in a newline gain one, as in the reference implementation.
+func (a *txtarArchive) format() []byte {
+	var buf bytes.Buffer
+	buf.Write(fixTxtarNL(a.Comment))
+	for _, f := range a.Files {
+		buf.WriteString("-- " + f.Name + " --\n")
+		buf.Write(fixTxtarNL(f.Data))
+	}
+	return buf.Bytes()
+}
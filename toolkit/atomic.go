@@ -0,0 +1,151 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+// AtomicWriteOptions tunes AtomicWriteFileWithOptions. A nil value selects
+// the defaults used by AtomicWriteFile.
+type AtomicWriteOptions struct {
+	// ForcePerm applies perm even when the target already exists. By
+	// default an existing target keeps its mode and, where the platform
+	// allows it, its owner; perm is only used for new files.
+	ForcePerm bool
+
+	// BackupSuffix, when non-empty, keeps the previous version of an
+	// existing target next to it under the target name with the suffix
+	// appended, for example "~" or ".bak". An older backup is replaced.
+	BackupSuffix string
+}
+
+// atomicWriteFile durably replaces the file at path on the real filesystem.
+//
+// The data is written to a temporary file in the target directory, so the
+// final rename never crosses a filesystem boundary, and the temporary file
+// is fsynced before the rename and the directory after it. A symlink at
+// path is expected to have been resolved by the caller.
+func atomicWriteFile(path string, data []byte, perm os.FileMode, opts *AtomicWriteOptions) error {
+	if opts == nil {
+		opts = &AtomicWriteOptions{}
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("atomic write: mkdirall %q: %w", dir, err)
+	}
+
+	mode := perm.Perm()
+	existing, err := os.Stat(path)
+	switch {
+	case err == nil && existing.IsDir():
+		return &fs.PathError{Op: "atomic write", Path: path, Err: syscall.EISDIR}
+	case err == nil:
+		if !opts.ForcePerm {
+			mode = existing.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		existing = nil
+	default:
+		return fmt.Errorf("atomic write: stat %q: %w", path, err)
+	}
+
+	tmpFile, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("atomic write: create temp file: %w", err)
+	}
+	tmpName := tmpFile.Name()
+	renamed := false
+	defer func() {
+		if !renamed {
+			_ = os.Remove(tmpName)
+		}
+	}()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("atomic write: write temp file %q: %w", tmpName, err)
+	}
+	// Chown before chmod: changing the owner clears the setuid and setgid
+	// bits on Linux.
+	if existing != nil && !opts.ForcePerm {
+		if err := chownLike(tmpFile, existing); err != nil {
+			_ = tmpFile.Close()
+			return fmt.Errorf("atomic write: chown temp file %q: %w", tmpName, err)
+		}
+	}
+	if err := tmpFile.Chmod(mode); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("atomic write: chmod temp file %q: %w", tmpName, err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("atomic write: sync temp file %q: %w", tmpName, err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("atomic write: close temp file %q: %w", tmpName, err)
+	}
+
+	if existing != nil && opts.BackupSuffix != "" {
+		if err := backupFile(path, path+opts.BackupSuffix); err != nil {
+			return fmt.Errorf("atomic write: backup %q: %w", path, err)
+		}
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("atomic write: rename %q -> %q: %w", tmpName, path, err)
+	}
+	renamed = true
+
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("atomic write: sync dir %q: %w", dir, err)
+	}
+	return nil
+}
+
+// backupFile preserves the current contents of path at backup. A hard link
+// is used when possible so the backup costs no extra space; otherwise the
+// file is copied.
+func backupFile(path, backup string) error {
+	if err := os.Remove(backup); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Link(path, backup); err == nil {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(backup, data, info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Chmod(backup, info.Mode().Perm())
+}
+
+// syncDir flushes the directory entry changes made in dir to stable
+// storage. Filesystems and platforms that cannot sync directories are
+// ignored.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTSUP) {
+		return err
+	}
+	return nil
+}
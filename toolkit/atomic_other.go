@@ -0,0 +1,13 @@
+//go:build !unix
+
+package toolkit
+
+import (
+	"io/fs"
+	"os"
+)
+
+// chownLike is a no-op on platforms without Unix file ownership.
+func chownLike(f *os.File, info fs.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,132 @@
+package toolkit_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAtomicWriteFilePreservesMode(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permission bits are not supported on windows")
+	}
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			env := newEnv(t)
+			ctx := toolkit.WithEnv(t.Context(), env)
+
+			require.NoError(t, toolkit.AtomicWriteFile(ctx, "~/state.json", []byte("v1"), 0o600))
+			info, err := env.Stat("~/state.json", false)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+			// An existing file keeps its mode by default.
+			require.NoError(t, toolkit.AtomicWriteFile(ctx, "~/state.json", []byte("v2"), 0o644))
+			info, err = env.Stat("~/state.json", false)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+			require.NoError(t, toolkit.AtomicWriteFileWithOptions(ctx, "~/state.json", []byte("v3"), 0o644,
+				&toolkit.AtomicWriteOptions{ForcePerm: true}))
+			info, err = env.Stat("~/state.json", false)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+		})
+	}
+}
+
+// Replacing a setuid file owned by another user keeps both the owner and
+// the setuid bit, which a chown after the chmod would clear.
+func TestOsEnvAtomicWriteFilePreservesSetuid(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" || os.Geteuid() != 0 {
+		t.Skip("requires root on a unix system")
+	}
+
+	path := filepath.Join(t.TempDir(), "tool")
+	require.NoError(t, os.WriteFile(path, []byte("v1"), 0o755))
+	require.NoError(t, os.Chown(path, 65534, 65534))
+	require.NoError(t, os.Chmod(path, 0o755|fs.ModeSetuid|fs.ModeSetgid))
+
+	ctx := toolkit.WithEnv(t.Context(), &toolkit.OsEnv{})
+	require.NoError(t, toolkit.AtomicWriteFile(ctx, path, []byte("v2"), 0o644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, 0o755|fs.ModeSetuid|fs.ModeSetgid, info.Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid))
+}
+
+func TestAtomicWriteFileBackup(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			env := newEnv(t)
+			ctx := toolkit.WithEnv(t.Context(), env)
+			opts := &toolkit.AtomicWriteOptions{BackupSuffix: ".bak"}
+
+			// No backup is made when there is no previous version.
+			require.NoError(t, toolkit.AtomicWriteFileWithOptions(ctx, "~/cfg", []byte("one"), 0o644, opts))
+			_, err := env.Stat("~/cfg.bak", false)
+			require.ErrorIs(t, err, fs.ErrNotExist)
+
+			require.NoError(t, toolkit.AtomicWriteFileWithOptions(ctx, "~/cfg", []byte("two"), 0o644, opts))
+			require.NoError(t, toolkit.AtomicWriteFileWithOptions(ctx, "~/cfg", []byte("three"), 0o644, opts))
+
+			data, err := env.ReadFile("~/cfg")
+			require.NoError(t, err)
+			assert.Equal(t, "three", string(data))
+			data, err = env.ReadFile("~/cfg.bak")
+			require.NoError(t, err)
+			assert.Equal(t, "two", string(data))
+
+			// Temporary files never outlive the write.
+			entries, err := env.ReadDir("~")
+			require.NoError(t, err)
+			var names []string
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			assert.ElementsMatch(t, []string{"cfg", "cfg.bak"}, names)
+		})
+	}
+}
+
+func TestOsEnvAtomicWriteFileFollowsSymlink(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on windows")
+	}
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "real.txt")
+	link := filepath.Join(dir, "link.txt")
+	require.NoError(t, os.WriteFile(target, []byte("old"), 0o640))
+	require.NoError(t, os.Symlink(target, link))
+
+	env := &toolkit.OsEnv{}
+	require.NoError(t, env.AtomicWriteFile(link, []byte("new"), 0o644))
+
+	info, err := os.Lstat(link)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&fs.ModeSymlink, "link must not be replaced")
+	data, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+	info, err = os.Stat(target)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
@@ -0,0 +1,282 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+)
+
+// CopyOptions controls how Copy, CopyTree, CopyTreeBetween and CopyFS copy
+// files. The zero value copies permissions and symlinks as they are and
+// refuses to replace existing files.
+type CopyOptions struct {
+	// Overwrite replaces existing files and symlinks at the destination.
+	// When false an existing destination is an error wrapping fs.ErrExist.
+	// Existing directories are always merged into.
+	Overwrite bool
+
+	// FollowSymlinks copies the targets of symlinks instead of recreating
+	// the links. Sources that cannot report symlinks are always followed.
+	FollowSymlinks bool
+
+	// PreserveTimes copies modification times to the destination.
+	PreserveTimes bool
+
+	// FileMode, when non-zero, is used for copied files instead of the
+	// source permissions.
+	FileMode os.FileMode
+
+	// DirMode, when non-zero, is used for created directories instead of the
+	// source permissions.
+	DirMode os.FileMode
+}
+
+// Copy copies the file or symlink at src to dst using the Env stored in ctx.
+// Directories are rejected; use CopyTree to copy them. Permission bits are
+// preserved and missing parent directories of dst are created.
+func Copy(ctx context.Context, src, dst string, opts *CopyOptions) error {
+	env := EnvFromContext(ctx)
+	err := copyWithin(env, src, dst, opts, false)
+	logCopy(ctx, "Copy", env, src, dst, err)
+	return err
+}
+
+// CopyTree recursively copies the file or directory at src to dst using the
+// Env stored in ctx. Permission bits and symlinks are preserved unless opts
+// says otherwise. Copying a directory into itself is rejected with an error
+// wrapping fs.ErrInvalid.
+func CopyTree(ctx context.Context, src, dst string, opts *CopyOptions) error {
+	env := EnvFromContext(ctx)
+	err := copyWithin(env, src, dst, opts, true)
+	logCopy(ctx, "CopyTree", env, src, dst, err)
+	return err
+}
+
+// CopyTreeBetween recursively copies src in srcEnv to dst in dstEnv. It is
+// the cross-Env form of CopyTree and can be used to export a sandbox tree to
+// disk or to seed a MemEnv from a directory on disk.
+func CopyTreeBetween(ctx context.Context, srcEnv Env, src string, dstEnv Env, dst string, opts *CopyOptions) error {
+	err := copyFS(dstEnv, NewFS(srcEnv, src), ".", dst, opts)
+	logCopy(ctx, "CopyTreeBetween", dstEnv, src, dst, err,
+		slog.String("srcEnvType", srcEnv.Name()))
+	return err
+}
+
+// CopyFS recursively copies the file or directory named src in fsys to dst
+// using the Env stored in ctx. src is an io/fs name such as "data/fixture".
+// Symlinks are recreated when fsys implements fs.ReadLinkFS, which EnvFS
+// does, so fixtures held in an embed.FS or another Env can be copied alike.
+func CopyFS(ctx context.Context, fsys fs.FS, src, dst string, opts *CopyOptions) error {
+	env := EnvFromContext(ctx)
+	err := copyFS(env, fsys, src, dst, opts)
+	logCopy(ctx, "CopyFS", env, src, dst, err)
+	return err
+}
+
+func logCopy(ctx context.Context, op string, env Env, src, dst string, err error, attrs ...slog.Attr) {
+	lg := getTookitLogger(ctx)
+	base := []slog.Attr{
+		slog.String("envType", env.Name()),
+		slog.String("pwd", env.Get("PWD")),
+		slog.String("src", src),
+		slog.String("dst", dst),
+	}
+	attrs = append(base, attrs...)
+	if err != nil {
+		lg.LogAttrs(ctx, slog.LevelError, op+" failed",
+			append(attrs, slog.Any("error", err))...)
+		return
+	}
+	lg.LogAttrs(ctx, slog.LevelDebug, op+" success", attrs...)
+}
+
+// copyWithin copies src to dst inside a single Env.
+func copyWithin(env Env, src, dst string, opts *CopyOptions, tree bool) error {
+	srcPath, err := env.ResolvePath(src, false)
+	if err != nil {
+		return err
+	}
+	dstPath, err := env.ResolvePath(dst, false)
+	if err != nil {
+		return err
+	}
+
+	info, err := env.Stat(srcPath, opts != nil && opts.FollowSymlinks)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if !tree {
+			return &fs.PathError{Op: "copy", Path: src, Err: syscall.EISDIR}
+		}
+		if rel, err := filepath.Rel(srcPath, dstPath); err == nil && !escapesRoot(rel) {
+			return fmt.Errorf("copy %s into itself: %w", src, fs.ErrInvalid)
+		}
+	}
+
+	return copyFS(env, NewFS(env, srcPath), ".", dstPath, opts)
+}
+
+// copyFS copies name from fsys to dst in env.
+func copyFS(env Env, fsys fs.FS, name, dst string, opts *CopyOptions) error {
+	c := &copier{env: env, fsys: fsys, ancestors: make(map[string]bool)}
+	if opts != nil {
+		c.opts = *opts
+	}
+	return c.copy(name, dst, 0)
+}
+
+// copier holds the state of a single copy operation.
+type copier struct {
+	env  Env
+	fsys fs.FS
+	opts CopyOptions
+
+	// ancestors holds the resolved paths of the directories currently being
+	// copied. It is only populated when following symlinks from an EnvFS.
+	ancestors map[string]bool
+}
+
+// copy copies name to dst. When following symlinks, a directory that is
+// one of its own ancestors is reported as ErrSymlinkLoop. Sources other
+// than EnvFS cannot resolve paths, so for them links counts the directory
+// symlinks followed on the way to name instead.
+func (c *copier) copy(name, dst string, links int) error {
+	info, err := c.stat(name)
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := fs.ReadLink(c.fsys, name)
+		if err != nil {
+			return err
+		}
+		if err := c.prepare(dst, false); err != nil {
+			return err
+		}
+		if err := c.env.Mkdir(filepath.Dir(dst), 0o755, true); err != nil {
+			return err
+		}
+		return c.env.Symlink(target, dst)
+	}
+
+	if info.IsDir() {
+		if c.opts.FollowSymlinks {
+			if real, ok := c.realPath(name); ok {
+				if c.ancestors[real] {
+					return fmt.Errorf("copy %s: %w", name, ErrSymlinkLoop)
+				}
+				c.ancestors[real] = true
+				defer delete(c.ancestors, real)
+			} else if linfo, err := fs.Lstat(c.fsys, name); err == nil && linfo.Mode()&fs.ModeSymlink != 0 {
+				links++
+				if links > maxSymlinkDepth {
+					return fmt.Errorf("copy %s: %w", name, ErrSymlinkLoop)
+				}
+			}
+		}
+		return c.copyDir(name, dst, info, links)
+	}
+	if !info.Mode().IsRegular() {
+		return &fs.PathError{Op: "copy", Path: name, Err: fmt.Errorf("unsupported file type %s", info.Mode().Type())}
+	}
+	return c.copyFile(name, dst, info)
+}
+
+// realPath returns the path name resolves to, following every symlink, when
+// the source is an EnvFS.
+func (c *copier) realPath(name string) (string, bool) {
+	f, ok := c.fsys.(*EnvFS)
+	if !ok {
+		return "", false
+	}
+	p, err := f.path("copy", name)
+	if err != nil {
+		return "", false
+	}
+	real, err := f.env.ResolvePath(p, true)
+	return real, err == nil
+}
+
+func (c *copier) stat(name string) (fs.FileInfo, error) {
+	if c.opts.FollowSymlinks {
+		return fs.Stat(c.fsys, name)
+	}
+	return fs.Lstat(c.fsys, name)
+}
+
+func (c *copier) copyDir(name, dst string, info fs.FileInfo, links int) error {
+	if err := c.prepare(dst, true); err != nil {
+		return err
+	}
+	perm := info.Mode().Perm()
+	if c.opts.DirMode != 0 {
+		perm = c.opts.DirMode.Perm()
+	}
+	if err := c.env.Mkdir(dst, perm, true); err != nil {
+		return err
+	}
+
+	entries, err := fs.ReadDir(c.fsys, name)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := c.copy(path.Join(name, e.Name()), filepath.Join(dst, e.Name()), links); err != nil {
+			return err
+		}
+	}
+
+	// Children update the directory mtime so it is restored last.
+	return c.chtimes(dst, info)
+}
+
+func (c *copier) copyFile(name, dst string, info fs.FileInfo) error {
+	if err := c.prepare(dst, false); err != nil {
+		return err
+	}
+	data, err := fs.ReadFile(c.fsys, name)
+	if err != nil {
+		return err
+	}
+	perm := info.Mode().Perm()
+	if c.opts.FileMode != 0 {
+		perm = c.opts.FileMode.Perm()
+	}
+	// AtomicWriteFile sets perm exactly rather than masking it with the
+	// umask, which keeps modes such as 0o777 intact.
+	if err := c.env.AtomicWriteFile(dst, data, perm); err != nil {
+		return err
+	}
+	return c.chtimes(dst, info)
+}
+
+// prepare checks the destination before it is written. Existing directories
+// are kept when a directory is copied over them; anything else is removed
+// when overwriting is enabled and reported as fs.ErrExist otherwise.
+func (c *copier) prepare(dst string, dir bool) error {
+	existing, err := c.env.Stat(dst, false)
+	if err != nil {
+		return nil
+	}
+	if dir && existing.IsDir() {
+		return nil
+	}
+	if !c.opts.Overwrite {
+		return &fs.PathError{Op: "copy", Path: dst, Err: fs.ErrExist}
+	}
+	return c.env.Remove(dst, false)
+}
+
+func (c *copier) chtimes(dst string, info fs.FileInfo) error {
+	if !c.opts.PreserveTimes {
+		return nil
+	}
+	return c.env.Chtimes(dst, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,188 @@
+package toolkit_test
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedCopyTree(t *testing.T, env toolkit.Env) context.Context {
+	t.Helper()
+	require.NoError(t, env.Mkdir("~/src/bin", 0o755, true))
+	require.NoError(t, env.AtomicWriteFile("~/src/bin/run.sh", []byte("#!/bin/sh\n"), 0o755))
+	require.NoError(t, env.AtomicWriteFile("~/src/secret", []byte("secret"), 0o600))
+	require.NoError(t, env.WriteFile("~/src/readme.md", []byte("readme"), 0o644))
+	require.NoError(t, env.Symlink("readme.md", "~/src/link.md"))
+	return toolkit.WithEnv(t.Context(), env)
+}
+
+func assertCopiedTree(t *testing.T, env toolkit.Env, dst string) {
+	t.Helper()
+	for name, want := range map[string]os.FileMode{
+		"bin/run.sh": 0o755,
+		"secret":     0o600,
+		"readme.md":  0o644,
+	} {
+		info, err := env.Stat(dst+"/"+name, false)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, info.Mode().Perm(), name)
+	}
+	data, err := env.ReadFile(dst + "/bin/run.sh")
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\n", string(data))
+
+	info, err := env.Stat(dst+"/link.md", false)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&fs.ModeSymlink, "symlink must be preserved")
+	target, err := toolkit.NewFS(env, dst).ReadLink("link.md")
+	require.NoError(t, err)
+	assert.Equal(t, "readme.md", target)
+	data, err = env.ReadFile(dst + "/link.md")
+	require.NoError(t, err)
+	assert.Equal(t, "readme", string(data))
+}
+
+func TestCopyTree(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			env := newEnv(t)
+			ctx := seedCopyTree(t, env)
+
+			require.NoError(t, toolkit.CopyTree(ctx, "~/src", "~/dst", nil))
+			assertCopiedTree(t, env, "~/dst")
+
+			// Existing files are not replaced unless asked to.
+			err := toolkit.CopyTree(ctx, "~/src", "~/dst", nil)
+			require.ErrorIs(t, err, fs.ErrExist)
+			require.NoError(t, env.WriteFile("~/src/readme.md", []byte("changed"), 0o644))
+			require.NoError(t, toolkit.CopyTree(ctx, "~/src", "~/dst",
+				&toolkit.CopyOptions{Overwrite: true}))
+			data, err := env.ReadFile("~/dst/link.md")
+			require.NoError(t, err)
+			assert.Equal(t, "changed", string(data))
+
+			err = toolkit.CopyTree(ctx, "~/src", "~/src/bin/nested", nil)
+			require.ErrorIs(t, err, fs.ErrInvalid)
+		})
+	}
+}
+
+func TestCopy(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			env := newEnv(t)
+			ctx := seedCopyTree(t, env)
+
+			require.NoError(t, toolkit.Copy(ctx, "~/src/secret", "~/out/secret", nil))
+			info, err := env.Stat("~/out/secret", false)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+			// Following links copies the target contents.
+			require.NoError(t, toolkit.Copy(ctx, "~/src/link.md", "~/out/link.md",
+				&toolkit.CopyOptions{FollowSymlinks: true}))
+			info, err = env.Stat("~/out/link.md", false)
+			require.NoError(t, err)
+			assert.True(t, info.Mode().IsRegular())
+
+			// A link copied into a new directory creates the parents.
+			require.NoError(t, toolkit.Copy(ctx, "~/src/link.md", "~/out/links/nested/link.md", nil))
+			target, err := env.Readlink("~/out/links/nested/link.md")
+			require.NoError(t, err)
+			assert.Equal(t, "readme.md", target)
+
+			err = toolkit.Copy(ctx, "~/src", "~/out/src", nil)
+			require.Error(t, err)
+
+			// Modification times are carried over on request.
+			mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			require.NoError(t, toolkit.Chtimes(ctx, "~/src/readme.md", mtime, mtime))
+			require.NoError(t, toolkit.Copy(ctx, "~/src/readme.md", "~/out/readme.md",
+				&toolkit.CopyOptions{PreserveTimes: true}))
+			info, err = env.Stat("~/out/readme.md", false)
+			require.NoError(t, err)
+			assert.True(t, mtime.Equal(info.ModTime()))
+		})
+	}
+}
+
+func TestCopyTreeSymlinkLoop(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			env := newEnv(t)
+			ctx := toolkit.WithEnv(t.Context(), env)
+			require.NoError(t, env.Mkdir("~/src", 0o755, true))
+			require.NoError(t, env.WriteFile("~/src/a.txt", []byte("a"), 0o644))
+			require.NoError(t, env.Symlink("../src", "~/src/loop"))
+
+			err := toolkit.CopyTree(ctx, "~/src", "~/out",
+				&toolkit.CopyOptions{FollowSymlinks: true})
+			require.ErrorIs(t, err, toolkit.ErrSymlinkLoop)
+
+			data, err := env.ReadFile("~/out/a.txt")
+			require.NoError(t, err)
+			assert.Equal(t, "a", string(data))
+			_, err = env.Stat("~/out/loop", false)
+			assert.ErrorIs(t, err, fs.ErrNotExist, "the tree is copied only once")
+		})
+	}
+}
+
+func TestCopyTreeBetween(t *testing.T) {
+	t.Parallel()
+
+	mem := toolkit.NewMemEnv(nil, "", "")
+	ctx := seedCopyTree(t, mem)
+	disk := toolkit.NewTestEnv(t.TempDir(), "", "")
+
+	require.NoError(t, toolkit.CopyTreeBetween(ctx, mem, "~/src", disk, "~/export", nil))
+	assertCopiedTree(t, disk, "~/export")
+
+	back := toolkit.NewMemEnv(nil, "", "")
+	require.NoError(t, toolkit.CopyTreeBetween(ctx, disk, "~/export", back, "/restored", nil))
+	assertCopiedTree(t, back, "/restored")
+}
+
+func TestCopyFS(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"fixture/config.yaml":   {Data: []byte("a: 1\n"), Mode: 0o444},
+		"fixture/nested/run.sh": {Data: []byte("echo\n"), Mode: 0o555},
+		"fixture/alias":         {Data: []byte("config.yaml"), Mode: fs.ModeSymlink},
+	}
+	env := toolkit.NewMemEnv(nil, "", "")
+	ctx := toolkit.WithEnv(t.Context(), env)
+
+	require.NoError(t, toolkit.CopyFS(ctx, fsys, "fixture", "~/app", nil))
+	info, err := env.Stat("~/app/nested/run.sh", false)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o555), info.Mode().Perm())
+	data, err := env.ReadFile("~/app/alias")
+	require.NoError(t, err)
+	assert.Equal(t, "a: 1\n", string(data))
+
+	require.NoError(t, toolkit.CopyFS(ctx, fsys, "fixture", "~/app", &toolkit.CopyOptions{
+		Overwrite: true,
+		FileMode:  0o644,
+	}))
+	info, err = env.Stat("~/app/config.yaml", false)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+}
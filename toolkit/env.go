@@ -6,6 +6,8 @@ import (
 	"os"
 	"sort"
 	"strings"
+
+	"github.com/jlrickert/cli-toolkit/clock"
 )
 
 // Env is a compact interface for reading and modifying environment
@@ -160,8 +162,14 @@ var (
 )
 
 // WithEnv returns a copy of ctx that carries env. Use this to inject a test
-// environment into code under test.
+// environment into code under test. The clock package reads TZ from env, so
+// clock.Location follows it.
 func WithEnv(ctx context.Context, env Env) context.Context {
+	if env != nil {
+		ctx = clock.WithLookupEnv(ctx, func(key string) (string, bool) {
+			return env.Get(key), env.Has(key)
+		})
+	}
 	return context.WithValue(ctx, ctxEnvKey, env)
 }
 
@@ -0,0 +1,291 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// PlanOp names the kind of mutation recorded by a DryRunEnv.
+type PlanOp string
+
+const (
+	PlanWrite   PlanOp = "write"
+	PlanMkdir   PlanOp = "mkdir"
+	PlanRemove  PlanOp = "remove"
+	PlanRename  PlanOp = "rename"
+	PlanSymlink PlanOp = "symlink"
+	PlanChmod   PlanOp = "chmod"
+	PlanChown   PlanOp = "chown"
+	PlanChtimes PlanOp = "chtimes"
+	PlanSet     PlanOp = "set"
+	PlanUnset   PlanOp = "unset"
+)
+
+// PlanStep is a single mutation a DryRunEnv skipped. Only the fields that
+// apply to Op are set.
+type PlanStep struct {
+	Op PlanOp
+	// Path is the absolute path the operation applies to.
+	Path string
+	// Target is the rename destination or the symlink target.
+	Target string
+	// Mode is the requested permission for writes, mkdir and chmod.
+	Mode os.FileMode
+	// Size is the number of bytes written, or -1 for writes made through
+	// an open file.
+	Size int
+	// All is set for recursive mkdir and remove.
+	All bool
+	// Key and Value describe environment variable changes.
+	Key   string
+	Value string
+}
+
+// String formats the step as a single shell-like line.
+func (s PlanStep) String() string {
+	switch s.Op {
+	case PlanWrite:
+		if s.Size < 0 {
+			return fmt.Sprintf("write %s (%#o)", s.Path, s.Mode)
+		}
+		return fmt.Sprintf("write %s (%d bytes, %#o)", s.Path, s.Size, s.Mode)
+	case PlanMkdir:
+		if s.All {
+			return fmt.Sprintf("mkdir -p %s (%#o)", s.Path, s.Mode)
+		}
+		return fmt.Sprintf("mkdir %s (%#o)", s.Path, s.Mode)
+	case PlanRemove:
+		if s.All {
+			return "remove -r " + s.Path
+		}
+		return "remove " + s.Path
+	case PlanRename:
+		return fmt.Sprintf("rename %s -> %s", s.Path, s.Target)
+	case PlanSymlink:
+		return fmt.Sprintf("symlink %s -> %s", s.Path, s.Target)
+	case PlanChmod:
+		return fmt.Sprintf("chmod %#o %s", s.Mode, s.Path)
+	case PlanChown:
+		return fmt.Sprintf("chown %s %s", s.Value, s.Path)
+	case PlanChtimes:
+		return fmt.Sprintf("chtimes %s %s", s.Value, s.Path)
+	case PlanSet:
+		return fmt.Sprintf("set %s=%s", s.Key, s.Value)
+	case PlanUnset:
+		return "unset " + s.Key
+	default:
+		return fmt.Sprintf("%s %s", s.Op, s.Path)
+	}
+}
+
+// DryRunEnv wraps an Env so that reads go through to it while every
+// mutation is recorded in a plan instead of being performed. The skipped
+// changes are kept in an OverlayEnv, so later reads through the DryRunEnv
+// observe them just as they would after a real run.
+//
+// Mutations that would fail are reported as errors and not recorded.
+type DryRunEnv struct {
+	envVars
+
+	overlay *OverlayEnv
+	locks   *lockTable
+
+	mu   sync.Mutex
+	plan []PlanStep
+}
+
+// NewDryRunEnv returns a DryRunEnv that never modifies base.
+func NewDryRunEnv(base Env) *DryRunEnv {
+	overlay := NewOverlayEnv(base, nil)
+	return &DryRunEnv{
+		envVars: envVars{env: overlay},
+		overlay: overlay,
+		locks:   newLockTable(),
+	}
+}
+
+func (d *DryRunEnv) Name() string {
+	return "dry-run-env"
+}
+
+// Unwrap returns the Env the dry run reads from and never modifies.
+func (d *DryRunEnv) Unwrap() Env {
+	return d.overlay.Lower()
+}
+
+// Plan returns a copy of the recorded steps in the order they were made.
+func (d *DryRunEnv) Plan() []PlanStep {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.plan)
+}
+
+// WritePlan writes the recorded steps to w, one per line.
+func (d *DryRunEnv) WritePlan(w io.Writer) error {
+	for _, s := range d.Plan() {
+		if _, err := fmt.Fprintln(w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrintPlan writes the recorded steps to the output stream carried by ctx.
+func (d *DryRunEnv) PrintPlan(ctx context.Context) error {
+	return d.WritePlan(StreamFromContext(ctx).Out)
+}
+
+// record appends s to the plan when err is nil and returns err.
+func (d *DryRunEnv) record(s PlanStep, err error) error {
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.plan = append(d.plan, s)
+	return nil
+}
+
+// path returns the absolute form of rel for use in a PlanStep.
+func (d *DryRunEnv) path(rel string) string {
+	p, err := d.overlay.ResolvePath(rel, false)
+	if err != nil {
+		return rel
+	}
+	return p
+}
+
+func (d *DryRunEnv) Set(key, value string) error {
+	return d.record(PlanStep{Op: PlanSet, Key: key, Value: value}, d.overlay.Set(key, value))
+}
+
+func (d *DryRunEnv) Unset(key string) {
+	d.overlay.Unset(key)
+	_ = d.record(PlanStep{Op: PlanUnset, Key: key}, nil)
+}
+
+func (d *DryRunEnv) SetHome(home string) error {
+	return d.record(PlanStep{Op: PlanSet, Key: "HOME", Value: home}, d.overlay.SetHome(home))
+}
+
+func (d *DryRunEnv) SetUser(user string) error {
+	return d.record(PlanStep{Op: PlanSet, Key: "USER", Value: user}, d.overlay.SetUser(user))
+}
+
+func (d *DryRunEnv) ResolvePath(rel string, follow bool) (string, error) {
+	return d.overlay.ResolvePath(rel, follow)
+}
+
+func (d *DryRunEnv) ReadFile(rel string) ([]byte, error) {
+	return d.overlay.ReadFile(rel)
+}
+
+func (d *DryRunEnv) WriteFile(rel string, data []byte, perm os.FileMode) error {
+	return d.record(PlanStep{Op: PlanWrite, Path: d.path(rel), Mode: perm, Size: len(data)},
+		d.overlay.WriteFile(rel, data, perm))
+}
+
+func (d *DryRunEnv) AtomicWriteFile(rel string, data []byte, perm os.FileMode) error {
+	return d.AtomicWriteFileWithOptions(rel, data, perm, nil)
+}
+
+func (d *DryRunEnv) AtomicWriteFileWithOptions(rel string, data []byte, perm os.FileMode, opts *AtomicWriteOptions) error {
+	return d.record(PlanStep{Op: PlanWrite, Path: d.path(rel), Mode: perm, Size: len(data)},
+		d.overlay.AtomicWriteFileWithOptions(rel, data, perm, opts))
+}
+
+// Mkdir records a step unless all is set and the directory already exists,
+// in which case nothing would change.
+func (d *DryRunEnv) Mkdir(rel string, perm os.FileMode, all bool) error {
+	if all {
+		if info, err := d.overlay.Stat(rel, true); err == nil && info.IsDir() {
+			return nil
+		}
+	}
+	return d.record(PlanStep{Op: PlanMkdir, Path: d.path(rel), Mode: perm, All: all},
+		d.overlay.Mkdir(rel, perm, all))
+}
+
+func (d *DryRunEnv) Remove(rel string, all bool) error {
+	return d.record(PlanStep{Op: PlanRemove, Path: d.path(rel), All: all},
+		d.overlay.Remove(rel, all))
+}
+
+func (d *DryRunEnv) Rename(src, dst string) error {
+	return d.record(PlanStep{Op: PlanRename, Path: d.path(src), Target: d.path(dst)},
+		d.overlay.Rename(src, dst))
+}
+
+func (d *DryRunEnv) Stat(name string, followSymlinks bool) (os.FileInfo, error) {
+	return d.overlay.Stat(name, followSymlinks)
+}
+
+func (d *DryRunEnv) Lstat(name string) (os.FileInfo, error) {
+	return d.overlay.Lstat(name)
+}
+
+func (d *DryRunEnv) ReadDir(rel string) ([]os.DirEntry, error) {
+	return d.overlay.ReadDir(rel)
+}
+
+func (d *DryRunEnv) Symlink(oldname, newname string) error {
+	return d.record(PlanStep{Op: PlanSymlink, Path: d.path(newname), Target: oldname},
+		d.overlay.Symlink(oldname, newname))
+}
+
+func (d *DryRunEnv) Readlink(name string) (string, error) {
+	return d.overlay.Readlink(name)
+}
+
+func (d *DryRunEnv) Chmod(name string, mode os.FileMode) error {
+	return d.record(PlanStep{Op: PlanChmod, Path: d.path(name), Mode: mode},
+		d.overlay.Chmod(name, mode))
+}
+
+func (d *DryRunEnv) Chown(name string, uid, gid int) error {
+	return d.record(PlanStep{Op: PlanChown, Path: d.path(name), Value: fmt.Sprintf("%d:%d", uid, gid)},
+		d.overlay.Chown(name, uid, gid))
+}
+
+func (d *DryRunEnv) Chtimes(name string, atime, mtime time.Time) error {
+	return d.record(PlanStep{Op: PlanChtimes, Path: d.path(name), Value: mtime.Format(time.RFC3339)},
+		d.overlay.Chtimes(name, atime, mtime))
+}
+
+func (d *DryRunEnv) Open(rel string) (File, error) {
+	return d.OpenFile(rel, os.O_RDONLY, 0)
+}
+
+func (d *DryRunEnv) Create(rel string) (File, error) {
+	return d.OpenFile(rel, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+// OpenFile records a write step when flag allows writing. The bytes written
+// through the returned file are kept in memory and not counted.
+func (d *DryRunEnv) OpenFile(rel string, flag int, perm os.FileMode) (File, error) {
+	f, err := d.overlay.OpenFile(rel, flag, perm)
+	if flag&openWriteFlags == 0 {
+		return f, err
+	}
+	return f, d.record(PlanStep{Op: PlanWrite, Path: d.path(rel), Mode: perm, Size: -1}, err)
+}
+
+// TryLock implements Locker with an in-process lock table so taking a lock
+// does not add lock files to the plan.
+func (d *DryRunEnv) TryLock(path string, shared bool) (func() error, error) {
+	resolved, err := d.overlay.ResolvePath(path, false)
+	if err != nil {
+		return nil, err
+	}
+	return d.locks.tryLock(resolved, shared)
+}
+
+var (
+	_ Env    = (*DryRunEnv)(nil)
+	_ Locker = (*DryRunEnv)(nil)
+)
@@ -0,0 +1,90 @@
+package toolkit_test
+
+import (
+	"bytes"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunEnv(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			base := newEnv(t)
+			require.NoError(t, base.Mkdir("~/app", 0o755, true))
+			require.NoError(t, base.WriteFile("~/app/old.txt", []byte("old"), 0o644))
+			require.NoError(t, base.Set("EDITOR", "vi"))
+
+			env := toolkit.NewDryRunEnv(base)
+			ctx := toolkit.WithEnv(t.Context(), env)
+			require.NoError(t, toolkit.Mkdir(ctx, "~/app/conf", 0o755, true))
+			require.NoError(t, toolkit.AtomicWriteFile(ctx, "~/app/conf/app.yaml", []byte("a: 1\n"), 0o600))
+			require.NoError(t, toolkit.Rename(ctx, "~/app/old.txt", "~/app/new.txt"))
+			require.NoError(t, toolkit.Symlink(ctx, "conf/app.yaml", "~/app/current"))
+			require.NoError(t, toolkit.Remove(ctx, "~/app/new.txt", false))
+			require.NoError(t, env.Set("EDITOR", "nano"))
+			env.Unset("PAGER")
+
+			// Failed operations are returned and not recorded.
+			err := toolkit.Remove(ctx, "~/app/missing", false)
+			require.ErrorIs(t, err, fs.ErrNotExist)
+
+			// Later reads see the planned state.
+			data, err := toolkit.ReadFile(ctx, "~/app/current")
+			require.NoError(t, err)
+			assert.Equal(t, "a: 1\n", string(data))
+			assert.Equal(t, "nano", env.Get("EDITOR"))
+
+			// Nothing reached the base.
+			_, err = base.Stat("~/app/conf", false)
+			require.ErrorIs(t, err, fs.ErrNotExist)
+			_, err = base.Stat("~/app/old.txt", false)
+			require.NoError(t, err)
+			assert.Equal(t, "vi", base.Get("EDITOR"))
+
+			assert.Equal(t, []toolkit.PlanStep{
+				{Op: toolkit.PlanMkdir, Path: "/home/testuser/app/conf", Mode: 0o755, All: true},
+				{Op: toolkit.PlanWrite, Path: "/home/testuser/app/conf/app.yaml", Mode: 0o600, Size: 5},
+				{Op: toolkit.PlanRename, Path: "/home/testuser/app/old.txt", Target: "/home/testuser/app/new.txt"},
+				{Op: toolkit.PlanSymlink, Path: "/home/testuser/app/current", Target: "conf/app.yaml"},
+				{Op: toolkit.PlanRemove, Path: "/home/testuser/app/new.txt"},
+				{Op: toolkit.PlanSet, Key: "EDITOR", Value: "nano"},
+				{Op: toolkit.PlanUnset, Key: "PAGER"},
+			}, env.Plan())
+		})
+	}
+}
+
+func TestDryRunEnvPrintPlan(t *testing.T) {
+	t.Parallel()
+
+	env := toolkit.NewDryRunEnv(toolkit.NewMemEnv(nil, "", ""))
+	var out bytes.Buffer
+	ctx := toolkit.WithStream(toolkit.WithEnv(t.Context(), env), &toolkit.Stream{Out: &out})
+
+	require.NoError(t, toolkit.WriteFile(ctx, "~/notes.txt", []byte("hi"), 0o644))
+	require.NoError(t, toolkit.Chmod(ctx, "~/notes.txt", 0o600))
+	mtime := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, toolkit.Chtimes(ctx, "~/notes.txt", mtime, mtime))
+	f, err := toolkit.Create(ctx, "~/log")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	lock, err := toolkit.Lock(ctx, "~/notes.txt", nil)
+	require.NoError(t, err)
+	require.NoError(t, lock.Unlock())
+
+	require.NoError(t, env.PrintPlan(ctx))
+	assert.Equal(t, `mkdir -p /home/testuser (0755)
+write /home/testuser/notes.txt (2 bytes, 0644)
+chmod 0600 /home/testuser/notes.txt
+chtimes 2025-01-02T03:04:05Z /home/testuser/notes.txt
+write /home/testuser/log (0666)
+`, out.String())
+}
@@ -0,0 +1,366 @@
+package toolkit
+
+import (
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+)
+
+// FaultRule describes a failure injected by a FaultEnv. A rule fires when
+// its Op and Path match a call and the Nth and Probability conditions hold.
+// When a rule fires, Latency is spent first, then Err or a short write is
+// injected. A rule with only Latency slows the call without failing it.
+type FaultRule struct {
+	// Op is the Env method the rule applies to: ReadFile, WriteFile,
+	// AtomicWriteFile, OpenFile, Mkdir, Remove, Rename, Stat, Lstat,
+	// ReadDir, Symlink, Readlink, Chmod, Chown or Chtimes. "Write" matches
+	// writes to files returned by OpenFile, Open and Create. Empty matches
+	// every operation.
+	Op string
+
+	// Path is a filepath.Match pattern. Patterns containing a separator are
+	// resolved like any other path, so "~/app/*.yaml" works, and matched
+	// against the absolute path. Other patterns match the base name. Empty
+	// matches every path. Rename is matched against its source.
+	Path string
+
+	// Nth fires the rule only on the nth matching call, counting from 1.
+	// Zero fires on every matching call.
+	Nth int
+
+	// Probability fires the rule with the given chance using the FaultEnv's
+	// seeded random source. Zero always fires.
+	Probability float64
+
+	// Err is returned from the call, wrapped in an *fs.PathError or
+	// *os.LinkError. It may be nil for rules that only add latency.
+	Err error
+
+	// ShortWrite makes WriteFile and file writes store only the first Limit
+	// bytes and fail with Err, or io.ErrShortWrite when Err is nil.
+	// AtomicWriteFile fails without changing the file.
+	ShortWrite bool
+	Limit      int
+
+	// Latency is spent before the call by sleeping on the clock. A clock
+	// with an Advance method, such as clock.TestClock, is advanced instead
+	// so the call does not wait for another goroutine to move time. Advancing
+	// fires every timer, ticker and deadline due on that clock, including
+	// ones unrelated to the call, so give the FaultEnv a clock of its own
+	// unless that is intended.
+	Latency time.Duration
+}
+
+// FaultOptions configures NewFaultEnv.
+type FaultOptions struct {
+	// Clock is used for latency. Defaults to the OS clock.
+	Clock clock.Clock
+	// Seed seeds the random source used for Probability.
+	Seed uint64
+	// Rules are checked in order and the first one that fires is used.
+	Rules []FaultRule
+}
+
+// FaultEnv wraps an Env and injects errors, short writes and latency
+// according to a list of rules, for exercising error handling paths. Calls
+// that no rule fires for go straight to the wrapped Env. FaultEnv is safe
+// for concurrent use.
+type FaultEnv struct {
+	envVars
+
+	clock clock.Clock
+
+	mu    sync.Mutex
+	rng   *rand.Rand
+	rules []*faultState
+}
+
+// faultState tracks the number of calls a rule has matched.
+type faultState struct {
+	FaultRule
+	calls int
+}
+
+// NewFaultEnv returns a FaultEnv wrapping env.
+func NewFaultEnv(env Env, opts *FaultOptions) *FaultEnv {
+	if opts == nil {
+		opts = &FaultOptions{}
+	}
+	clk := opts.Clock
+	if clk == nil {
+		clk = &clock.OsClock{}
+	}
+	f := &FaultEnv{
+		envVars: envVars{env: env},
+		clock:   clk,
+		rng:     rand.New(rand.NewPCG(opts.Seed, opts.Seed)),
+	}
+	for _, r := range opts.Rules {
+		f.AddRule(r)
+	}
+	return f
+}
+
+func (f *FaultEnv) Name() string {
+	return "fault-env"
+}
+
+// Unwrap returns the wrapped Env.
+func (f *FaultEnv) Unwrap() Env {
+	return f.env
+}
+
+// AddRule appends r to the rules checked by later calls.
+func (f *FaultEnv) AddRule(r FaultRule) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, &faultState{FaultRule: r})
+}
+
+// ClearRules removes every rule so later calls are passed through.
+func (f *FaultEnv) ClearRules() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = nil
+}
+
+// check finds the first rule that fires for op on rel, spends its latency
+// and returns it. It returns nil when no rule fires.
+func (f *FaultEnv) check(op, rel string) *FaultRule {
+	path, err := f.env.ResolvePath(rel, false)
+	if err != nil {
+		path = rel
+	}
+
+	f.mu.Lock()
+	var fired *FaultRule
+	for _, r := range f.rules {
+		if !f.matches(r, op, path) {
+			continue
+		}
+		r.calls++
+		if r.Nth > 0 && r.calls != r.Nth {
+			continue
+		}
+		if r.Probability > 0 && f.rng.Float64() >= r.Probability {
+			continue
+		}
+		rule := r.FaultRule
+		fired = &rule
+		break
+	}
+	f.mu.Unlock()
+
+	if fired != nil && fired.Latency > 0 {
+		if adv, ok := f.clock.(interface{ Advance(time.Duration) }); ok {
+			adv.Advance(fired.Latency)
+		} else {
+			f.clock.Sleep(fired.Latency)
+		}
+	}
+	return fired
+}
+
+func (f *FaultEnv) matches(r *faultState, op, path string) bool {
+	if r.Op != "" && r.Op != op {
+		return false
+	}
+	if r.Path == "" {
+		return true
+	}
+	pattern, name := r.Path, filepath.Base(path)
+	if strings.ContainsRune(pattern, filepath.Separator) || strings.HasPrefix(pattern, "~") {
+		if p, err := f.env.ResolvePath(pattern, false); err == nil {
+			pattern = p
+		}
+		name = path
+	}
+	ok, err := filepath.Match(pattern, name)
+	return err == nil && ok
+}
+
+// fail returns the error injected for op on rel, if any.
+func (f *FaultEnv) fail(op, rel string) error {
+	if r := f.check(op, rel); r != nil && r.Err != nil {
+		return &fs.PathError{Op: op, Path: rel, Err: r.Err}
+	}
+	return nil
+}
+
+// shortWriteErr returns the error reported for a short write by r.
+func shortWriteErr(r *FaultRule) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	return io.ErrShortWrite
+}
+
+func (f *FaultEnv) ResolvePath(rel string, follow bool) (string, error) {
+	return f.env.ResolvePath(rel, follow)
+}
+
+func (f *FaultEnv) ReadFile(rel string) ([]byte, error) {
+	if err := f.fail("ReadFile", rel); err != nil {
+		return nil, err
+	}
+	return f.env.ReadFile(rel)
+}
+
+// WriteFile stores a prefix of data and fails when a short write rule fires.
+func (f *FaultEnv) WriteFile(rel string, data []byte, perm os.FileMode) error {
+	r := f.check("WriteFile", rel)
+	switch {
+	case r != nil && r.ShortWrite:
+		if err := f.env.WriteFile(rel, data[:min(r.Limit, len(data))], perm); err != nil {
+			return err
+		}
+		return &fs.PathError{Op: "WriteFile", Path: rel, Err: shortWriteErr(r)}
+	case r != nil && r.Err != nil:
+		return &fs.PathError{Op: "WriteFile", Path: rel, Err: r.Err}
+	}
+	return f.env.WriteFile(rel, data, perm)
+}
+
+func (f *FaultEnv) AtomicWriteFile(rel string, data []byte, perm os.FileMode) error {
+	return f.AtomicWriteFileWithOptions(rel, data, perm, nil)
+}
+
+// AtomicWriteFileWithOptions leaves the file untouched when a rule fires,
+// as a failed atomic write would.
+func (f *FaultEnv) AtomicWriteFileWithOptions(rel string, data []byte, perm os.FileMode, opts *AtomicWriteOptions) error {
+	if r := f.check("AtomicWriteFile", rel); r != nil && (r.ShortWrite || r.Err != nil) {
+		err := r.Err
+		if r.ShortWrite {
+			err = shortWriteErr(r)
+		}
+		return &fs.PathError{Op: "AtomicWriteFile", Path: rel, Err: err}
+	}
+	return f.env.AtomicWriteFileWithOptions(rel, data, perm, opts)
+}
+
+func (f *FaultEnv) Mkdir(rel string, perm os.FileMode, all bool) error {
+	if err := f.fail("Mkdir", rel); err != nil {
+		return err
+	}
+	return f.env.Mkdir(rel, perm, all)
+}
+
+func (f *FaultEnv) Remove(rel string, all bool) error {
+	if err := f.fail("Remove", rel); err != nil {
+		return err
+	}
+	return f.env.Remove(rel, all)
+}
+
+func (f *FaultEnv) Rename(src, dst string) error {
+	if r := f.check("Rename", src); r != nil && r.Err != nil {
+		return &os.LinkError{Op: "Rename", Old: src, New: dst, Err: r.Err}
+	}
+	return f.env.Rename(src, dst)
+}
+
+func (f *FaultEnv) Stat(name string, followSymlinks bool) (os.FileInfo, error) {
+	if err := f.fail("Stat", name); err != nil {
+		return nil, err
+	}
+	return f.env.Stat(name, followSymlinks)
+}
+
+func (f *FaultEnv) Lstat(name string) (os.FileInfo, error) {
+	if err := f.fail("Lstat", name); err != nil {
+		return nil, err
+	}
+	return f.env.Lstat(name)
+}
+
+func (f *FaultEnv) ReadDir(rel string) ([]os.DirEntry, error) {
+	if err := f.fail("ReadDir", rel); err != nil {
+		return nil, err
+	}
+	return f.env.ReadDir(rel)
+}
+
+func (f *FaultEnv) Symlink(oldname, newname string) error {
+	if r := f.check("Symlink", newname); r != nil && r.Err != nil {
+		return &os.LinkError{Op: "Symlink", Old: oldname, New: newname, Err: r.Err}
+	}
+	return f.env.Symlink(oldname, newname)
+}
+
+func (f *FaultEnv) Readlink(name string) (string, error) {
+	if err := f.fail("Readlink", name); err != nil {
+		return "", err
+	}
+	return f.env.Readlink(name)
+}
+
+func (f *FaultEnv) Chmod(name string, mode os.FileMode) error {
+	if err := f.fail("Chmod", name); err != nil {
+		return err
+	}
+	return f.env.Chmod(name, mode)
+}
+
+func (f *FaultEnv) Chown(name string, uid, gid int) error {
+	if err := f.fail("Chown", name); err != nil {
+		return err
+	}
+	return f.env.Chown(name, uid, gid)
+}
+
+func (f *FaultEnv) Chtimes(name string, atime, mtime time.Time) error {
+	if err := f.fail("Chtimes", name); err != nil {
+		return err
+	}
+	return f.env.Chtimes(name, atime, mtime)
+}
+
+func (f *FaultEnv) Open(rel string) (File, error) {
+	return f.OpenFile(rel, os.O_RDONLY, 0)
+}
+
+func (f *FaultEnv) Create(rel string) (File, error) {
+	return f.OpenFile(rel, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+// OpenFile returns a file whose writes are checked against "Write" rules.
+func (f *FaultEnv) OpenFile(rel string, flag int, perm os.FileMode) (File, error) {
+	if err := f.fail("OpenFile", rel); err != nil {
+		return nil, err
+	}
+	file, err := f.env.OpenFile(rel, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{File: file, env: f}, nil
+}
+
+// faultFile injects "Write" faults into an open file.
+type faultFile struct {
+	File
+	env *FaultEnv
+}
+
+func (f *faultFile) Write(p []byte) (int, error) {
+	r := f.env.check("Write", f.Name())
+	switch {
+	case r != nil && r.ShortWrite:
+		n, err := f.File.Write(p[:min(r.Limit, len(p))])
+		if err != nil {
+			return n, err
+		}
+		return n, &fs.PathError{Op: "write", Path: f.Name(), Err: shortWriteErr(r)}
+	case r != nil && r.Err != nil:
+		return 0, &fs.PathError{Op: "write", Path: f.Name(), Err: r.Err}
+	}
+	return f.File.Write(p)
+}
+
+var _ Env = (*FaultEnv)(nil)
@@ -0,0 +1,121 @@
+package toolkit_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultEnvErrors(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			base := newEnv(t)
+			require.NoError(t, base.Mkdir("~/app", 0o755, true))
+			require.NoError(t, base.WriteFile("~/app/a.yaml", []byte("a"), 0o644))
+			env := toolkit.NewFaultEnv(base, &toolkit.FaultOptions{Rules: []toolkit.FaultRule{
+				{Op: "WriteFile", Path: "*.yaml", Err: syscall.ENOSPC},
+				{Op: "Rename", Path: "~/app/*", Err: syscall.EXDEV},
+				{Op: "ReadFile", Nth: 2, Err: syscall.EACCES},
+			}})
+			ctx := toolkit.WithEnv(t.Context(), env)
+
+			err := toolkit.WriteFile(ctx, "~/app/b.yaml", []byte("b"), 0o644)
+			require.ErrorIs(t, err, syscall.ENOSPC)
+			require.NoError(t, toolkit.WriteFile(ctx, "~/app/b.txt", []byte("b"), 0o644))
+
+			err = toolkit.Rename(ctx, "~/app/a.yaml", "~/a.yaml")
+			require.ErrorIs(t, err, syscall.EXDEV)
+			var linkErr *os.LinkError
+			require.ErrorAs(t, err, &linkErr)
+
+			_, err = toolkit.ReadFile(ctx, "~/app/a.yaml")
+			require.NoError(t, err)
+			_, err = toolkit.ReadFile(ctx, "~/app/a.yaml")
+			require.ErrorIs(t, err, syscall.EACCES)
+			_, err = toolkit.ReadFile(ctx, "~/app/a.yaml")
+			require.NoError(t, err)
+
+			env.ClearRules()
+			require.NoError(t, toolkit.Rename(ctx, "~/app/a.yaml", "~/a.yaml"))
+		})
+	}
+}
+
+func TestFaultEnvShortWrites(t *testing.T) {
+	t.Parallel()
+
+	base := toolkit.NewMemEnv(nil, "", "")
+	require.NoError(t, base.Mkdir("~", 0o755, true))
+	require.NoError(t, base.WriteFile("~/keep", []byte("original"), 0o644))
+	env := toolkit.NewFaultEnv(base, &toolkit.FaultOptions{Rules: []toolkit.FaultRule{
+		{Op: "WriteFile", ShortWrite: true, Limit: 3},
+		{Op: "AtomicWriteFile", ShortWrite: true, Limit: 3},
+		{Op: "Write", ShortWrite: true, Limit: 2, Err: syscall.ENOSPC},
+	}})
+
+	err := env.WriteFile("~/torn", []byte("abcdef"), 0o644)
+	require.ErrorIs(t, err, io.ErrShortWrite)
+	data, err := base.ReadFile("~/torn")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(data))
+
+	err = env.AtomicWriteFile("~/keep", []byte("replacement"), 0o644)
+	require.ErrorIs(t, err, io.ErrShortWrite)
+	data, err = base.ReadFile("~/keep")
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(data), "atomic writes never tear")
+
+	f, err := env.Create("~/log")
+	require.NoError(t, err)
+	n, err := f.Write([]byte("hello"))
+	require.ErrorIs(t, err, syscall.ENOSPC)
+	assert.Equal(t, 2, n)
+	require.NoError(t, f.Close())
+}
+
+func TestFaultEnvLatencyAndProbability(t *testing.T) {
+	t.Parallel()
+
+	clk := clock.NewTestClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	base := toolkit.NewMemEnv(clk, "", "")
+	require.NoError(t, base.Mkdir("~", 0o755, true))
+	require.NoError(t, base.WriteFile("~/a", []byte("a"), 0o644))
+
+	env := toolkit.NewFaultEnv(base, &toolkit.FaultOptions{
+		Clock: clk,
+		Rules: []toolkit.FaultRule{{Op: "Stat", Latency: time.Second}},
+	})
+	start := clk.Now()
+	_, err := env.Stat("~/a", false)
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, clk.Now().Sub(start))
+
+	// The same seed yields the same sequence of failures.
+	failures := func() []bool {
+		env := toolkit.NewFaultEnv(base, &toolkit.FaultOptions{
+			Seed:  42,
+			Rules: []toolkit.FaultRule{{Op: "ReadFile", Probability: 0.5, Err: syscall.EIO}},
+		})
+		var out []bool
+		for range 32 {
+			_, err := env.ReadFile("~/a")
+			out = append(out, errors.Is(err, syscall.EIO))
+		}
+		return out
+	}
+	first := failures()
+	assert.Equal(t, first, failures())
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+}
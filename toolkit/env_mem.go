@@ -0,0 +1,1012 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+)
+
+// maxSymlinkDepth bounds the number of symlinks followed while resolving a
+// single path. It mirrors the limit used by most unix kernels.
+const maxSymlinkDepth = 40
+
+// MemEnv is an Env implementation that keeps both environment variables and
+// the filesystem entirely in memory. Nothing is ever read from or written to
+// disk, which makes it suitable for large table driven tests that need to run
+// in parallel without temporary directories.
+//
+// Paths are absolute within the virtual tree rooted at "/". Modification times
+// are taken from the configured clock. Permissions are recorded but not
+// enforced. MemEnv is safe for concurrent use.
+type MemEnv struct {
+	mu    sync.Mutex
+	clock clock.Clock
+	home  string
+	user  string
+	data  map[string]string
+	root  *memNode
+	locks *lockTable
+}
+
+// memNode is a single file, directory or symlink in a MemEnv tree.
+type memNode struct {
+	mode     os.FileMode
+	modTime  time.Time
+	data     []byte
+	target   string
+	children map[string]*memNode
+	uid, gid int
+}
+
+func (n *memNode) isDir() bool     { return n.mode.IsDir() }
+func (n *memNode) isSymlink() bool { return n.mode&os.ModeSymlink != 0 }
+
+// info returns a snapshot of the node metadata using name as the base name.
+func (n *memNode) info(name string) os.FileInfo {
+	size := int64(len(n.data))
+	if n.isSymlink() {
+		size = int64(len(n.target))
+	} else if n.isDir() {
+		size = 0
+	}
+	return &memFileInfo{
+		name:    name,
+		size:    size,
+		mode:    n.mode,
+		modTime: n.modTime,
+	}
+}
+
+// memFileInfo implements os.FileInfo for MemEnv nodes.
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return i.size }
+func (i *memFileInfo) Mode() os.FileMode  { return i.mode }
+func (i *memFileInfo) ModTime() time.Time { return i.modTime }
+func (i *memFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memFileInfo) Sys() any           { return nil }
+
+// NewMemEnv constructs a MemEnv populated with the same defaults as
+// NewTestEnv. Modification times are read from clk; when clk is nil the real
+// OS clock is used.
+//
+// If home or username are empty, reasonable defaults are chosen:
+//   - home defaults to "/home/<username>"
+//   - username defaults to "testuser"
+//
+// Only the root directory exists initially. Use Mkdir to create home or any
+// other directories needed by the test.
+func NewMemEnv(clk clock.Clock, home, username string) *MemEnv {
+	if clk == nil {
+		clk = &clock.OsClock{}
+	}
+	if username == "" {
+		username = "testuser"
+	}
+
+	// Reuse the TestEnv defaults for HOME, PWD and the platform specific
+	// variables. Without a jail TMPDIR would be relative, so reset it.
+	te := NewTestEnv("", home, username)
+	m := &MemEnv{
+		clock: clk,
+		home:  te.home,
+		user:  te.user,
+		data:  te.data,
+		locks: newLockTable(),
+	}
+	if runtime.GOOS != "windows" {
+		m.data["TMPDIR"] = filepath.Join(string(filepath.Separator), "tmp")
+	}
+	m.root = &memNode{
+		mode:     os.ModeDir | 0o755,
+		modTime:  clk.Now(),
+		children: make(map[string]*memNode),
+	}
+	return m
+}
+
+func (m *MemEnv) Name() string {
+	return "mem-env"
+}
+
+// GetJail returns an empty string. A MemEnv has no on-disk jail; the whole
+// virtual tree is already isolated from the host filesystem.
+func (m *MemEnv) GetJail() string {
+	return ""
+}
+
+// GetHome returns the configured home directory or an error if it is not set.
+func (m *MemEnv) GetHome() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.home == "" {
+		return "", errors.New("home not set in MemEnv")
+	}
+	return m.home, nil
+}
+
+// SetHome sets the MemEnv home directory and updates the "HOME" key.
+func (m *MemEnv) SetHome(rel string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.absPath(rel)
+	if err != nil {
+		return fmt.Errorf("unable to set home: %w", err)
+	}
+	m.home = path
+	m.data["HOME"] = path
+	return nil
+}
+
+// GetUser returns the configured username or an error if it is not set.
+func (m *MemEnv) GetUser() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.user == "" {
+		return "", errors.New("user not set in MemEnv")
+	}
+	return m.user, nil
+}
+
+// SetUser sets the current user and updates the "USER" key.
+func (m *MemEnv) SetUser(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.user = username
+	m.data["USER"] = username
+	return nil
+}
+
+// Get returns the stored value for key. The special keys HOME and USER come
+// from dedicated fields.
+func (m *MemEnv) Get(key string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch key {
+	case "HOME":
+		return m.home
+	case "USER":
+		return m.user
+	default:
+		return m.data[key]
+	}
+}
+
+// Set stores a key/value pair. Setting HOME, USER or PWD updates the
+// corresponding dedicated state.
+func (m *MemEnv) Set(key string, value string) error {
+	switch key {
+	case "HOME":
+		return m.SetHome(value)
+	case "USER":
+		return m.SetUser(value)
+	case "PWD":
+		m.Setwd(value)
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = value
+	return nil
+}
+
+// Environ returns a sorted slice of "KEY=VALUE" entries.
+func (m *MemEnv) Environ() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := maps.Clone(m.data)
+	if m.home != "" {
+		entries["HOME"] = m.home
+	}
+	if m.user != "" {
+		entries["USER"] = m.user
+	}
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, k+"="+entries[k])
+	}
+	return out
+}
+
+// Has reports whether the given key is present.
+func (m *MemEnv) Has(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.data[key]
+	return ok
+}
+
+// Unset removes a key. Unsetting HOME or USER clears the dedicated field.
+func (m *MemEnv) Unset(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch key {
+	case "HOME":
+		m.home = ""
+	case "USER":
+		m.user = ""
+	}
+	delete(m.data, key)
+}
+
+// GetTempDir returns TMPDIR, TEMP or TMP when set and "/tmp" otherwise.
+func (m *MemEnv) GetTempDir() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range []string{"TMPDIR", "TEMP", "TMP"} {
+		if d := m.data[k]; d != "" {
+			return d
+		}
+	}
+	return filepath.Join(string(filepath.Separator), "tmp")
+}
+
+// Getwd returns the stored PWD value if set, otherwise an error.
+func (m *MemEnv) Getwd() (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.getwd()
+}
+
+func (m *MemEnv) getwd() (string, error) {
+	if wd := m.data["PWD"]; wd != "" {
+		return wd, nil
+	}
+	return "", errors.New("working directory not set in MemEnv")
+}
+
+// Setwd sets the stored PWD value. The directory does not need to exist.
+func (m *MemEnv) Setwd(dir string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, _ := m.absPath(dir)
+	m.data["PWD"] = path
+}
+
+// ExpandPath expands a leading tilde in the provided path to the MemEnv home.
+func (m *MemEnv) ExpandPath(p string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.expandPath(p)
+}
+
+func (m *MemEnv) expandPath(p string) string {
+	if p == "~" {
+		return filepath.Clean(m.home)
+	}
+	if strings.HasPrefix(p, "~/") || strings.HasPrefix(p, `~\`) {
+		return filepath.Join(m.home, p[2:])
+	}
+	return p
+}
+
+// absPath expands rel and joins it with the working directory to produce a
+// cleaned absolute path. It does not consult the tree.
+func (m *MemEnv) absPath(rel string) (string, error) {
+	p := m.expandPath(rel)
+	if p == "" || p == "." {
+		return m.getwd()
+	}
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p), nil
+	}
+	wd, err := m.getwd()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(wd, p), nil
+}
+
+// ResolvePath returns the absolute form of rel. When follow is true every
+// symlink in the path is resolved against the in-memory tree.
+func (m *MemEnv) ResolvePath(rel string, follow bool) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.absPath(rel)
+	if err != nil {
+		return "", err
+	}
+	if !follow {
+		return path, nil
+	}
+	resolved, _, err := m.resolve(path, true)
+	if err != nil {
+		return "", &fs.PathError{Op: "resolve", Path: rel, Err: err}
+	}
+	return resolved, nil
+}
+
+// splitPath splits a cleaned absolute path into its components.
+func splitPath(path string) []string {
+	sep := string(filepath.Separator)
+	path = strings.TrimPrefix(filepath.Clean(path), filepath.VolumeName(path))
+	path = strings.Trim(path, sep)
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, sep)
+}
+
+// resolve walks path from the root and returns the real path and node it
+// refers to. Intermediate symlinks are always followed; the final component
+// is followed only when follow is true.
+func (m *MemEnv) resolve(path string, follow bool) (string, *memNode, error) {
+	sep := string(filepath.Separator)
+	parts := splitPath(path)
+	cur := m.root
+	curPath := sep
+	links := 0
+	for i := 0; i < len(parts); i++ {
+		if !cur.isDir() {
+			return "", nil, syscall.ENOTDIR
+		}
+		child, ok := cur.children[parts[i]]
+		if !ok {
+			return "", nil, fs.ErrNotExist
+		}
+		last := i == len(parts)-1
+		if child.isSymlink() && (!last || follow) {
+			links++
+			if links > maxSymlinkDepth {
+				return "", nil, syscall.ELOOP
+			}
+			target := child.target
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(curPath, target)
+			}
+			parts = append(splitPath(target), parts[i+1:]...)
+			cur = m.root
+			curPath = sep
+			i = -1
+			continue
+		}
+		cur = child
+		curPath = filepath.Join(curPath, parts[i])
+	}
+	return curPath, cur, nil
+}
+
+// lookupForWrite follows any symlink chain at path and returns the parent
+// directory and base name of the final target along with its node when it
+// already exists. It is used by operations that create files through links.
+func (m *MemEnv) lookupForWrite(path string) (*memNode, string, *memNode, error) {
+	for range maxSymlinkDepth {
+		if len(splitPath(path)) == 0 {
+			return nil, "", m.root, nil
+		}
+		dirPath, dir, err := m.resolve(filepath.Dir(path), true)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if !dir.isDir() {
+			return nil, "", nil, syscall.ENOTDIR
+		}
+		name := filepath.Base(path)
+		child := dir.children[name]
+		if child != nil && child.isSymlink() {
+			path = child.target
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dirPath, path)
+			}
+			continue
+		}
+		return dir, name, child, nil
+	}
+	return nil, "", nil, syscall.ELOOP
+}
+
+// lookupParent resolves the directory containing path and returns it with the
+// base name of path. The final component itself is not followed.
+func (m *MemEnv) lookupParent(path string) (*memNode, string, error) {
+	if len(splitPath(path)) == 0 {
+		return nil, "", fs.ErrInvalid
+	}
+	_, dir, err := m.resolve(filepath.Dir(path), true)
+	if err != nil {
+		return nil, "", err
+	}
+	if !dir.isDir() {
+		return nil, "", syscall.ENOTDIR
+	}
+	return dir, filepath.Base(path), nil
+}
+
+// touch updates the modification time of n to the current clock time.
+func (m *MemEnv) touch(n *memNode) {
+	n.modTime = m.clock.Now()
+}
+
+// ReadFile reads the named file from the in-memory tree.
+func (m *MemEnv) ReadFile(rel string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.absPath(rel)
+	if err != nil {
+		return nil, err
+	}
+	_, n, err := m.resolve(path, true)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: rel, Err: err}
+	}
+	if n.isDir() {
+		return nil, &fs.PathError{Op: "read", Path: rel, Err: syscall.EISDIR}
+	}
+	return append([]byte(nil), n.data...), nil
+}
+
+// WriteFile writes data to the named file, creating it with perm when it does
+// not exist. Like os.WriteFile the permissions of an existing file are kept.
+func (m *MemEnv) WriteFile(rel string, data []byte, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.absPath(rel)
+	if err != nil {
+		return err
+	}
+	dir, name, n, err := m.lookupForWrite(path)
+	if err != nil {
+		return &fs.PathError{Op: "open", Path: rel, Err: err}
+	}
+	if n != nil && n.isDir() {
+		return &fs.PathError{Op: "open", Path: rel, Err: syscall.EISDIR}
+	}
+	if n == nil {
+		n = &memNode{mode: perm.Perm()}
+		dir.children[name] = n
+		m.touch(dir)
+	}
+	n.data = append([]byte(nil), data...)
+	m.touch(n)
+	return nil
+}
+
+// AtomicWriteFile replaces the named file with data in a single step. Parent
+// directories are created as needed. perm is used for new files while an
+// existing file keeps its mode.
+func (m *MemEnv) AtomicWriteFile(rel string, data []byte, perm os.FileMode) error {
+	return m.AtomicWriteFileWithOptions(rel, data, perm, nil)
+}
+
+// AtomicWriteFileWithOptions replaces the named file in a single step. An
+// existing file keeps its mode unless opts.ForcePerm is set.
+func (m *MemEnv) AtomicWriteFileWithOptions(rel string, data []byte, perm os.FileMode, opts *AtomicWriteOptions) error {
+	if opts == nil {
+		opts = &AtomicWriteOptions{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.absPath(rel)
+	if err != nil {
+		return err
+	}
+	if err := m.mkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("atomic write: mkdirall %q: %w", filepath.Dir(path), err)
+	}
+	dir, name, n, err := m.lookupForWrite(path)
+	if err != nil {
+		return &fs.PathError{Op: "atomic write", Path: rel, Err: err}
+	}
+	mode := perm.Perm()
+	if n != nil {
+		if n.isDir() {
+			return &fs.PathError{Op: "atomic write", Path: rel, Err: syscall.EISDIR}
+		}
+		if !opts.ForcePerm {
+			mode = n.mode.Perm()
+		}
+		if opts.BackupSuffix != "" {
+			dir.children[name+opts.BackupSuffix] = n
+		}
+	}
+	n = &memNode{mode: mode, data: append([]byte(nil), data...)}
+	m.touch(n)
+	dir.children[name] = n
+	m.touch(dir)
+	return nil
+}
+
+// Mkdir creates a directory. If all is true missing parents are created and
+// an existing directory is not an error.
+func (m *MemEnv) Mkdir(rel string, perm os.FileMode, all bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.absPath(rel)
+	if err != nil {
+		return err
+	}
+	if all {
+		err = m.mkdirAll(path, perm)
+	} else {
+		err = m.mkdir(path, perm)
+	}
+	if err != nil {
+		return &fs.PathError{Op: "mkdir", Path: rel, Err: err}
+	}
+	return nil
+}
+
+func (m *MemEnv) mkdir(path string, perm os.FileMode) error {
+	dir, name, err := m.lookupParent(path)
+	if errors.Is(err, fs.ErrInvalid) {
+		return fs.ErrExist
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := dir.children[name]; ok {
+		return fs.ErrExist
+	}
+	n := &memNode{
+		mode:     os.ModeDir | perm.Perm(),
+		children: make(map[string]*memNode),
+	}
+	m.touch(n)
+	dir.children[name] = n
+	m.touch(dir)
+	return nil
+}
+
+func (m *MemEnv) mkdirAll(path string, perm os.FileMode) error {
+	cur := string(filepath.Separator)
+	for _, part := range splitPath(path) {
+		cur = filepath.Join(cur, part)
+		_, n, err := m.resolve(cur, true)
+		if err == nil {
+			if !n.isDir() {
+				return syscall.ENOTDIR
+			}
+			continue
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err := m.mkdir(cur, perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove removes the named file or empty directory. If all is true the
+// directory and its contents are removed and a missing path is not an error.
+func (m *MemEnv) Remove(rel string, all bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.absPath(rel)
+	if err != nil {
+		return err
+	}
+	dir, name, err := m.lookupParent(path)
+	if err != nil {
+		if all && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return &fs.PathError{Op: "remove", Path: rel, Err: err}
+	}
+	n, ok := dir.children[name]
+	if !ok {
+		if all {
+			return nil
+		}
+		return &fs.PathError{Op: "remove", Path: rel, Err: fs.ErrNotExist}
+	}
+	if !all && n.isDir() && len(n.children) > 0 {
+		return &fs.PathError{Op: "remove", Path: rel, Err: syscall.ENOTEMPTY}
+	}
+	delete(dir.children, name)
+	m.touch(dir)
+	return nil
+}
+
+// Rename renames (moves) a file, directory or symlink. An existing
+// destination file is replaced; an existing destination directory must be
+// empty.
+func (m *MemEnv) Rename(src, dst string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wrap := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: err}
+	}
+	a, err := m.absPath(src)
+	if err != nil {
+		return err
+	}
+	b, err := m.absPath(dst)
+	if err != nil {
+		return err
+	}
+	srcDir, srcName, err := m.lookupParent(a)
+	if err != nil {
+		return wrap(err)
+	}
+	n, ok := srcDir.children[srcName]
+	if !ok {
+		return wrap(fs.ErrNotExist)
+	}
+	dstDir, dstName, err := m.lookupParent(b)
+	if err != nil {
+		return wrap(err)
+	}
+	if n.isDir() {
+		// Refuse to move a directory beneath itself.
+		rp, _, err := m.resolve(filepath.Dir(b), true)
+		if err != nil {
+			return wrap(err)
+		}
+		ra, _, _ := m.resolve(a, false)
+		if rp == ra || strings.HasPrefix(rp, ra+string(filepath.Separator)) {
+			return wrap(fs.ErrInvalid)
+		}
+	}
+	if existing, ok := dstDir.children[dstName]; ok {
+		if existing == n {
+			return nil
+		}
+		switch {
+		case existing.isDir() && !n.isDir():
+			return wrap(syscall.EISDIR)
+		case !existing.isDir() && n.isDir():
+			return wrap(syscall.ENOTDIR)
+		case existing.isDir() && len(existing.children) > 0:
+			return wrap(syscall.ENOTEMPTY)
+		}
+	}
+	delete(srcDir.children, srcName)
+	dstDir.children[dstName] = n
+	m.touch(srcDir)
+	m.touch(dstDir)
+	return nil
+}
+
+// Stat returns file info for the named path. When followSymlinks is false a
+// symlink is described rather than its target.
+func (m *MemEnv) Stat(name string, followSymlinks bool) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.absPath(name)
+	if err != nil {
+		return nil, err
+	}
+	_, n, err := m.resolve(path, followSymlinks)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return n.info(filepath.Base(path)), nil
+}
+
+// ReadDir returns the entries of the named directory sorted by name.
+func (m *MemEnv) ReadDir(rel string) ([]os.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.absPath(rel)
+	if err != nil {
+		return nil, err
+	}
+	_, n, err := m.resolve(path, true)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: rel, Err: err}
+	}
+	if !n.isDir() {
+		return nil, &fs.PathError{Op: "readdirent", Path: rel, Err: syscall.ENOTDIR}
+	}
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]os.DirEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, fs.FileInfoToDirEntry(n.children[name].info(name)))
+	}
+	return entries, nil
+}
+
+// Symlink creates newname as a symbolic link to oldname. The target is stored
+// verbatim after tilde expansion; relative targets are resolved against the
+// directory containing the link.
+func (m *MemEnv) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wrap := func(err error) error {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	path, err := m.absPath(newname)
+	if err != nil {
+		return err
+	}
+	dir, name, err := m.lookupParent(path)
+	if err != nil {
+		return wrap(err)
+	}
+	if _, ok := dir.children[name]; ok {
+		return wrap(fs.ErrExist)
+	}
+	n := &memNode{
+		mode:   os.ModeSymlink | 0o777,
+		target: m.expandPath(oldname),
+	}
+	m.touch(n)
+	dir.children[name] = n
+	m.touch(dir)
+	return nil
+}
+
+// Readlink returns the destination of the named symbolic link.
+func (m *MemEnv) Readlink(rel string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.absPath(rel)
+	if err != nil {
+		return "", err
+	}
+	_, n, err := m.resolve(path, false)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: rel, Err: err}
+	}
+	if !n.isSymlink() {
+		return "", &fs.PathError{Op: "readlink", Path: rel, Err: fs.ErrInvalid}
+	}
+	return n.target, nil
+}
+
+// Chtimes sets the modification time of the named file. MemEnv does not
+// track access times so atime is ignored.
+func (m *MemEnv) Chtimes(rel string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.absPath(rel)
+	if err != nil {
+		return err
+	}
+	_, n, err := m.resolve(path, true)
+	if err != nil {
+		return &fs.PathError{Op: "chtimes", Path: rel, Err: err}
+	}
+	n.modTime = mtime
+	return nil
+}
+
+// Chmod changes the permission bits of the named file.
+func (m *MemEnv) Chmod(rel string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.absPath(rel)
+	if err != nil {
+		return err
+	}
+	_, n, err := m.resolve(path, true)
+	if err != nil {
+		return &fs.PathError{Op: "chmod", Path: rel, Err: err}
+	}
+	keep := n.mode.Type()
+	n.mode = keep | mode&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)
+	return nil
+}
+
+// Chown records the numeric uid and gid of the named file. MemEnv does not
+// enforce ownership.
+func (m *MemEnv) Chown(rel string, uid, gid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.absPath(rel)
+	if err != nil {
+		return err
+	}
+	_, n, err := m.resolve(path, true)
+	if err != nil {
+		return &fs.PathError{Op: "chown", Path: rel, Err: err}
+	}
+	n.uid, n.gid = uid, gid
+	return nil
+}
+
+// Lstat returns the os.FileInfo for the named file without following a final
+// symlink.
+func (m *MemEnv) Lstat(name string) (os.FileInfo, error) {
+	return m.Stat(name, false)
+}
+
+// TryLock implements Locker using an in-process lock table.
+func (m *MemEnv) TryLock(path string, shared bool) (func() error, error) {
+	resolved, err := m.ResolvePath(path, false)
+	if err != nil {
+		return nil, err
+	}
+	return m.locks.tryLock(resolved, shared)
+}
+
+// Open opens the named file for reading.
+func (m *MemEnv) Open(rel string) (File, error) {
+	return m.OpenFile(rel, os.O_RDONLY, 0)
+}
+
+// Create creates or truncates the named file.
+func (m *MemEnv) Create(rel string) (File, error) {
+	return m.OpenFile(rel, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+// OpenFile opens the named file with the given flags and permissions. The
+// returned handle reads and writes the in-memory node directly, so changes
+// are visible to other handles and to ReadFile immediately.
+func (m *MemEnv) OpenFile(rel string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path, err := m.absPath(rel)
+	if err != nil {
+		return nil, err
+	}
+	wrap := func(err error) error {
+		return &fs.PathError{Op: "open", Path: rel, Err: err}
+	}
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+
+	var n *memNode
+	if flag&os.O_CREATE != 0 {
+		dir, name, existing, err := m.lookupForWrite(path)
+		if err != nil {
+			return nil, wrap(err)
+		}
+		if existing != nil && flag&os.O_EXCL != 0 {
+			return nil, wrap(fs.ErrExist)
+		}
+		n = existing
+		if n == nil {
+			n = &memNode{mode: perm.Perm()}
+			m.touch(n)
+			dir.children[name] = n
+			m.touch(dir)
+		}
+	} else {
+		_, n, err = m.resolve(path, true)
+		if err != nil {
+			return nil, wrap(err)
+		}
+	}
+	if n.isDir() && writable {
+		return nil, wrap(syscall.EISDIR)
+	}
+	if writable && flag&os.O_TRUNC != 0 {
+		n.data = nil
+		m.touch(n)
+	}
+	return &memFile{env: m, name: path, node: n, flag: flag}, nil
+}
+
+// memFile is a File handle onto a MemEnv node.
+type memFile struct {
+	env    *MemEnv
+	name   string
+	node   *memNode
+	flag   int
+	offset int64
+	closed bool
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.env.mu.Lock()
+	defer f.env.mu.Unlock()
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.flag&os.O_WRONLY != 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: syscall.EBADF}
+	}
+	if f.node.isDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.env.mu.Lock()
+	defer f.env.mu.Unlock()
+	if f.closed {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+	}
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.node.data))
+	}
+	end := f.offset + int64(len(p))
+	if end > int64(len(f.node.data)) {
+		grown := make([]byte, end)
+		copy(grown, f.node.data)
+		f.node.data = grown
+	}
+	copy(f.node.data[f.offset:], p)
+	f.offset = end
+	f.env.touch(f.node)
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.env.mu.Lock()
+	defer f.env.mu.Unlock()
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = f.offset + offset
+	case io.SeekEnd:
+		abs = int64(len(f.node.data)) + offset
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if abs < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = abs
+	return abs, nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.env.mu.Lock()
+	defer f.env.mu.Unlock()
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	return f.node.info(filepath.Base(f.name)), nil
+}
+
+// Sync is a no-op; memory is the stable storage of a MemEnv.
+func (f *memFile) Sync() error {
+	f.env.mu.Lock()
+	defer f.env.mu.Unlock()
+	if f.closed {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: fs.ErrClosed}
+	}
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.env.mu.Lock()
+	defer f.env.mu.Unlock()
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+// Ensure implementations satisfy the interfaces.
+var _ Env = (*MemEnv)(nil)
+var _ FileSystem = (*MemEnv)(nil)
+var _ File = (*memFile)(nil)
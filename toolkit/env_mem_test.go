@@ -0,0 +1,177 @@
+package toolkit_test
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMemEnv(t *testing.T) (*toolkit.MemEnv, *clock.TestClock) {
+	t.Helper()
+	clk := clock.NewTestClock(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+	env := toolkit.NewMemEnv(clk, "", "")
+	require.NoError(t, env.Mkdir("~", 0o755, true))
+	return env, clk
+}
+
+func TestMemEnvDefaults(t *testing.T) {
+	t.Parallel()
+	env := toolkit.NewMemEnv(nil, "", "")
+
+	home, err := env.GetHome()
+	require.NoError(t, err)
+	assert.Equal(t, "/home/testuser", home)
+
+	user, err := env.GetUser()
+	require.NoError(t, err)
+	assert.Equal(t, "testuser", user)
+
+	wd, err := env.Getwd()
+	require.NoError(t, err)
+	assert.Equal(t, "/home/testuser", wd)
+	assert.Equal(t, "/tmp", env.GetTempDir())
+	assert.Empty(t, env.GetJail())
+}
+
+func TestMemEnvReadWrite(t *testing.T) {
+	t.Parallel()
+	env, clk := newMemEnv(t)
+
+	require.NoError(t, env.WriteFile("notes.txt", []byte("hello"), 0o600))
+	data, err := env.ReadFile("~/notes.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	info, err := env.Stat("/home/testuser/notes.txt", true)
+	require.NoError(t, err)
+	assert.Equal(t, "notes.txt", info.Name())
+	assert.Equal(t, int64(5), info.Size())
+	assert.Equal(t, fs.FileMode(0o600), info.Mode())
+	assert.Equal(t, clk.Now(), info.ModTime())
+
+	// Overwriting keeps the original mode and picks up the new time.
+	clk.Advance(time.Minute)
+	require.NoError(t, env.WriteFile("notes.txt", []byte("bye"), 0o644))
+	info, err = env.Stat("notes.txt", true)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o600), info.Mode())
+	assert.Equal(t, clk.Now(), info.ModTime())
+
+	// Writing into a missing directory fails like the OS would.
+	err = env.WriteFile("missing/file.txt", nil, 0o644)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	_, err = env.ReadFile("nope.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestMemEnvDirectories(t *testing.T) {
+	t.Parallel()
+	env, _ := newMemEnv(t)
+
+	require.NoError(t, env.Mkdir("a/b/c", 0o755, true))
+	require.NoError(t, env.Mkdir("a/b/c", 0o755, true))
+	assert.ErrorIs(t, env.Mkdir("a", 0o755, false), fs.ErrExist)
+
+	require.NoError(t, env.WriteFile("a/z.txt", []byte("z"), 0o644))
+	require.NoError(t, env.WriteFile("a/b/y.txt", []byte("y"), 0o644))
+
+	entries, err := env.ReadDir("a")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "b", entries[0].Name())
+	assert.True(t, entries[0].IsDir())
+	assert.Equal(t, "z.txt", entries[1].Name())
+
+	assert.Error(t, env.Remove("a", false), "non-empty dir")
+	require.NoError(t, env.Remove("a/z.txt", false))
+	require.NoError(t, env.Remove("a", true))
+	require.NoError(t, env.Remove("a", true), "missing path with all")
+	_, err = env.Stat("a/b", true)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestMemEnvRename(t *testing.T) {
+	t.Parallel()
+	env, _ := newMemEnv(t)
+
+	require.NoError(t, env.Mkdir("src/sub", 0o755, true))
+	require.NoError(t, env.WriteFile("src/sub/f.txt", []byte("f"), 0o644))
+	require.NoError(t, env.Rename("src", "dst"))
+
+	data, err := env.ReadFile("dst/sub/f.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "f", string(data))
+	_, err = env.Stat("src", false)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	assert.Error(t, env.Rename("dst", "dst/sub/inner"), "into itself")
+}
+
+func TestMemEnvSymlinks(t *testing.T) {
+	t.Parallel()
+	env, _ := newMemEnv(t)
+
+	require.NoError(t, env.Mkdir("real", 0o755, true))
+	require.NoError(t, env.WriteFile("real/file.txt", []byte("data"), 0o644))
+	require.NoError(t, env.Symlink("real", "link"))
+	require.NoError(t, env.Symlink("/home/testuser/real/file.txt", "abs"))
+
+	data, err := env.ReadFile("link/file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	info, err := env.Stat("abs", false)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&fs.ModeSymlink)
+	info, err = env.Stat("abs", true)
+	require.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+
+	resolved, err := env.ResolvePath("link/file.txt", true)
+	require.NoError(t, err)
+	assert.Equal(t, "/home/testuser/real/file.txt", resolved)
+
+	// Writing through a dangling link creates the target.
+	require.NoError(t, env.Symlink("created.txt", "dangling"))
+	require.NoError(t, env.WriteFile("dangling", []byte("new"), 0o644))
+	data, err = env.ReadFile("created.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+
+	// Loops are detected.
+	require.NoError(t, env.Symlink("loop-b", "loop-a"))
+	require.NoError(t, env.Symlink("loop-a", "loop-b"))
+	_, err = env.ReadFile("loop-a")
+	assert.Error(t, err)
+}
+
+func TestMemEnvAtomicWriteFile(t *testing.T) {
+	t.Parallel()
+	env, _ := newMemEnv(t)
+
+	require.NoError(t, env.AtomicWriteFile("deep/dir/f.txt", []byte("x"), 0o600))
+	info, err := env.Stat("deep/dir/f.txt", true)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o600), info.Mode())
+}
+
+func TestMemEnvWithContextHelpers(t *testing.T) {
+	t.Parallel()
+	env, _ := newMemEnv(t)
+	require.NoError(t, env.Set("FOO", "bar"))
+	ctx := toolkit.WithEnv(context.Background(), env)
+
+	assert.Equal(t, "bar/baz", toolkit.ExpandEnv(ctx, "$FOO/baz"))
+	require.NoError(t, toolkit.WriteFile(ctx, "~/x/y/z.txt", []byte("z"), 0o644))
+	data, err := toolkit.ReadFile(ctx, "x/y/z.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "z", string(data))
+	assert.Contains(t, toolkit.DumpEnv(ctx), "FOO=bar\n")
+}
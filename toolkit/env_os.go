@@ -1,12 +1,12 @@
 package toolkit
 
 import (
-	"fmt"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 )
 
 // OsEnv is an Env implementation that delegates to the real process
@@ -196,9 +196,18 @@ func (o *OsEnv) Stat(name string, follow bool) (os.FileInfo, error) {
 	if err != nil {
 		return nil, err
 	}
+	if !follow {
+		return os.Lstat(path)
+	}
 	return os.Stat(path)
 }
 
+// Lstat returns the os.FileInfo for the named file without following a final
+// symlink.
+func (o *OsEnv) Lstat(name string) (os.FileInfo, error) {
+	return o.Stat(name, false)
+}
+
 func (o *OsEnv) Symlink(oldname string, newname string) error {
 	oldPath := o.ExpandPath(oldname)
 	newPath := o.ExpandPath(newname)
@@ -206,38 +215,58 @@ func (o *OsEnv) Symlink(oldname string, newname string) error {
 }
 
 func (o *OsEnv) AtomicWriteFile(rel string, data []byte, perm os.FileMode) error {
-	path := o.ExpandPath(rel)
+	return o.AtomicWriteFileWithOptions(rel, data, perm, nil)
+}
 
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return fmt.Errorf("atomic write: mkdirall %q: %w", dir, err)
+// AtomicWriteFileWithOptions durably replaces the named file. The temporary
+// file is created next to the target and a symlink at rel is followed so the
+// link itself is not replaced.
+func (o *OsEnv) AtomicWriteFileWithOptions(rel string, data []byte, perm os.FileMode, opts *AtomicWriteOptions) error {
+	path := o.ExpandPath(rel)
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		path = p
 	}
+	return atomicWriteFile(path, data, perm, opts)
+}
 
-	tmpFile, err := os.CreateTemp("", ".tmp-"+filepath.Base(path)+".*")
-	if err != nil {
-		return fmt.Errorf("atomic write: create temp file: %w", err)
-	}
-	tmpName := tmpFile.Name()
-	defer os.Remove(tmpName)
+// Open opens the named file for reading.
+func (o *OsEnv) Open(rel string) (File, error) {
+	return o.OpenFile(rel, os.O_RDONLY, 0)
+}
 
-	if _, err := tmpFile.Write(data); err != nil {
-		_ = tmpFile.Close()
-		return fmt.Errorf("atomic write: write temp file %q: %w", tmpName, err)
-	}
+// Create creates or truncates the named file.
+func (o *OsEnv) Create(rel string) (File, error) {
+	return o.OpenFile(rel, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
 
-	if err := tmpFile.Close(); err != nil {
-		return fmt.Errorf("atomic write: close temp file %q: %w", tmpName, err)
+// OpenFile opens the named file on the real filesystem with the given flags
+// and permissions.
+func (o *OsEnv) OpenFile(rel string, flag int, perm os.FileMode) (File, error) {
+	f, err := os.OpenFile(o.ExpandPath(rel), flag, perm)
+	if err != nil {
+		return nil, err
 	}
+	return f, nil
+}
 
-	if err := os.Chmod(tmpName, perm); err != nil {
-		// Not fatal: continue anyway
-	}
+// Readlink returns the destination of the named symbolic link.
+func (o *OsEnv) Readlink(rel string) (string, error) {
+	return os.Readlink(o.ExpandPath(rel))
+}
 
-	if err := os.Rename(tmpName, path); err != nil {
-		return fmt.Errorf("atomic write: rename %q -> %q: %w", tmpName, path, err)
-	}
+// Chtimes changes the access and modification times of the named file.
+func (o *OsEnv) Chtimes(rel string, atime, mtime time.Time) error {
+	return os.Chtimes(o.ExpandPath(rel), atime, mtime)
+}
+
+// Chmod changes the mode of the named file.
+func (o *OsEnv) Chmod(rel string, mode os.FileMode) error {
+	return os.Chmod(o.ExpandPath(rel), mode)
+}
 
-	return nil
+// Chown changes the numeric uid and gid of the named file.
+func (o *OsEnv) Chown(rel string, uid, gid int) error {
+	return os.Chown(o.ExpandPath(rel), uid, gid)
 }
 
 // Ensure implementations satisfy the interfaces.
@@ -0,0 +1,850 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// OverlayEnv layers a writable upper Env over a read-only lower Env in the
+// style of a copy-on-write union filesystem. Reads see the merged view;
+// writes copy the affected file up to the upper layer first, and removals
+// are recorded as whiteouts so the lower entry is hidden. The lower Env is
+// never modified until Commit is called.
+//
+// Paths are resolved in the merged view, so symlinks may cross layers. The
+// environment variables, home, user and working directory are those of the
+// upper Env, seeded from the lower Env by NewOverlayEnv. Ownership is not
+// carried over when a file is copied up. OverlayEnv is safe for concurrent
+// use, although open files write straight to the upper layer.
+type OverlayEnv struct {
+	envVars
+
+	mu        sync.Mutex
+	lower     Env
+	upper     Env
+	whiteouts map[string]bool
+}
+
+// permBits are the mode bits carried between layers.
+const permBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// openWriteFlags are the OpenFile flags that can modify a file.
+const openWriteFlags = os.O_WRONLY | os.O_RDWR | os.O_APPEND | os.O_CREATE | os.O_TRUNC
+
+// ChangeKind describes how a path differs between the merged view of an
+// OverlayEnv and its lower layer.
+type ChangeKind int
+
+const (
+	ChangeAdded ChangeKind = iota + 1
+	ChangeModified
+	ChangeRemoved
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeModified:
+		return "modified"
+	case ChangeRemoved:
+		return "removed"
+	default:
+		return fmt.Sprintf("ChangeKind(%d)", int(k))
+	}
+}
+
+// Change is a single entry reported by OverlayEnv.Diff. Path is absolute.
+type Change struct {
+	Path string
+	Kind ChangeKind
+}
+
+// NewOverlayEnv returns an OverlayEnv that reads through to lower and
+// records every change in upper. When upper is nil an empty MemEnv is used;
+// pass a TestEnv rooted at a scratch directory to keep the changes on disk.
+// The upper Env should start out empty. Its environment variables and
+// working directory are overwritten with those of lower.
+func NewOverlayEnv(lower, upper Env) *OverlayEnv {
+	if upper == nil {
+		upper = NewMemEnv(nil, "", "")
+	}
+	for _, kv := range lower.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			_ = upper.Set(k, v)
+		}
+	}
+	if home, err := lower.GetHome(); err == nil {
+		_ = upper.SetHome(home)
+	}
+	if user, err := lower.GetUser(); err == nil {
+		_ = upper.SetUser(user)
+	}
+	if wd, err := lower.Getwd(); err == nil {
+		upper.Setwd(wd)
+	}
+	return &OverlayEnv{
+		envVars:   envVars{env: upper},
+		lower:     lower,
+		upper:     upper,
+		whiteouts: make(map[string]bool),
+	}
+}
+
+func (o *OverlayEnv) Name() string {
+	return "overlay-env"
+}
+
+// Lower returns the read-only base layer.
+func (o *OverlayEnv) Lower() Env {
+	return o.lower
+}
+
+// Upper returns the layer that holds the changes.
+func (o *OverlayEnv) Upper() Env {
+	return o.upper
+}
+
+// ResolvePath returns the absolute form of rel. When follow is true symlinks
+// are resolved against the merged view.
+func (o *OverlayEnv) ResolvePath(rel string, follow bool) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.resolve(rel, follow)
+}
+
+// resolve returns the absolute path of rel with every intermediate symlink
+// resolved in the merged view. The final component is followed only when
+// follow is true. Missing components are appended verbatim.
+func (o *OverlayEnv) resolve(rel string, follow bool) (string, error) {
+	path, err := o.upper.ResolvePath(rel, false)
+	if err != nil {
+		return "", err
+	}
+	sep := string(filepath.Separator)
+	parts := splitPath(path)
+	cur := sep
+	links := 0
+	for i := 0; i < len(parts); i++ {
+		next := filepath.Join(cur, parts[i])
+		if i == len(parts)-1 && !follow {
+			cur = next
+			break
+		}
+		info, layer, err := o.lstat(next)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			cur = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinkDepth {
+			return "", &fs.PathError{Op: "resolve", Path: rel, Err: syscall.ELOOP}
+		}
+		target, err := layer.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(cur, target)
+		}
+		parts = append(splitPath(target), parts[i+1:]...)
+		cur = sep
+		i = -1
+	}
+	return cur, nil
+}
+
+// whited reports whether p or one of its ancestors has been removed from the
+// lower layer.
+func (o *OverlayEnv) whited(p string) bool {
+	for {
+		if o.whiteouts[p] {
+			return true
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return false
+		}
+		p = parent
+	}
+}
+
+// lstat returns the metadata of the resolved path p in the merged view along
+// with the layer holding it.
+func (o *OverlayEnv) lstat(p string) (os.FileInfo, Env, error) {
+	info, err := o.upper.Lstat(p)
+	if err == nil {
+		return info, o.upper, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, syscall.ENOTDIR) {
+		return nil, nil, err
+	}
+	if o.whited(p) {
+		return nil, nil, &fs.PathError{Op: "lstat", Path: p, Err: fs.ErrNotExist}
+	}
+	info, err = o.lower.Lstat(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return info, o.lower, nil
+}
+
+// readDir lists the resolved directory p in the merged view.
+func (o *OverlayEnv) readDir(p string) ([]os.DirEntry, error) {
+	info, layer, err := o.lstat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return layer.ReadDir(p)
+	}
+
+	merged := make(map[string]os.DirEntry)
+	if layer == o.upper {
+		entries, err := o.upper.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			merged[e.Name()] = e
+		}
+	}
+	if !o.whited(p) {
+		if entries, err := o.lower.ReadDir(p); err == nil {
+			for _, e := range entries {
+				if _, ok := merged[e.Name()]; ok || o.whiteouts[filepath.Join(p, e.Name())] {
+					continue
+				}
+				merged[e.Name()] = e
+			}
+		}
+	}
+
+	out := make([]os.DirEntry, 0, len(merged))
+	for _, e := range merged {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out, nil
+}
+
+// ensureUpperDir makes sure the directory p, which must exist in the merged
+// view, exists in the upper layer. Missing directories are copied up with
+// their lower mode.
+func (o *OverlayEnv) ensureUpperDir(p string) error {
+	if _, err := o.upper.Lstat(p); err == nil {
+		return nil
+	}
+	info, _, err := o.lstat(p)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: "mkdir", Path: p, Err: syscall.ENOTDIR}
+	}
+	if parent := filepath.Dir(p); parent != p {
+		if err := o.ensureUpperDir(parent); err != nil {
+			return err
+		}
+	}
+	if err := o.upper.Mkdir(p, info.Mode().Perm(), false); err != nil {
+		return err
+	}
+	return o.upper.Chmod(p, info.Mode()&permBits)
+}
+
+// copyUp copies the resolved path p from the lower layer to the upper layer
+// unless it is already there. Directories are copied without their contents.
+func (o *OverlayEnv) copyUp(p string) error {
+	info, layer, err := o.lstat(p)
+	if err != nil || layer == o.upper {
+		return err
+	}
+	if err := o.ensureUpperDir(filepath.Dir(p)); err != nil {
+		return err
+	}
+
+	mode := info.Mode() & permBits
+	switch {
+	case info.IsDir():
+		return o.ensureUpperDir(p)
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := o.lower.Readlink(p)
+		if err != nil {
+			return err
+		}
+		return o.upper.Symlink(target, p)
+	default:
+		data, err := o.lower.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := o.upper.AtomicWriteFileWithOptions(p, data, mode,
+			&AtomicWriteOptions{ForcePerm: true}); err != nil {
+			return err
+		}
+		return o.upper.Chtimes(p, info.ModTime(), info.ModTime())
+	}
+}
+
+// copyUpTree copies p and everything below it to the upper layer.
+func (o *OverlayEnv) copyUpTree(p string) error {
+	if err := o.copyUp(p); err != nil {
+		return err
+	}
+	info, err := o.upper.Lstat(p)
+	if err != nil || !info.IsDir() {
+		return err
+	}
+	entries, err := o.readDir(p)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := o.copyUpTree(filepath.Join(p, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareWrite resolves rel and readies the upper layer for writing to it:
+// an existing file is copied up and a missing file gets its parent
+// directory copied up.
+func (o *OverlayEnv) prepareWrite(rel string) (string, error) {
+	p, err := o.resolve(rel, true)
+	if err != nil {
+		return "", err
+	}
+	if _, _, err := o.lstat(p); err == nil {
+		return p, o.copyUp(p)
+	}
+	return p, o.ensureUpperDir(filepath.Dir(p))
+}
+
+// mkdirAll creates the resolved directory p and any missing parents in the
+// upper layer.
+func (o *OverlayEnv) mkdirAll(p string, perm os.FileMode) error {
+	info, _, err := o.lstat(p)
+	if err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return &fs.PathError{Op: "mkdir", Path: p, Err: syscall.ENOTDIR}
+	}
+	parent := filepath.Dir(p)
+	if parent != p {
+		if err := o.mkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	if err := o.ensureUpperDir(parent); err != nil {
+		return err
+	}
+	return o.upper.Mkdir(p, perm, false)
+}
+
+// remove deletes the resolved path p from the merged view.
+func (o *OverlayEnv) remove(p string) error {
+	if _, err := o.upper.Lstat(p); err == nil {
+		if err := o.upper.Remove(p, true); err != nil {
+			return err
+		}
+	}
+	prefix := p + string(filepath.Separator)
+	for w := range o.whiteouts {
+		if strings.HasPrefix(w, prefix) {
+			delete(o.whiteouts, w)
+		}
+	}
+	if _, err := o.lower.Lstat(p); err == nil {
+		o.whiteouts[p] = true
+	}
+	return nil
+}
+
+func (o *OverlayEnv) ReadFile(rel string) ([]byte, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve(rel, true)
+	if err != nil {
+		return nil, err
+	}
+	_, layer, err := o.lstat(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: rel, Err: fs.ErrNotExist}
+	}
+	return layer.ReadFile(p)
+}
+
+func (o *OverlayEnv) WriteFile(rel string, data []byte, perm os.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.prepareWrite(rel)
+	if err != nil {
+		return err
+	}
+	return o.upper.WriteFile(p, data, perm)
+}
+
+func (o *OverlayEnv) AtomicWriteFile(rel string, data []byte, perm os.FileMode) error {
+	return o.AtomicWriteFileWithOptions(rel, data, perm, nil)
+}
+
+// AtomicWriteFileWithOptions creates any missing parent directories in the
+// upper layer and atomically replaces the file there. An existing lower file
+// is copied up first so its mode is preserved.
+func (o *OverlayEnv) AtomicWriteFileWithOptions(rel string, data []byte, perm os.FileMode, opts *AtomicWriteOptions) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve(rel, true)
+	if err != nil {
+		return err
+	}
+	if err := o.mkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	if _, err := o.prepareWrite(p); err != nil {
+		return err
+	}
+	return o.upper.AtomicWriteFileWithOptions(p, data, perm, opts)
+}
+
+func (o *OverlayEnv) Mkdir(rel string, perm os.FileMode, all bool) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve(rel, all)
+	if err != nil {
+		return err
+	}
+	if all {
+		return o.mkdirAll(p, perm)
+	}
+	if _, _, err := o.lstat(p); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: rel, Err: fs.ErrExist}
+	}
+	if err := o.ensureUpperDir(filepath.Dir(p)); err != nil {
+		return err
+	}
+	return o.upper.Mkdir(p, perm, false)
+}
+
+// Remove deletes rel from the merged view. Entries that exist in the lower
+// layer are hidden by a whiteout.
+func (o *OverlayEnv) Remove(rel string, all bool) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve(rel, false)
+	if err != nil {
+		return err
+	}
+	info, _, err := o.lstat(p)
+	if err != nil {
+		if all && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return &fs.PathError{Op: "remove", Path: rel, Err: fs.ErrNotExist}
+	}
+	if info.IsDir() && !all {
+		entries, err := o.readDir(p)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: rel, Err: syscall.ENOTEMPTY}
+		}
+	}
+	return o.remove(p)
+}
+
+// Rename copies src up to the upper layer if needed and moves it there. An
+// existing destination file is replaced; an existing destination directory
+// must be empty.
+func (o *OverlayEnv) Rename(src, dst string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s, err := o.resolve(src, false)
+	if err != nil {
+		return err
+	}
+	d, err := o.resolve(dst, false)
+	if err != nil {
+		return err
+	}
+	info, _, err := o.lstat(s)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: fs.ErrNotExist}
+	}
+	if s == d {
+		return nil
+	}
+	if strings.HasPrefix(d, s+string(filepath.Separator)) {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: fs.ErrInvalid}
+	}
+	if dinfo, _, err := o.lstat(d); err == nil {
+		switch {
+		case dinfo.IsDir() && !info.IsDir():
+			return &os.LinkError{Op: "rename", Old: src, New: dst, Err: syscall.EISDIR}
+		case !dinfo.IsDir() && info.IsDir():
+			return &os.LinkError{Op: "rename", Old: src, New: dst, Err: syscall.ENOTDIR}
+		case dinfo.IsDir():
+			entries, err := o.readDir(d)
+			if err != nil {
+				return err
+			}
+			if len(entries) > 0 {
+				return &os.LinkError{Op: "rename", Old: src, New: dst, Err: syscall.ENOTEMPTY}
+			}
+		}
+		if err := o.remove(d); err != nil {
+			return err
+		}
+	}
+
+	if err := o.copyUpTree(s); err != nil {
+		return err
+	}
+	if err := o.ensureUpperDir(filepath.Dir(d)); err != nil {
+		return err
+	}
+	if err := o.upper.Rename(s, d); err != nil {
+		return err
+	}
+	return o.remove(s)
+}
+
+func (o *OverlayEnv) Stat(name string, followSymlinks bool) (os.FileInfo, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve(name, followSymlinks)
+	if err != nil {
+		return nil, err
+	}
+	info, _, err := o.lstat(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return info, nil
+}
+
+func (o *OverlayEnv) Lstat(name string) (os.FileInfo, error) {
+	return o.Stat(name, false)
+}
+
+// ReadDir returns the merged directory listing sorted by name.
+func (o *OverlayEnv) ReadDir(rel string) ([]os.DirEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve(rel, true)
+	if err != nil {
+		return nil, err
+	}
+	return o.readDir(p)
+}
+
+func (o *OverlayEnv) Symlink(oldname, newname string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve(newname, false)
+	if err != nil {
+		return err
+	}
+	if _, _, err := o.lstat(p); err == nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	if err := o.ensureUpperDir(filepath.Dir(p)); err != nil {
+		return err
+	}
+	return o.upper.Symlink(oldname, p)
+}
+
+func (o *OverlayEnv) Readlink(name string) (string, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve(name, false)
+	if err != nil {
+		return "", err
+	}
+	_, layer, err := o.lstat(p)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrNotExist}
+	}
+	return layer.Readlink(p)
+}
+
+func (o *OverlayEnv) Chmod(name string, mode os.FileMode) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve(name, true)
+	if err != nil {
+		return err
+	}
+	if err := o.copyUp(p); err != nil {
+		return err
+	}
+	return o.upper.Chmod(p, mode)
+}
+
+func (o *OverlayEnv) Chown(name string, uid, gid int) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve(name, true)
+	if err != nil {
+		return err
+	}
+	if err := o.copyUp(p); err != nil {
+		return err
+	}
+	return o.upper.Chown(p, uid, gid)
+}
+
+func (o *OverlayEnv) Chtimes(name string, atime, mtime time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p, err := o.resolve(name, true)
+	if err != nil {
+		return err
+	}
+	if err := o.copyUp(p); err != nil {
+		return err
+	}
+	return o.upper.Chtimes(p, atime, mtime)
+}
+
+func (o *OverlayEnv) Open(rel string) (File, error) {
+	return o.OpenFile(rel, os.O_RDONLY, 0)
+}
+
+func (o *OverlayEnv) Create(rel string) (File, error) {
+	return o.OpenFile(rel, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+// OpenFile opens read-only files from whichever layer holds them. Any flag
+// that allows writing copies the file up and opens it in the upper layer.
+func (o *OverlayEnv) OpenFile(rel string, flag int, perm os.FileMode) (File, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if flag&openWriteFlags != 0 {
+		p, err := o.prepareWrite(rel)
+		if err != nil {
+			return nil, err
+		}
+		return o.upper.OpenFile(p, flag, perm)
+	}
+	p, err := o.resolve(rel, true)
+	if err != nil {
+		return nil, err
+	}
+	_, layer, err := o.lstat(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: rel, Err: fs.ErrNotExist}
+	}
+	return layer.OpenFile(p, flag, perm)
+}
+
+// Diff returns the paths whose merged view differs from the lower layer,
+// sorted by path. Directories are compared by mode, files by mode and
+// content and symlinks by target. The contents of added and removed
+// directories are listed individually.
+func (o *OverlayEnv) Diff() ([]Change, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.diff()
+}
+
+func (o *OverlayEnv) diff() ([]Change, error) {
+	// The roots of the two layers are never compared; a scratch directory
+	// rarely has the same mode as the directory it shadows.
+	root := string(filepath.Separator)
+	paths := make(map[string]bool)
+	if err := walkLayer(o.upper, root, func(p string) {
+		if p != root {
+			paths[p] = true
+		}
+	}); err != nil {
+		return nil, err
+	}
+	for w := range o.whiteouts {
+		if err := walkLayer(o.lower, w, func(p string) {
+			paths[p] = true
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	var changes []Change
+	for p := range paths {
+		info, layer, err := o.lstat(p)
+		exists := err == nil
+		base, err := o.lower.Lstat(p)
+		inLower := err == nil
+		switch {
+		case exists && !inLower:
+			changes = append(changes, Change{Path: p, Kind: ChangeAdded})
+		case !exists && inLower:
+			changes = append(changes, Change{Path: p, Kind: ChangeRemoved})
+		case exists && layer == o.upper:
+			same, err := o.sameAsLower(p, info, base)
+			if err != nil {
+				return nil, err
+			}
+			if !same {
+				changes = append(changes, Change{Path: p, Kind: ChangeModified})
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// sameAsLower reports whether the upper entry at p matches the lower one.
+func (o *OverlayEnv) sameAsLower(p string, info, base os.FileInfo) (bool, error) {
+	if info.Mode() != base.Mode() {
+		return false, nil
+	}
+	switch {
+	case info.IsDir():
+		return true, nil
+	case info.Mode()&os.ModeSymlink != 0:
+		a, err := o.upper.Readlink(p)
+		if err != nil {
+			return false, err
+		}
+		b, err := o.lower.Readlink(p)
+		return a == b, err
+	default:
+		if info.Size() != base.Size() {
+			return false, nil
+		}
+		a, err := o.upper.ReadFile(p)
+		if err != nil {
+			return false, err
+		}
+		b, err := o.lower.ReadFile(p)
+		return string(a) == string(b), err
+	}
+}
+
+// walkLayer calls fn for root and every path below it in env without
+// following symlinks. A missing root is not an error.
+func walkLayer(env Env, root string, fn func(p string)) error {
+	info, err := env.Lstat(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	fn(root)
+	if !info.IsDir() {
+		return nil
+	}
+	entries, err := env.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := walkLayer(env, filepath.Join(root, e.Name()), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit applies the changes reported by Diff to the lower layer and then
+// resets the overlay. Files are replaced atomically with their upper mode and
+// modification time. Commit stops at the first error, leaving the changes
+// that were not applied in place.
+func (o *OverlayEnv) Commit() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	changes, err := o.diff()
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		if err := o.apply(c); err != nil {
+			return fmt.Errorf("commit %s %s: %w", c.Kind, c.Path, err)
+		}
+	}
+	return o.reset()
+}
+
+// apply writes a single change to the lower layer. Parents sort before their
+// children, so they are always applied first.
+func (o *OverlayEnv) apply(c Change) error {
+	p := c.Path
+	if c.Kind == ChangeRemoved {
+		return o.lower.Remove(p, true)
+	}
+	info, err := o.upper.Lstat(p)
+	if err != nil {
+		return err
+	}
+	if base, err := o.lower.Lstat(p); err == nil && base.Mode().Type() != info.Mode().Type() {
+		if err := o.lower.Remove(p, true); err != nil {
+			return err
+		}
+	}
+
+	mode := info.Mode() & permBits
+	switch {
+	case info.IsDir():
+		if err := o.lower.Mkdir(p, mode.Perm(), true); err != nil {
+			return err
+		}
+		return o.lower.Chmod(p, mode)
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := o.upper.Readlink(p)
+		if err != nil {
+			return err
+		}
+		if err := o.lower.Remove(p, true); err != nil {
+			return err
+		}
+		return o.lower.Symlink(target, p)
+	default:
+		data, err := o.upper.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := o.lower.AtomicWriteFileWithOptions(p, data, mode,
+			&AtomicWriteOptions{ForcePerm: true}); err != nil {
+			return err
+		}
+		return o.lower.Chtimes(p, info.ModTime(), info.ModTime())
+	}
+}
+
+// Reset discards every change recorded in the upper layer.
+func (o *OverlayEnv) Reset() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.reset()
+}
+
+func (o *OverlayEnv) reset() error {
+	root := string(filepath.Separator)
+	entries, err := o.upper.ReadDir(root)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for _, e := range entries {
+		if err := o.upper.Remove(filepath.Join(root, e.Name()), true); err != nil {
+			return err
+		}
+	}
+	clear(o.whiteouts)
+	return nil
+}
+
+var _ Env = (*OverlayEnv)(nil)
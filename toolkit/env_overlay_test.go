@@ -0,0 +1,162 @@
+package toolkit_test
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedOverlayBase(t *testing.T, env toolkit.Env) {
+	t.Helper()
+	require.NoError(t, env.Mkdir("~/app/conf", 0o755, true))
+	require.NoError(t, env.WriteFile("~/app/conf/app.yaml", []byte("a: 1\n"), 0o644))
+	require.NoError(t, env.WriteFile("~/app/old.txt", []byte("old"), 0o644))
+	require.NoError(t, env.Mkdir("~/app/cache", 0o755, false))
+	require.NoError(t, env.WriteFile("~/app/cache/blob", []byte("blob"), 0o644))
+	require.NoError(t, env.Symlink("conf/app.yaml", "~/app/current"))
+}
+
+func readDirNames(t *testing.T, env toolkit.Env, dir string) []string {
+	t.Helper()
+	entries, err := env.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestOverlayEnv(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			base := newEnv(t)
+			seedOverlayBase(t, base)
+			env := toolkit.NewOverlayEnv(base, nil)
+
+			// Reads fall through to the base, including through symlinks.
+			data, err := env.ReadFile("~/app/current")
+			require.NoError(t, err)
+			assert.Equal(t, "a: 1\n", string(data))
+
+			require.NoError(t, env.WriteFile("~/app/current", []byte("a: 2\n"), 0o644))
+			require.NoError(t, env.WriteFile("~/app/new.txt", []byte("new"), 0o600))
+			require.NoError(t, env.Remove("~/app/cache", true))
+			require.NoError(t, env.Rename("~/app/old.txt", "~/app/conf/moved.txt"))
+			require.NoError(t, env.Chmod("~/app/conf", 0o700))
+
+			data, err = env.ReadFile("~/app/conf/app.yaml")
+			require.NoError(t, err)
+			assert.Equal(t, "a: 2\n", string(data))
+			assert.Equal(t, []string{"conf", "current", "new.txt"}, readDirNames(t, env, "~/app"))
+			assert.Equal(t, []string{"app.yaml", "moved.txt"}, readDirNames(t, env, "~/app/conf"))
+			_, err = env.Stat("~/app/cache/blob", false)
+			require.ErrorIs(t, err, fs.ErrNotExist)
+
+			// The base is untouched.
+			data, err = base.ReadFile("~/app/conf/app.yaml")
+			require.NoError(t, err)
+			assert.Equal(t, "a: 1\n", string(data))
+			assert.Equal(t, []string{"cache", "conf", "current", "old.txt"}, readDirNames(t, base, "~/app"))
+
+			changes, err := env.Diff()
+			require.NoError(t, err)
+			assert.Equal(t, []toolkit.Change{
+				{Path: "/home/testuser/app/cache", Kind: toolkit.ChangeRemoved},
+				{Path: "/home/testuser/app/cache/blob", Kind: toolkit.ChangeRemoved},
+				{Path: "/home/testuser/app/conf", Kind: toolkit.ChangeModified},
+				{Path: "/home/testuser/app/conf/app.yaml", Kind: toolkit.ChangeModified},
+				{Path: "/home/testuser/app/conf/moved.txt", Kind: toolkit.ChangeAdded},
+				{Path: "/home/testuser/app/new.txt", Kind: toolkit.ChangeAdded},
+				{Path: "/home/testuser/app/old.txt", Kind: toolkit.ChangeRemoved},
+			}, changes)
+
+			require.NoError(t, env.Commit())
+			changes, err = env.Diff()
+			require.NoError(t, err)
+			assert.Empty(t, changes)
+
+			assert.Equal(t, []string{"conf", "current", "new.txt"}, readDirNames(t, base, "~/app"))
+			data, err = base.ReadFile("~/app/conf/moved.txt")
+			require.NoError(t, err)
+			assert.Equal(t, "old", string(data))
+			info, err := base.Stat("~/app/new.txt", false)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+			info, err = base.Stat("~/app/conf", false)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+		})
+	}
+}
+
+func TestOverlayEnvWhiteouts(t *testing.T) {
+	t.Parallel()
+
+	base := toolkit.NewMemEnv(nil, "", "")
+	seedOverlayBase(t, base)
+	env := toolkit.NewOverlayEnv(base, nil)
+
+	err := env.Remove("~/app/cache", false)
+	require.Error(t, err, "directory is not empty")
+
+	// A recreated directory does not expose the removed lower contents.
+	require.NoError(t, env.Remove("~/app/cache", true))
+	require.NoError(t, env.Mkdir("~/app/cache", 0o755, false))
+	assert.Empty(t, readDirNames(t, env, "~/app/cache"))
+
+	// Recreating a removed file shows up as a modification.
+	require.NoError(t, env.Remove("~/app/old.txt", false))
+	require.NoError(t, env.WriteFile("~/app/old.txt", []byte("again"), 0o644))
+
+	changes, err := env.Diff()
+	require.NoError(t, err)
+	assert.Equal(t, []toolkit.Change{
+		{Path: "/home/testuser/app/cache/blob", Kind: toolkit.ChangeRemoved},
+		{Path: "/home/testuser/app/old.txt", Kind: toolkit.ChangeModified},
+	}, changes)
+
+	require.NoError(t, env.Reset())
+	data, err := env.ReadFile("~/app/cache/blob")
+	require.NoError(t, err)
+	assert.Equal(t, "blob", string(data))
+}
+
+func TestOverlayEnvScratchUpper(t *testing.T) {
+	t.Parallel()
+
+	base := toolkit.NewTestEnv(t.TempDir(), "", "")
+	seedOverlayBase(t, base)
+	scratch := toolkit.NewTestEnv(t.TempDir(), "", "")
+	env := toolkit.NewOverlayEnv(base, scratch)
+	ctx := toolkit.WithEnv(t.Context(), env)
+
+	require.NoError(t, toolkit.AtomicWriteFile(ctx, "~/app/conf/app.yaml", []byte("a: 3\n"), 0o600))
+	f, err := toolkit.OpenFile(ctx, "~/app/log", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("line\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// Changes land in the scratch directory and the existing mode is kept.
+	data, err := scratch.ReadFile("~/app/log")
+	require.NoError(t, err)
+	assert.Equal(t, "line\n", string(data))
+	info, err := scratch.Stat("~/app/conf/app.yaml", false)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+
+	_, err = base.Stat("~/app/log", false)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.NoError(t, env.Symlink("log", "~/app/log.link"))
+	target, err := env.Readlink("~/app/log.link")
+	require.NoError(t, err)
+	assert.Equal(t, "log", target)
+}
@@ -0,0 +1,228 @@
+package toolkit
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ReadOnlyError is returned by ReadOnlyEnv for every refused mutation. It
+// wraps fs.ErrPermission so callers can use errors.Is.
+type ReadOnlyError struct {
+	// Op is the name of the refused Env method.
+	Op string
+	// Path is the path or, for environment changes, the key involved.
+	Path string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return e.Op + " " + e.Path + ": read-only environment"
+}
+
+func (e *ReadOnlyError) Unwrap() error {
+	return fs.ErrPermission
+}
+
+// ReadOnlyEnv wraps an Env and refuses every mutation with a *ReadOnlyError,
+// except for writes inside an allow-listed subtree such as an application
+// cache directory. The allowed directories themselves cannot be removed or
+// renamed. Reads, lookups and locks go to the wrapped Env unchanged.
+//
+// Unset and Setwd cannot report an error and are ignored. Allowed paths are
+// checked after resolving symlinks, so a link inside an allowed subtree
+// cannot be used to write outside of it.
+type ReadOnlyEnv struct {
+	envVars
+
+	allow []string
+}
+
+// NewReadOnlyEnv returns a ReadOnlyEnv wrapping env. Writes are permitted
+// below each of the allow paths, which are resolved against env.
+func NewReadOnlyEnv(env Env, allow ...string) *ReadOnlyEnv {
+	r := &ReadOnlyEnv{envVars: envVars{env: env}}
+	for _, p := range allow {
+		if resolved, err := env.ResolvePath(p, true); err == nil {
+			r.allow = append(r.allow, resolved)
+		} else if abs, err := env.ResolvePath(p, false); err == nil {
+			r.allow = append(r.allow, abs)
+		}
+	}
+	return r
+}
+
+func (r *ReadOnlyEnv) Name() string {
+	return "read-only-env"
+}
+
+// Unwrap returns the wrapped Env.
+func (r *ReadOnlyEnv) Unwrap() Env {
+	return r.env
+}
+
+// check returns a *ReadOnlyError unless rel is inside an allowed subtree.
+// With below set, rel must be strictly below an allowed path, so that an
+// allowed directory itself cannot be removed or renamed. The parent of rel
+// is always resolved; the final component is resolved only when follow is
+// true and it exists.
+func (r *ReadOnlyEnv) check(op, rel string, follow, below bool) error {
+	p, err := r.env.ResolvePath(rel, false)
+	if err != nil || len(r.allow) == 0 {
+		return &ReadOnlyError{Op: op, Path: rel}
+	}
+	if dir, err := r.env.ResolvePath(filepath.Dir(p), true); err == nil {
+		p = filepath.Join(dir, filepath.Base(p))
+	}
+	if follow {
+		if full, err := r.env.ResolvePath(p, true); err == nil {
+			p = full
+		}
+	}
+	for _, root := range r.allow {
+		if p == root {
+			if !below {
+				return nil
+			}
+			continue
+		}
+		if IsInJail(root, p) {
+			return nil
+		}
+	}
+	return &ReadOnlyError{Op: op, Path: rel}
+}
+
+func (r *ReadOnlyEnv) Set(key, value string) error {
+	return &ReadOnlyError{Op: "Set", Path: key}
+}
+
+// Unset is ignored.
+func (r *ReadOnlyEnv) Unset(key string) {}
+
+func (r *ReadOnlyEnv) SetHome(home string) error {
+	return &ReadOnlyError{Op: "SetHome", Path: home}
+}
+
+func (r *ReadOnlyEnv) SetUser(user string) error {
+	return &ReadOnlyError{Op: "SetUser", Path: user}
+}
+
+// Setwd is ignored.
+func (r *ReadOnlyEnv) Setwd(dir string) {}
+
+func (r *ReadOnlyEnv) ResolvePath(rel string, follow bool) (string, error) {
+	return r.env.ResolvePath(rel, follow)
+}
+
+func (r *ReadOnlyEnv) ReadFile(rel string) ([]byte, error) {
+	return r.env.ReadFile(rel)
+}
+
+func (r *ReadOnlyEnv) WriteFile(rel string, data []byte, perm os.FileMode) error {
+	if err := r.check("WriteFile", rel, true, false); err != nil {
+		return err
+	}
+	return r.env.WriteFile(rel, data, perm)
+}
+
+func (r *ReadOnlyEnv) AtomicWriteFile(rel string, data []byte, perm os.FileMode) error {
+	return r.AtomicWriteFileWithOptions(rel, data, perm, nil)
+}
+
+func (r *ReadOnlyEnv) AtomicWriteFileWithOptions(rel string, data []byte, perm os.FileMode, opts *AtomicWriteOptions) error {
+	if err := r.check("AtomicWriteFile", rel, true, false); err != nil {
+		return err
+	}
+	return r.env.AtomicWriteFileWithOptions(rel, data, perm, opts)
+}
+
+func (r *ReadOnlyEnv) Mkdir(rel string, perm os.FileMode, all bool) error {
+	if err := r.check("Mkdir", rel, false, false); err != nil {
+		return err
+	}
+	return r.env.Mkdir(rel, perm, all)
+}
+
+func (r *ReadOnlyEnv) Remove(rel string, all bool) error {
+	if err := r.check("Remove", rel, false, true); err != nil {
+		return err
+	}
+	return r.env.Remove(rel, all)
+}
+
+// Rename requires both src and dst to be inside allowed subtrees.
+func (r *ReadOnlyEnv) Rename(src, dst string) error {
+	if err := r.check("Rename", src, false, true); err != nil {
+		return err
+	}
+	if err := r.check("Rename", dst, false, true); err != nil {
+		return err
+	}
+	return r.env.Rename(src, dst)
+}
+
+func (r *ReadOnlyEnv) Stat(name string, followSymlinks bool) (os.FileInfo, error) {
+	return r.env.Stat(name, followSymlinks)
+}
+
+func (r *ReadOnlyEnv) Lstat(name string) (os.FileInfo, error) {
+	return r.env.Lstat(name)
+}
+
+func (r *ReadOnlyEnv) ReadDir(rel string) ([]os.DirEntry, error) {
+	return r.env.ReadDir(rel)
+}
+
+func (r *ReadOnlyEnv) Symlink(oldname, newname string) error {
+	if err := r.check("Symlink", newname, false, false); err != nil {
+		return err
+	}
+	return r.env.Symlink(oldname, newname)
+}
+
+func (r *ReadOnlyEnv) Readlink(name string) (string, error) {
+	return r.env.Readlink(name)
+}
+
+func (r *ReadOnlyEnv) Chmod(name string, mode os.FileMode) error {
+	if err := r.check("Chmod", name, true, false); err != nil {
+		return err
+	}
+	return r.env.Chmod(name, mode)
+}
+
+func (r *ReadOnlyEnv) Chown(name string, uid, gid int) error {
+	if err := r.check("Chown", name, true, false); err != nil {
+		return err
+	}
+	return r.env.Chown(name, uid, gid)
+}
+
+func (r *ReadOnlyEnv) Chtimes(name string, atime, mtime time.Time) error {
+	if err := r.check("Chtimes", name, true, false); err != nil {
+		return err
+	}
+	return r.env.Chtimes(name, atime, mtime)
+}
+
+func (r *ReadOnlyEnv) Open(rel string) (File, error) {
+	return r.env.Open(rel)
+}
+
+func (r *ReadOnlyEnv) Create(rel string) (File, error) {
+	return r.OpenFile(rel, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+// OpenFile refuses any flag that allows writing outside the allowed
+// subtrees.
+func (r *ReadOnlyEnv) OpenFile(rel string, flag int, perm os.FileMode) (File, error) {
+	if flag&openWriteFlags != 0 {
+		if err := r.check("OpenFile", rel, true, false); err != nil {
+			return nil, err
+		}
+	}
+	return r.env.OpenFile(rel, flag, perm)
+}
+
+var _ Env = (*ReadOnlyEnv)(nil)
@@ -0,0 +1,73 @@
+package toolkit_test
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyEnv(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			base := newEnv(t)
+			require.NoError(t, base.Mkdir("~/app", 0o755, true))
+			require.NoError(t, base.Mkdir("~/.cache/app", 0o755, true))
+			require.NoError(t, base.WriteFile("~/app/config.yaml", []byte("a: 1"), 0o644))
+			require.NoError(t, base.Symlink("../../app", "~/.cache/app/escape"))
+
+			env := toolkit.NewReadOnlyEnv(base, "~/.cache/app")
+			ctx := toolkit.WithEnv(t.Context(), env)
+
+			data, err := toolkit.ReadFile(ctx, "~/app/config.yaml")
+			require.NoError(t, err)
+			assert.Equal(t, "a: 1", string(data))
+
+			refused := map[string]error{
+				"WriteFile": env.WriteFile("~/app/config.yaml", nil, 0o644),
+				"Atomic":    env.AtomicWriteFile("~/app/new", nil, 0o644),
+				"Mkdir":     env.Mkdir("~/app/sub", 0o755, false),
+				"Remove":    env.Remove("~/app/config.yaml", false),
+				"Rename":    env.Rename("~/.cache/app/x", "~/app/x"),
+				"Symlink":   env.Symlink("x", "~/app/link"),
+				"Chmod":     env.Chmod("~/app/config.yaml", 0o600),
+				"Set":       env.Set("EDITOR", "vi"),
+				"SetHome":   env.SetHome("/elsewhere"),
+				"Through":   env.WriteFile("~/.cache/app/escape/config.yaml", nil, 0o644),
+				"RemoveAll": env.Remove("~/.cache/app", true),
+				"MoveRoot":  env.Rename("~/.cache/app", "~/.cache/app2"),
+			}
+			for op, err := range refused {
+				require.ErrorIs(t, err, fs.ErrPermission, op)
+				var roErr *toolkit.ReadOnlyError
+				require.ErrorAs(t, err, &roErr, op)
+			}
+			_, err = env.OpenFile("~/app/config.yaml", os.O_WRONLY|os.O_APPEND, 0)
+			require.ErrorIs(t, err, fs.ErrPermission)
+
+			// Locking leaves the locked file alone, so it is allowed anywhere.
+			l, err := toolkit.Lock(ctx, "~/app/config.yaml", nil)
+			require.NoError(t, err)
+			require.NoError(t, l.Unlock())
+
+			// The allowed subtree is writable.
+			require.NoError(t, toolkit.WriteFile(ctx, "~/.cache/app/index", []byte("i"), 0o644))
+			require.NoError(t, env.Mkdir("~/.cache/app/blobs", 0o755, false))
+			require.NoError(t, env.Rename("~/.cache/app/index", "~/.cache/app/blobs/index"))
+
+			env.Unset("HOME")
+			home, err := env.GetHome()
+			require.NoError(t, err)
+			assert.Equal(t, "/home/testuser", home)
+			data, err = base.ReadFile("~/app/config.yaml")
+			require.NoError(t, err)
+			assert.Equal(t, "a: 1", string(data))
+		})
+	}
+}
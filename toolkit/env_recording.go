@@ -0,0 +1,488 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+)
+
+// JournalEntry is a single operation recorded by a RecordingEnv. Only the
+// fields that apply to Op are set. Op is the name of the Env or File method,
+// with file methods prefixed by "File.".
+type JournalEntry struct {
+	Seq  int       `json:"seq"`
+	Time time.Time `json:"time"`
+	Op   string    `json:"op"`
+	// File identifies the open file for OpenFile and File.* entries.
+	File int `json:"file,omitempty"`
+
+	Path    string              `json:"path,omitempty"`
+	Target  string              `json:"target,omitempty"`
+	Key     string              `json:"key,omitempty"`
+	Value   string              `json:"value,omitempty"`
+	Data    []byte              `json:"data,omitempty"`
+	Mode    os.FileMode         `json:"mode,omitempty"`
+	Flag    int                 `json:"flag,omitempty"`
+	All     bool                `json:"all,omitempty"`
+	Atime   *time.Time          `json:"atime,omitempty"`
+	Mtime   *time.Time          `json:"mtime,omitempty"`
+	Options *AtomicWriteOptions `json:"options,omitempty"`
+	N       int64               `json:"n,omitempty"`
+	Whence  int                 `json:"whence,omitempty"`
+
+	// Result summarizes what a read returned. Data read by ReadFile is
+	// stored in Data instead.
+	Result string `json:"result,omitempty"`
+	// Err is the innermost error message, which keeps jail paths and
+	// other run specific details out of the journal.
+	Err string `json:"error,omitempty"`
+}
+
+// Journal is an ordered list of recorded operations.
+type Journal []JournalEntry
+
+// WriteJSON writes j to w as indented JSON, one entry per block.
+func (j Journal) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ReadJournal decodes a journal written by Journal.WriteJSON.
+func ReadJournal(r io.Reader) (Journal, error) {
+	var j Journal
+	if err := json.NewDecoder(r).Decode(&j); err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	return j, nil
+}
+
+// DiffJournal compares got against the golden journal want and returns a
+// description of the entries that differ, or an empty string when they
+// match. Each entry is rendered as a single line of JSON prefixed with "-"
+// for want and "+" for got.
+func DiffJournal(want, got Journal) string {
+	var b strings.Builder
+	for i := range max(len(want), len(got)) {
+		var w, g string
+		if i < len(want) {
+			w = journalLine(want[i])
+		}
+		if i < len(got) {
+			g = journalLine(got[i])
+		}
+		if w == g {
+			continue
+		}
+		fmt.Fprintf(&b, "entry %d:\n", i+1)
+		if w != "" {
+			fmt.Fprintf(&b, "- %s\n", w)
+		}
+		if g != "" {
+			fmt.Fprintf(&b, "+ %s\n", g)
+		}
+	}
+	return b.String()
+}
+
+func journalLine(e JournalEntry) string {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Sprintf("%+v", e)
+	}
+	return string(data)
+}
+
+// Replay applies the mutating operations in j to env in order. Reads, files
+// opened read-only and operations that failed while recording are skipped.
+// Replay stops at the first operation that fails.
+func (j Journal) Replay(env Env) error {
+	files := make(map[int]File)
+	defer func() {
+		for _, f := range files {
+			if f != nil {
+				_ = f.Close()
+			}
+		}
+	}()
+
+	for _, e := range j {
+		if e.Err != "" {
+			continue
+		}
+		if err := replayEntry(env, files, e); err != nil {
+			return fmt.Errorf("replay %d %s %s: %w", e.Seq, e.Op, e.Path, err)
+		}
+	}
+	return nil
+}
+
+func replayEntry(env Env, files map[int]File, e JournalEntry) error {
+	switch e.Op {
+	case "WriteFile":
+		return env.WriteFile(e.Path, e.Data, e.Mode)
+	case "AtomicWriteFile":
+		return env.AtomicWriteFileWithOptions(e.Path, e.Data, e.Mode, e.Options)
+	case "Mkdir":
+		return env.Mkdir(e.Path, e.Mode, e.All)
+	case "Remove":
+		return env.Remove(e.Path, e.All)
+	case "Rename":
+		return env.Rename(e.Path, e.Target)
+	case "Symlink":
+		return env.Symlink(e.Target, e.Path)
+	case "Chmod":
+		return env.Chmod(e.Path, e.Mode)
+	case "Chown":
+		var uid, gid int
+		if _, err := fmt.Sscanf(e.Value, "%d:%d", &uid, &gid); err != nil {
+			return err
+		}
+		return env.Chown(e.Path, uid, gid)
+	case "Chtimes":
+		var atime, mtime time.Time
+		if e.Atime != nil {
+			atime = *e.Atime
+		}
+		if e.Mtime != nil {
+			mtime = *e.Mtime
+		}
+		return env.Chtimes(e.Path, atime, mtime)
+	case "Set":
+		return env.Set(e.Key, e.Value)
+	case "Unset":
+		env.Unset(e.Key)
+	case "SetHome":
+		return env.SetHome(e.Value)
+	case "SetUser":
+		return env.SetUser(e.Value)
+	case "Setwd":
+		env.Setwd(e.Path)
+	case "OpenFile":
+		if e.Flag&openWriteFlags == 0 {
+			// Files opened for reading are tracked so their entries
+			// can be skipped.
+			files[e.File] = nil
+			return nil
+		}
+		f, err := env.OpenFile(e.Path, e.Flag, e.Mode)
+		if err != nil {
+			return err
+		}
+		files[e.File] = f
+	case "File.Read", "File.Write", "File.Seek", "File.Close":
+		f, ok := files[e.File]
+		if !ok {
+			return fmt.Errorf("file %d is not open", e.File)
+		}
+		if f == nil {
+			if e.Op == "File.Close" {
+				delete(files, e.File)
+			}
+			return nil
+		}
+		switch e.Op {
+		case "File.Read":
+			_, err := io.CopyN(io.Discard, f, e.N)
+			return err
+		case "File.Write":
+			_, err := f.Write(e.Data)
+			return err
+		case "File.Seek":
+			_, err := f.Seek(e.N, e.Whence)
+			return err
+		default:
+			delete(files, e.File)
+			return f.Close()
+		}
+	}
+	return nil
+}
+
+// RecordingEnv wraps an Env and records every FileSystem operation and every
+// change to the environment variables, home, user and working directory in
+// a Journal. Lookups such as Get and Getwd are passed through without being
+// recorded, since the toolkit's own logging performs them on every call.
+// Timestamps come from the clock in the context given to NewRecordingEnv.
+// RecordingEnv is safe for concurrent use.
+type RecordingEnv struct {
+	envVars
+
+	clock clock.Clock
+
+	mu      sync.Mutex
+	journal Journal
+	files   int
+}
+
+// NewRecordingEnv returns a RecordingEnv wrapping env that timestamps entries
+// with clock.ClockFromContext(ctx).
+func NewRecordingEnv(ctx context.Context, env Env) *RecordingEnv {
+	return &RecordingEnv{
+		envVars: envVars{env: env},
+		clock:   clock.ClockFromContext(ctx),
+	}
+}
+
+func (r *RecordingEnv) Name() string {
+	return "recording-env"
+}
+
+// Unwrap returns the wrapped Env.
+func (r *RecordingEnv) Unwrap() Env {
+	return r.env
+}
+
+// Journal returns a copy of the entries recorded so far.
+func (r *RecordingEnv) Journal() Journal {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append(Journal(nil), r.journal...)
+}
+
+// Reset discards the recorded entries.
+func (r *RecordingEnv) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.journal = nil
+}
+
+// record timestamps e, stores err and appends it to the journal.
+func (r *RecordingEnv) record(e JournalEntry, err error) {
+	e.Time = r.clock.Now()
+	if err != nil {
+		for inner := errors.Unwrap(err); inner != nil; inner = errors.Unwrap(err) {
+			err = inner
+		}
+		e.Err = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.Seq = len(r.journal) + 1
+	r.journal = append(r.journal, e)
+}
+
+// describe summarizes info for JournalEntry.Result. Directory sizes vary
+// between filesystems and are left out.
+func describe(info os.FileInfo) string {
+	if info.IsDir() {
+		return info.Mode().String()
+	}
+	return fmt.Sprintf("%s %d", info.Mode(), info.Size())
+}
+
+func (r *RecordingEnv) Set(key, value string) error {
+	err := r.env.Set(key, value)
+	r.record(JournalEntry{Op: "Set", Key: key, Value: value}, err)
+	return err
+}
+
+func (r *RecordingEnv) Unset(key string) {
+	r.env.Unset(key)
+	r.record(JournalEntry{Op: "Unset", Key: key}, nil)
+}
+
+func (r *RecordingEnv) SetHome(home string) error {
+	err := r.env.SetHome(home)
+	r.record(JournalEntry{Op: "SetHome", Value: home}, err)
+	return err
+}
+
+func (r *RecordingEnv) SetUser(user string) error {
+	err := r.env.SetUser(user)
+	r.record(JournalEntry{Op: "SetUser", Value: user}, err)
+	return err
+}
+
+func (r *RecordingEnv) Setwd(dir string) {
+	r.env.Setwd(dir)
+	r.record(JournalEntry{Op: "Setwd", Path: dir}, nil)
+}
+
+func (r *RecordingEnv) ResolvePath(rel string, follow bool) (string, error) {
+	return r.env.ResolvePath(rel, follow)
+}
+
+func (r *RecordingEnv) ReadFile(rel string) ([]byte, error) {
+	data, err := r.env.ReadFile(rel)
+	r.record(JournalEntry{Op: "ReadFile", Path: rel, Data: data}, err)
+	return data, err
+}
+
+func (r *RecordingEnv) WriteFile(rel string, data []byte, perm os.FileMode) error {
+	err := r.env.WriteFile(rel, data, perm)
+	r.record(JournalEntry{Op: "WriteFile", Path: rel, Data: data, Mode: perm}, err)
+	return err
+}
+
+func (r *RecordingEnv) AtomicWriteFile(rel string, data []byte, perm os.FileMode) error {
+	return r.AtomicWriteFileWithOptions(rel, data, perm, nil)
+}
+
+func (r *RecordingEnv) AtomicWriteFileWithOptions(rel string, data []byte, perm os.FileMode, opts *AtomicWriteOptions) error {
+	err := r.env.AtomicWriteFileWithOptions(rel, data, perm, opts)
+	r.record(JournalEntry{Op: "AtomicWriteFile", Path: rel, Data: data, Mode: perm, Options: opts}, err)
+	return err
+}
+
+func (r *RecordingEnv) Mkdir(rel string, perm os.FileMode, all bool) error {
+	err := r.env.Mkdir(rel, perm, all)
+	r.record(JournalEntry{Op: "Mkdir", Path: rel, Mode: perm, All: all}, err)
+	return err
+}
+
+func (r *RecordingEnv) Remove(rel string, all bool) error {
+	err := r.env.Remove(rel, all)
+	r.record(JournalEntry{Op: "Remove", Path: rel, All: all}, err)
+	return err
+}
+
+func (r *RecordingEnv) Rename(src, dst string) error {
+	err := r.env.Rename(src, dst)
+	r.record(JournalEntry{Op: "Rename", Path: src, Target: dst}, err)
+	return err
+}
+
+// Stat records the follow flag in All.
+func (r *RecordingEnv) Stat(name string, followSymlinks bool) (os.FileInfo, error) {
+	info, err := r.env.Stat(name, followSymlinks)
+	e := JournalEntry{Op: "Stat", Path: name, All: followSymlinks}
+	if err == nil {
+		e.Result = describe(info)
+	}
+	r.record(e, err)
+	return info, err
+}
+
+func (r *RecordingEnv) Lstat(name string) (os.FileInfo, error) {
+	info, err := r.env.Lstat(name)
+	e := JournalEntry{Op: "Lstat", Path: name}
+	if err == nil {
+		e.Result = describe(info)
+	}
+	r.record(e, err)
+	return info, err
+}
+
+// ReadDir records the sorted entry names separated by spaces.
+func (r *RecordingEnv) ReadDir(rel string) ([]os.DirEntry, error) {
+	entries, err := r.env.ReadDir(rel)
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	r.record(JournalEntry{Op: "ReadDir", Path: rel, Result: strings.Join(names, " ")}, err)
+	return entries, err
+}
+
+func (r *RecordingEnv) Symlink(oldname, newname string) error {
+	err := r.env.Symlink(oldname, newname)
+	r.record(JournalEntry{Op: "Symlink", Path: newname, Target: oldname}, err)
+	return err
+}
+
+func (r *RecordingEnv) Readlink(name string) (string, error) {
+	target, err := r.env.Readlink(name)
+	r.record(JournalEntry{Op: "Readlink", Path: name, Result: target}, err)
+	return target, err
+}
+
+func (r *RecordingEnv) Chmod(name string, mode os.FileMode) error {
+	err := r.env.Chmod(name, mode)
+	r.record(JournalEntry{Op: "Chmod", Path: name, Mode: mode}, err)
+	return err
+}
+
+// Chown records the ids in Value as "uid:gid".
+func (r *RecordingEnv) Chown(name string, uid, gid int) error {
+	err := r.env.Chown(name, uid, gid)
+	r.record(JournalEntry{Op: "Chown", Path: name, Value: fmt.Sprintf("%d:%d", uid, gid)}, err)
+	return err
+}
+
+func (r *RecordingEnv) Chtimes(name string, atime, mtime time.Time) error {
+	err := r.env.Chtimes(name, atime, mtime)
+	r.record(JournalEntry{Op: "Chtimes", Path: name, Atime: &atime, Mtime: &mtime}, err)
+	return err
+}
+
+func (r *RecordingEnv) Open(rel string) (File, error) {
+	return r.OpenFile(rel, os.O_RDONLY, 0)
+}
+
+func (r *RecordingEnv) Create(rel string) (File, error) {
+	return r.OpenFile(rel, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+// OpenFile returns a file whose reads, writes, seeks and close are recorded
+// under a file id unique to this RecordingEnv.
+func (r *RecordingEnv) OpenFile(rel string, flag int, perm os.FileMode) (File, error) {
+	f, err := r.env.OpenFile(rel, flag, perm)
+	r.mu.Lock()
+	r.files++
+	id := r.files
+	r.mu.Unlock()
+	r.record(JournalEntry{Op: "OpenFile", File: id, Path: rel, Flag: flag, Mode: perm}, err)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingFile{File: f, env: r, id: id}, nil
+}
+
+// recordingFile records operations on a file opened through a RecordingEnv.
+type recordingFile struct {
+	File
+	env *RecordingEnv
+	id  int
+}
+
+func (f *recordingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	if err == io.EOF {
+		// Reaching the end is not a failure worth replaying.
+		f.env.record(JournalEntry{Op: "File.Read", File: f.id, N: int64(n), Result: "EOF"}, nil)
+		return n, err
+	}
+	f.env.record(JournalEntry{Op: "File.Read", File: f.id, N: int64(n)}, err)
+	return n, err
+}
+
+func (f *recordingFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.env.record(JournalEntry{Op: "File.Write", File: f.id, Data: bytes.Clone(p[:n])}, err)
+	return n, err
+}
+
+func (f *recordingFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.File.Seek(offset, whence)
+	f.env.record(JournalEntry{
+		Op:     "File.Seek",
+		File:   f.id,
+		N:      offset,
+		Whence: whence,
+		Result: fmt.Sprint(pos),
+	}, err)
+	return pos, err
+}
+
+func (f *recordingFile) Close() error {
+	err := f.File.Close()
+	f.env.record(JournalEntry{Op: "File.Close", File: f.id}, err)
+	return err
+}
+
+var _ Env = (*RecordingEnv)(nil)
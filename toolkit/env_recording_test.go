@@ -0,0 +1,136 @@
+package toolkit_test
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+// recordSession runs a fixed set of operations through a RecordingEnv over
+// a MemEnv and returns it.
+func recordSession(t *testing.T) *toolkit.RecordingEnv {
+	t.Helper()
+	clk := clock.NewTestClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx := clock.WithClock(t.Context(), clk)
+	env := toolkit.NewRecordingEnv(ctx, toolkit.NewMemEnv(clk, "", ""))
+	ctx = toolkit.WithEnv(ctx, env)
+
+	require.NoError(t, toolkit.Mkdir(ctx, "~/app", 0o755, true))
+	clk.Advance(time.Second)
+	require.NoError(t, toolkit.AtomicWriteFile(ctx, "~/app/config.yaml", []byte("a: 1\n"), 0o600))
+	require.NoError(t, env.Set("EDITOR", "vi"))
+	_, err := toolkit.ReadFile(ctx, "~/app/missing")
+	require.Error(t, err)
+
+	f, err := toolkit.Create(ctx, "~/app/log")
+	require.NoError(t, err)
+	_, err = io.WriteString(f, "one\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, toolkit.Rename(ctx, "~/app/log", "~/app/log.1"))
+	require.NoError(t, toolkit.Symlink(ctx, "config.yaml", "~/app/current"))
+	_, err = toolkit.ReadDir(ctx, "~/app")
+	require.NoError(t, err)
+	return env
+}
+
+func TestRecordingEnvJournal(t *testing.T) {
+	t.Parallel()
+
+	journal := recordSession(t).Journal()
+	require.Len(t, journal, 10)
+	assert.Equal(t, toolkit.JournalEntry{
+		Seq:  4,
+		Time: time.Date(2025, 1, 1, 0, 0, 1, 0, time.UTC),
+		Op:   "ReadFile",
+		Path: "~/app/missing",
+		Err:  "file does not exist",
+	}, journal[3])
+	assert.Equal(t, "File.Write", journal[5].Op)
+	assert.Equal(t, journal[4].File, journal[5].File)
+	assert.Equal(t, "config.yaml current log.1", journal[9].Result)
+
+	var buf bytes.Buffer
+	require.NoError(t, journal.WriteJSON(&buf))
+	decoded, err := toolkit.ReadJournal(&buf)
+	require.NoError(t, err)
+	assert.Empty(t, toolkit.DiffJournal(journal, decoded))
+
+	changed := append(toolkit.Journal(nil), journal...)
+	changed[1].Mode = 0o644
+	assert.Contains(t, toolkit.DiffJournal(journal, changed), "entry 2:\n- ")
+}
+
+func TestRecordingEnvLockIsNotJournaled(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			env := toolkit.NewRecordingEnv(t.Context(), newEnv(t))
+			ctx := toolkit.WithEnv(t.Context(), env)
+
+			l, err := toolkit.Lock(ctx, "~/app/config.yaml", nil)
+			require.NoError(t, err)
+			require.NoError(t, l.Unlock())
+			l, err = toolkit.Lock(ctx, "~/app/config.yaml", &toolkit.LockOptions{Shared: true})
+			require.NoError(t, err)
+			require.NoError(t, l.Unlock())
+			assert.Empty(t, env.Journal())
+		})
+	}
+}
+
+func TestRecordingEnvGolden(t *testing.T) {
+	t.Parallel()
+
+	var got bytes.Buffer
+	require.NoError(t, recordSession(t).Journal().WriteJSON(&got))
+
+	golden := filepath.Join("testdata", "recording.golden.json")
+	if *updateGolden {
+		require.NoError(t, os.MkdirAll("testdata", 0o755))
+		require.NoError(t, os.WriteFile(golden, got.Bytes(), 0o644))
+	}
+	f, err := os.Open(golden)
+	require.NoError(t, err)
+	defer f.Close()
+	want, err := toolkit.ReadJournal(f)
+	require.NoError(t, err)
+	gotJournal, err := toolkit.ReadJournal(&got)
+	require.NoError(t, err)
+	if diff := toolkit.DiffJournal(want, gotJournal); diff != "" {
+		t.Errorf("journal differs from %s (run with -update to accept):\n%s", golden, diff)
+	}
+}
+
+func TestJournalReplay(t *testing.T) {
+	t.Parallel()
+
+	journal := recordSession(t).Journal()
+	target := toolkit.NewTestEnv(t.TempDir(), "", "")
+	require.NoError(t, journal.Replay(target))
+
+	data, err := target.ReadFile("~/app/current")
+	require.NoError(t, err)
+	assert.Equal(t, "a: 1\n", string(data))
+	info, err := target.Stat("~/app/config.yaml", false)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	data, err = target.ReadFile("~/app/log.1")
+	require.NoError(t, err)
+	assert.Equal(t, "one\n", string(data))
+	assert.Equal(t, "vi", target.Get("EDITOR"))
+}
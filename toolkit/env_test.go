@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/jlrickert/cli-toolkit/clock"
 	"github.com/jlrickert/cli-toolkit/toolkit"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -89,3 +90,21 @@ func TestExpandEnv(t *testing.T) {
 	got3 := toolkit.ExpandEnv(context.Background(), "$"+oskey)
 	assert.Equal(t, "osval", got3)
 }
+
+// The TZ of the injected Env decides the location, so zones can differ per
+// test without touching time.Local.
+func TestWithEnvSetsLocation(t *testing.T) {
+	t.Parallel()
+	for _, tz := range []string{"Europe/Berlin", "Australia/Sydney", ""} {
+		env := toolkit.NewTestEnv(t.TempDir(), "", "")
+		require.NoError(t, env.Set("TZ", tz))
+		ctx := toolkit.WithEnv(context.Background(), env)
+
+		want := tz
+		if tz == "" {
+			want = "UTC"
+		}
+		assert.Equal(t, want, clock.Location(ctx).String())
+		assert.Equal(t, want, clock.LocalNow(ctx).Location().String())
+	}
+}
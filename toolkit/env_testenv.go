@@ -3,12 +3,18 @@ package toolkit
 import (
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"maps"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
 )
 
 // TestEnv is an in-memory Env implementation useful for tests. It does not
@@ -22,6 +28,13 @@ type TestEnv struct {
 	home string // home is an absolute path. Doesn't include the jail
 	user string
 	data map[string]string
+
+	// locks backs TryLock. It is shared with clones.
+	locks *lockTable
+
+	// watch delivers events to watchers from NewWatcher. It is shared with
+	// clones.
+	watch *watchHub
 }
 
 func (o *TestEnv) Name() string {
@@ -57,10 +70,12 @@ func NewTestEnv(jail, home, username string) *TestEnv {
 	}
 
 	m := &TestEnv{
-		jail: jail,
-		home: home,
-		user: username,
-		data: make(map[string]string),
+		jail:  jail,
+		home:  home,
+		user:  username,
+		data:  make(map[string]string),
+		locks: newLockTable(),
+		watch: newWatchHub(),
 	}
 
 	// Always expose HOME and USER through the map as well for callers that read
@@ -314,109 +329,103 @@ func (m *TestEnv) Setwd(dir string) {
 }
 
 // ReadFile reads the named file from the filesystem view held by this TestEnv.
-// When the receiver is nil the real filesystem is used.
+// Symlinks are resolved inside the jail.
 func (m *TestEnv) ReadFile(rel string) ([]byte, error) {
-	resolved, err := m.ResolvePath(rel, false)
+	path, err := m.jailPath("ReadFile", rel, true)
 	if err != nil {
 		return nil, err
 	}
-	path := filepath.Join(m.jail, resolved)
-	if !IsInJail(m.jail, path) {
-		return nil, fmt.Errorf("ReadFile outside of jail %s: %w", path, ErrEscapeAttempt)
-	}
 	return os.ReadFile(path)
 }
 
 // Remove removes the named file or directory. If all is true RemoveAll is used.
-// When the receiver is nil the real filesystem is affected.
+// A symlink is removed itself rather than its target.
 func (m *TestEnv) Remove(rel string, all bool) error {
-	path, err := m.ResolvePath(rel, false)
+	path, err := m.jailPath("Remove", rel, false)
 	if err != nil {
 		return err
 	}
-	path = filepath.Join(m.jail, path)
-	if !IsInJail(m.jail, path) {
-		return fmt.Errorf("Remove outside of jail %s: %w", path, ErrEscapeAttempt)
-	}
 	if all {
-		return os.RemoveAll(path)
+		err = os.RemoveAll(path)
+	} else {
+		err = os.Remove(path)
+	}
+	if err == nil {
+		m.notify(rel, WatchRemove)
 	}
-	return os.Remove(path)
+	return err
 }
 
-// Rename renames (moves) a file or directory. When the receiver is nil the
-// operation is performed on the real filesystem.
+// Rename renames (moves) a file or directory. Neither the source nor the
+// destination final component is followed when it is a symlink.
 func (m *TestEnv) Rename(src string, dst string) error {
-	a, err := m.ResolvePath(src, false)
+	a, err := m.jailPath("Rename src", src, false)
 	if err != nil {
 		return err
 	}
-	a = filepath.Join(m.jail, a)
-	if !IsInJail(m.jail, a) {
-		return fmt.Errorf("Rename src outside of jail %s: %w", a, ErrEscapeAttempt)
-	}
-	b, err := m.ResolvePath(dst, false)
+	b, err := m.jailPath("Rename dst", dst, false)
 	if err != nil {
 		return err
 	}
-	b = filepath.Join(m.jail, b)
-	if !IsInJail(m.jail, b) {
-		return fmt.Errorf("Rename dst outside of jail %s, %w", b, ErrEscapeAttempt)
+	if err := os.Rename(a, b); err != nil {
+		return err
 	}
-	return os.Rename(a, b)
+	m.notify(src, WatchRename)
+	m.notify(dst, WatchCreate)
+	return nil
 }
 
 // Mkdir creates a directory. If all is true MkdirAll is used.
 func (m *TestEnv) Mkdir(rel string, perm os.FileMode, all bool) error {
-	resolved, err := m.ResolvePath(rel, false)
+	p, err := m.jailPath("Mkdir", rel, false)
 	if err != nil {
 		return err
 	}
-	p := filepath.Join(m.jail, resolved)
-	if !IsInJail(m.jail, p) {
-		return fmt.Errorf("Mkdir outside of jail: %s, %w", p, ErrEscapeAttempt)
-	}
+	op := m.createOp(p)
 	if all {
-		return os.MkdirAll(p, perm)
+		err = os.MkdirAll(p, perm)
+	} else {
+		err = os.Mkdir(p, perm)
 	}
-	return os.Mkdir(p, perm)
+	if err == nil && op == WatchCreate {
+		m.notify(rel, op)
+	}
+	return err
 }
 
 // WriteFile writes data to a file in the filesystem view held by this TestEnv.
+// Writing through a symlink is allowed as long as the target is in the jail.
 func (m *TestEnv) WriteFile(name string, data []byte, perm os.FileMode) error {
-	p, err := m.ResolvePath(name, false)
+	path, err := m.jailPath("WriteFile", name, true)
 	if err != nil {
 		return err
 	}
-	path := filepath.Join(m.jail, p)
-	if !IsInJail(m.jail, path) {
-		return fmt.Errorf("WriteFile outside of jail %s: %w", path, ErrEscapeAttempt)
+	op := m.createOp(path)
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return err
 	}
-	return os.WriteFile(path, data, perm)
+	m.notify(name, op)
+	return nil
 }
 
 // ReadDir implements FileSystem.
 func (m *TestEnv) ReadDir(name string) ([]os.DirEntry, error) {
-	p, err := m.ResolvePath(name, false)
+	p, err := m.jailPath("ReadDir", name, true)
 	if err != nil {
 		return nil, err
 	}
-	p = filepath.Join(m.jail, p)
-	if !IsInJail(m.jail, p) {
-		return nil, fmt.Errorf("ReadDir outside of jail %s: %w", p, ErrEscapeAttempt)
-	}
 	return os.ReadDir(p)
 }
 
-// Stat implements FileSystem.
+// Stat implements FileSystem. When followSymlinks is false the final symlink
+// is described rather than its target.
 func (m *TestEnv) Stat(rel string, followSymlinks bool) (os.FileInfo, error) {
-	path, err := m.ResolvePath(rel, followSymlinks)
+	path, err := m.jailPath("Stat", rel, followSymlinks)
 	if err != nil {
 		return nil, err
 	}
-	path = filepath.Join(m.jail, path)
-	if !IsInJail(m.jail, path) {
-		return nil, fmt.Errorf("Stat outside of jail %s: %w", path, ErrEscapeAttempt)
+	if !followSymlinks {
+		return os.Lstat(path)
 	}
 	return os.Stat(path)
 }
@@ -456,6 +465,10 @@ func (m *TestEnv) ExpandPath(p string) string {
 	return p
 }
 
+// ResolvePath returns the absolute path of rel as seen inside the jail. When
+// follow is true symlinks are resolved component by component against the
+// jail root and an error wrapping ErrEscapeAttempt is returned if a link
+// points outside of it.
 func (m *TestEnv) ResolvePath(rel string, follow bool) (string, error) {
 	p := filepath.Clean(rel)
 	if p == "." || p == "" {
@@ -480,16 +493,188 @@ func (m *TestEnv) ResolvePath(rel string, follow bool) (string, error) {
 		return filepath.Clean(path), nil
 	}
 
-	resolved, err := filepath.EvalSymlinks(filepath.Join(m.jail, path))
+	if m.jail == "" {
+		return filepath.EvalSymlinks(path)
+	}
+	resolved, err := m.resolveInJail(filepath.Clean(path), true)
 	if err != nil {
+		return "", fmt.Errorf("ResolvePath %s: %w", path, err)
+	}
+	if _, err := os.Lstat(resolved); err != nil {
 		return "", err
 	}
 	return RemoveJailPrefix(m.jail, resolved), nil
 }
 
+// Readlink returns the destination of the named symbolic link. Absolute
+// destinations inside the jail are returned without the jail prefix.
+func (m *TestEnv) Readlink(rel string) (string, error) {
+	path, err := m.jailPath("Readlink", rel, false)
+	if err != nil {
+		return "", err
+	}
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", err
+	}
+	if m.jail != "" && filepath.IsAbs(target) && IsInJail(m.jail, target) {
+		return RemoveJailPrefix(m.jail, target), nil
+	}
+	return target, nil
+}
+
+// Chtimes changes the access and modification times of the named file inside
+// the jail.
+func (m *TestEnv) Chtimes(rel string, atime, mtime time.Time) error {
+	path, err := m.jailPath("Chtimes", rel, true)
+	if err != nil {
+		return err
+	}
+	if err := os.Chtimes(path, atime, mtime); err != nil {
+		return err
+	}
+	m.notify(rel, WatchChmod)
+	return nil
+}
+
+// Chmod changes the mode of the named file inside the jail.
+func (m *TestEnv) Chmod(rel string, mode os.FileMode) error {
+	path, err := m.jailPath("Chmod", rel, true)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+	m.notify(rel, WatchChmod)
+	return nil
+}
+
+// Chown changes the numeric uid and gid of the named file inside the jail.
+func (m *TestEnv) Chown(rel string, uid, gid int) error {
+	path, err := m.jailPath("Chown", rel, true)
+	if err != nil {
+		return err
+	}
+	if err := os.Chown(path, uid, gid); err != nil {
+		return err
+	}
+	m.notify(rel, WatchChmod)
+	return nil
+}
+
+// Lstat returns the os.FileInfo for the named file inside the jail without
+// following a final symlink.
+func (m *TestEnv) Lstat(rel string) (os.FileInfo, error) {
+	return m.Stat(rel, false)
+}
+
+// TryLock implements Locker using an in-process lock table so lock
+// contention can be tested without lock files. A TestEnv not created by
+// NewTestEnv falls back to lock files inside the jail.
+func (m *TestEnv) TryLock(path string, shared bool) (func() error, error) {
+	resolved, err := m.ResolvePath(path, false)
+	if err != nil {
+		return nil, err
+	}
+	if m.locks == nil {
+		// The lock files live on the host, so their mtimes follow the
+		// OS clock.
+		return lockFileTryLock(m, clock.OsClock{}, resolved, shared)
+	}
+	return m.locks.tryLock(resolved, shared)
+}
+
+// jailPath converts rel into a real path inside the jail suitable for passing
+// to the os package. Every existing path component is checked on disk and
+// symlinks are resolved against the jail root; the final component is only
+// followed when follow is true. Any attempt to leave the jail returns an
+// error wrapping ErrEscapeAttempt that names op.
+//
+// The check and the subsequent os call are not atomic. TestEnv guards against
+// accidental escapes in tests, not against a concurrent adversary.
+func (m *TestEnv) jailPath(op, rel string, follow bool) (string, error) {
+	resolved, err := m.ResolvePath(rel, false)
+	if err != nil {
+		return "", err
+	}
+	if m.jail == "" {
+		return resolved, nil
+	}
+	path, err := m.resolveInJail(resolved, follow)
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w", op, resolved, err)
+	}
+	if !IsInJail(m.jail, path) {
+		return "", fmt.Errorf("%s outside of jail %s: %w", op, path, ErrEscapeAttempt)
+	}
+	return path, nil
+}
+
+// resolveInJail walks the absolute jail relative path one component at a time
+// and returns the real path it refers to. Symlinks with absolute targets must
+// point inside the jail and relative targets may not climb above the jail
+// root; otherwise an error wrapping ErrEscapeAttempt is returned. Components
+// that do not exist are appended verbatim.
+func (m *TestEnv) resolveInJail(path string, follow bool) (string, error) {
+	sep := string(filepath.Separator)
+	parts := splitPath(path)
+	cur := ""
+	links := 0
+	for i := 0; i < len(parts); i++ {
+		next := filepath.Join(cur, parts[i])
+		last := i == len(parts)-1
+		if last && !follow {
+			cur = next
+			break
+		}
+		real := filepath.Join(m.jail, next)
+		fi, err := os.Lstat(real)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			cur = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinkDepth {
+			return "", &fs.PathError{Op: "resolve", Path: path, Err: syscall.ELOOP}
+		}
+		target, err := os.Readlink(real)
+		if err != nil {
+			return "", err
+		}
+		var base string
+		if filepath.IsAbs(target) {
+			if !IsInJail(m.jail, target) {
+				return "", fmt.Errorf("symlink %s -> %s: %w",
+					sep+next, target, ErrEscapeAttempt)
+			}
+			base = strings.TrimPrefix(RemoveJailPrefix(m.jail, target), sep)
+		} else {
+			base = filepath.Join(cur, target)
+			if escapesRoot(base) {
+				return "", fmt.Errorf("symlink %s -> %s: %w",
+					sep+next, target, ErrEscapeAttempt)
+			}
+		}
+		rest := parts[i+1:]
+		parts = append(splitPath(sep+base), rest...)
+		cur = ""
+		i = -1
+	}
+	return filepath.Join(m.jail, sep+cur), nil
+}
+
+// escapesRoot reports whether the relative path p climbs above its root.
+func escapesRoot(p string) bool {
+	p = filepath.Clean(p)
+	return p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator))
+}
+
 // Clone returns a copy of the TestEnv so tests can modify the returned
 // environment without mutating the original. It deep copies the internal map
-// and makes a copy of the Stream struct.
+// and shares the jail, lock table and watchers. Use Snapshot to also copy the
+// jail contents.
 func (m *TestEnv) Clone() *TestEnv {
 	if m == nil {
 		return nil
@@ -502,58 +687,159 @@ func (m *TestEnv) Clone() *TestEnv {
 	}
 
 	return &TestEnv{
-		home: m.home,
-		user: m.user,
-		data: dataCopy,
+		jail:  m.jail,
+		home:  m.home,
+		user:  m.user,
+		data:  dataCopy,
+		locks: m.locks,
+		watch: m.watch,
 	}
 }
 
-func (o *TestEnv) Symlink(oldname string, newname string) error {
-	oldPath := o.ExpandPath(oldname)
-	newPath := o.ExpandPath(newname)
-	return os.Symlink(oldPath, newPath)
+// Symlink creates newname inside the jail as a symbolic link to oldname.
+// Absolute targets are stored with the jail prefix so the link also resolves
+// correctly for tools that are not jail aware. Relative targets are stored
+// verbatim but may not climb above the jail root.
+func (m *TestEnv) Symlink(oldname string, newname string) error {
+	newPath, err := m.jailPath("Symlink", newname, false)
+	if err != nil {
+		return err
+	}
+	target := m.ExpandPath(oldname)
+	if m.jail != "" {
+		if filepath.IsAbs(target) {
+			target = filepath.Join(m.jail, target)
+		} else {
+			dir := filepath.Dir(RemoveJailPrefix(m.jail, newPath))
+			dir = strings.TrimPrefix(dir, string(filepath.Separator))
+			if escapesRoot(filepath.Join(dir, target)) {
+				return fmt.Errorf("Symlink target outside of jail %s: %w", oldname, ErrEscapeAttempt)
+			}
+		}
+	}
+	if err := os.Symlink(target, newPath); err != nil {
+		return err
+	}
+	m.notify(newname, WatchCreate)
+	return nil
 }
 
 func (m *TestEnv) AtomicWriteFile(rel string, data []byte, perm os.FileMode) error {
-	resolved, err := m.ResolvePath(rel, false)
+	return m.AtomicWriteFileWithOptions(rel, data, perm, nil)
+}
+
+// AtomicWriteFileWithOptions durably replaces the named file inside the
+// jail. The temporary file and any backup are created next to the target so
+// nothing is written outside the jail.
+func (m *TestEnv) AtomicWriteFileWithOptions(rel string, data []byte, perm os.FileMode, opts *AtomicWriteOptions) error {
+	path, err := m.jailPath("AtomicWriteFile", rel, true)
 	if err != nil {
 		return err
 	}
-	path := filepath.Join(m.jail, resolved)
-	if !IsInJail(m.jail, path) {
-		return fmt.Errorf("AtomicWriteFile outside of jail %s: %w", path, ErrEscapeAttempt)
+	op := m.createOp(path)
+	if err := atomicWriteFile(path, data, perm, opts); err != nil {
+		return err
 	}
+	m.notify(rel, op)
+	return nil
+}
 
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return fmt.Errorf("atomic write: mkdirall %q: %w", dir, err)
-	}
+// Open opens the named file inside the jail for reading.
+func (m *TestEnv) Open(rel string) (File, error) {
+	return m.OpenFile(rel, os.O_RDONLY, 0)
+}
 
-	tmpFile, err := os.CreateTemp("", ".tmp-"+filepath.Base(path)+".*")
+// Create creates or truncates the named file inside the jail.
+func (m *TestEnv) Create(rel string) (File, error) {
+	return m.OpenFile(rel, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+// OpenFile opens the named file inside the jail with the given flags and
+// permissions. The returned File reports its name without the jail prefix.
+func (m *TestEnv) OpenFile(rel string, flag int, perm os.FileMode) (File, error) {
+	resolved, err := m.ResolvePath(rel, false)
+	if err != nil {
+		return nil, err
+	}
+	path, err := m.jailPath("OpenFile", rel, true)
 	if err != nil {
-		return fmt.Errorf("atomic write: create temp file: %w", err)
+		return nil, err
 	}
-	tmpName := tmpFile.Name()
-	defer os.Remove(tmpName)
+	op := m.createOp(path)
+	f, err := os.OpenFile(path, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if op == WatchCreate && flag&os.O_CREATE != 0 {
+		m.notify(rel, WatchCreate)
+	} else if flag&os.O_TRUNC != 0 && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		m.notify(rel, WatchWrite)
+	}
+	return &jailFile{File: f, name: resolved, env: m}, nil
+}
+
+// NewWatcher implements WatcherProvider. Events for changes made through
+// this TestEnv, or a clone of it, are queued before the changing call
+// returns, which keeps tests deterministic. Changes made to the jail by
+// other means are not seen; use a polling watcher for those.
+func (m *TestEnv) NewWatcher(opts *WatchOptions) (Watcher, error) {
+	if m.watch == nil {
+		return nil, fmt.Errorf("watch: %w", errors.ErrUnsupported)
+	}
+	return m.watch.newWatcher(m, opts), nil
+}
 
-	if _, err := tmpFile.Write(data); err != nil {
-		_ = tmpFile.Close()
-		return fmt.Errorf("atomic write: write temp file %q: %w", tmpName, err)
+// createOp returns the event a write to the jailed path will produce.
+func (m *TestEnv) createOp(path string) WatchOp {
+	if _, err := os.Lstat(path); err != nil {
+		return WatchCreate
 	}
+	return WatchWrite
+}
 
-	if err := tmpFile.Close(); err != nil {
-		return fmt.Errorf("atomic write: close temp file %q: %w", tmpName, err)
+// notify reports a change to rel to the watchers of this TestEnv.
+func (m *TestEnv) notify(rel string, op WatchOp) {
+	if m.watch == nil {
+		return
+	}
+	if p, err := m.ResolvePath(rel, false); err == nil {
+		m.watch.notify(p, op)
 	}
+}
+
+// jailFile wraps an *os.File opened by TestEnv so Name hides the jail.
+type jailFile struct {
+	*os.File
+	name string
+	env  *TestEnv
+}
 
-	if err := os.Chmod(tmpName, perm); err != nil {
-		// Not fatal: continue anyway
+// Write writes to the file and reports the change to watchers.
+func (f *jailFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	if n > 0 {
+		f.env.notify(f.name, WatchWrite)
 	}
+	return n, err
+}
 
-	if err := os.Rename(tmpName, path); err != nil {
-		return fmt.Errorf("atomic write: rename %q -> %q: %w", tmpName, path, err)
+// WriteString writes s to the file and reports the change to watchers.
+func (f *jailFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// ReadFrom implements io.ReaderFrom and reports the change to watchers.
+func (f *jailFile) ReadFrom(r io.Reader) (int64, error) {
+	n, err := f.File.ReadFrom(r)
+	if n > 0 {
+		f.env.notify(f.name, WatchWrite)
 	}
+	return n, err
+}
 
-	return nil
+// Name returns the path of the file relative to the jail root.
+func (f *jailFile) Name() string {
+	return f.name
 }
 
 // Ensure implementations satisfy the interfaces.
@@ -0,0 +1,294 @@
+package toolkit_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEscapeEnv returns a TestEnv whose jail sits next to an "outside"
+// directory containing a secret file, plus the path of that directory.
+func newEscapeEnv(t *testing.T) (*toolkit.TestEnv, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("symlink escape tests require unix symlinks")
+	}
+	base := t.TempDir()
+	jail := filepath.Join(base, "jail")
+	outside := filepath.Join(base, "outside")
+	require.NoError(t, os.MkdirAll(filepath.Join(jail, "home", "testuser"), 0o755))
+	require.NoError(t, os.MkdirAll(outside, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0o644))
+	return toolkit.NewTestEnv(jail, "", ""), outside
+}
+
+// plant creates a raw symlink inside the jail, bypassing TestEnv checks, the
+// way a fixture or an external tool could.
+func plant(t *testing.T, env *toolkit.TestEnv, target, link string) {
+	t.Helper()
+	require.NoError(t, os.Symlink(target, filepath.Join(env.GetJail(), link)))
+}
+
+func TestTestEnvJailEscapeVectors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, env *toolkit.TestEnv, outside string)
+		op    func(env *toolkit.TestEnv) error
+	}{
+		{
+			name: "read through absolute dir link",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, outside, "home/testuser/out")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				_, err := env.ReadFile("out/secret")
+				return err
+			},
+		},
+		{
+			name: "read through final file link",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, filepath.Join(outside, "secret"), "home/testuser/s")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				_, err := env.ReadFile("s")
+				return err
+			},
+		},
+		{
+			name: "relative link climbing above the jail",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, "../../../outside", "home/testuser/up")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				_, err := env.ReadFile("up/secret")
+				return err
+			},
+		},
+		{
+			name: "chained links",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, outside, "home/testuser/b")
+				plant(t, env, "b", "home/testuser/a")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				_, err := env.ReadFile("a/secret")
+				return err
+			},
+		},
+		{
+			name: "write through dir link",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, outside, "home/testuser/out")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				return env.WriteFile("out/pwned", []byte("x"), 0o644)
+			},
+		},
+		{
+			name: "write through dangling final link",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, filepath.Join(outside, "pwned"), "home/testuser/p")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				return env.WriteFile("p", []byte("x"), 0o644)
+			},
+		},
+		{
+			name: "atomic write through dir link",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, outside, "home/testuser/out")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				return env.AtomicWriteFile("out/pwned", []byte("x"), 0o644)
+			},
+		},
+		{
+			name: "open file through dir link",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, outside, "home/testuser/out")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				_, err := env.OpenFile("out/pwned", os.O_CREATE|os.O_WRONLY, 0o644)
+				return err
+			},
+		},
+		{
+			name: "mkdir through dir link",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, outside, "home/testuser/out")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				return env.Mkdir("out/pwned/deeper", 0o755, true)
+			},
+		},
+		{
+			name: "remove through dir link",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, outside, "home/testuser/out")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				return env.Remove("out/secret", false)
+			},
+		},
+		{
+			name: "rename into dir link",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, outside, "home/testuser/out")
+				require.NoError(t, env.WriteFile("f", []byte("x"), 0o644))
+			},
+			op: func(env *toolkit.TestEnv) error {
+				return env.Rename("f", "out/pwned")
+			},
+		},
+		{
+			name: "read dir through link",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, outside, "home/testuser/out")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				_, err := env.ReadDir("out")
+				return err
+			},
+		},
+		{
+			name: "stat following link",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, outside, "home/testuser/out")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				_, err := env.Stat("out", true)
+				return err
+			},
+		},
+		{
+			name: "resolve path following link",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, outside, "home/testuser/out")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				_, err := env.ResolvePath("out/secret", true)
+				return err
+			},
+		},
+		{
+			name: "chmod through dir link",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, outside, "home/testuser/out")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				return env.Chmod("out/secret", 0o777)
+			},
+		},
+		{
+			name: "readlink through dir link",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {
+				plant(t, env, outside, "home/testuser/out")
+			},
+			op: func(env *toolkit.TestEnv) error {
+				_, err := env.Readlink("out/secret")
+				return err
+			},
+		},
+		{
+			name:  "symlink with relative target above the jail",
+			setup: func(t *testing.T, env *toolkit.TestEnv, outside string) {},
+			op: func(env *toolkit.TestEnv) error {
+				return env.Symlink("../../../outside", "up")
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			env, outside := newEscapeEnv(t)
+			tc.setup(t, env, outside)
+
+			err := tc.op(env)
+			require.ErrorIs(t, err, toolkit.ErrEscapeAttempt)
+
+			// Nothing outside the jail may have been touched.
+			entries, err := os.ReadDir(outside)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			data, err := os.ReadFile(filepath.Join(outside, "secret"))
+			require.NoError(t, err)
+			assert.Equal(t, "secret", string(data))
+		})
+	}
+}
+
+func TestTestEnvSymlinksStayInJail(t *testing.T) {
+	t.Parallel()
+	env, _ := newEscapeEnv(t)
+
+	require.NoError(t, env.Mkdir("real", 0o755, true))
+	require.NoError(t, env.WriteFile("real/file.txt", []byte("data"), 0o644))
+
+	// Absolute and relative links created through the Env resolve inside
+	// the jail.
+	require.NoError(t, env.Symlink("/home/testuser/real", "abs"))
+	require.NoError(t, env.Symlink("real", "rel"))
+	_, err := os.Lstat(filepath.Join(env.GetJail(), "home", "testuser", "abs"))
+	require.NoError(t, err, "link must be created inside the jail")
+
+	for _, link := range []string{"abs", "rel"} {
+		data, err := env.ReadFile(link + "/file.txt")
+		require.NoError(t, err, link)
+		assert.Equal(t, "data", string(data))
+
+		resolved, err := env.ResolvePath(link+"/file.txt", true)
+		require.NoError(t, err, link)
+		assert.Equal(t, "/home/testuser/real/file.txt", resolved)
+	}
+
+	// An absolute link to a path inside the jail written by another tool is
+	// accepted.
+	plant(t, env, filepath.Join(env.GetJail(), "home", "testuser", "real"), "home/testuser/raw")
+	_, err = env.ReadFile("raw/file.txt")
+	require.NoError(t, err)
+
+	// Link targets are reported without the jail prefix.
+	for _, link := range []string{"abs", "raw"} {
+		target, err := env.Readlink(link)
+		require.NoError(t, err, link)
+		assert.Equal(t, "/home/testuser/real", target)
+	}
+	target, err := env.Readlink("rel")
+	require.NoError(t, err)
+	assert.Equal(t, "real", target)
+
+	// Lstat semantics when not following, and removing a link keeps the
+	// target.
+	info, err := env.Stat("abs", false)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink)
+	require.NoError(t, env.Remove("abs", false))
+	_, err = env.Stat("real/file.txt", false)
+	require.NoError(t, err)
+}
+
+func TestTestEnvCloneKeepsJail(t *testing.T) {
+	t.Parallel()
+
+	jail := t.TempDir()
+	env := toolkit.NewTestEnv(jail, "", "")
+	require.NoError(t, env.Mkdir("~", 0o755, true))
+	require.NoError(t, env.WriteFile("~/a.txt", []byte("a"), 0o644))
+
+	clone := env.Clone()
+	assert.Equal(t, jail, clone.GetJail())
+	require.NoError(t, clone.Set("EDITOR", "vi"))
+	assert.Empty(t, env.Get("EDITOR"))
+	data, err := clone.ReadFile("~/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(data))
+}
@@ -0,0 +1,53 @@
+package toolkit
+
+// envVars forwards the environment variable, user and working directory
+// methods of Env to an inner Env. Env decorators embed it and implement Name
+// and the FileSystem methods themselves.
+type envVars struct {
+	env Env
+}
+
+func (e envVars) Get(key string) string       { return e.env.Get(key) }
+func (e envVars) Set(key, value string) error { return e.env.Set(key, value) }
+func (e envVars) Has(key string) bool         { return e.env.Has(key) }
+func (e envVars) Environ() []string           { return e.env.Environ() }
+func (e envVars) Unset(key string)            { e.env.Unset(key) }
+func (e envVars) GetHome() (string, error)    { return e.env.GetHome() }
+func (e envVars) SetHome(home string) error   { return e.env.SetHome(home) }
+func (e envVars) GetUser() (string, error)    { return e.env.GetUser() }
+func (e envVars) SetUser(user string) error   { return e.env.SetUser(user) }
+func (e envVars) Getwd() (string, error)      { return e.env.Getwd() }
+func (e envVars) Setwd(dir string)            { e.env.Setwd(dir) }
+func (e envVars) GetTempDir() string          { return e.env.GetTempDir() }
+
+// unwrapper is implemented by Env decorators that expose the Env they wrap.
+type unwrapper interface {
+	Unwrap() Env
+}
+
+// lookupEnv returns the first Env implementing T, starting with env and
+// following Unwrap through decorators such as FaultEnv and RecordingEnv.
+func lookupEnv[T any](env Env) (T, bool) {
+	for {
+		if v, ok := env.(T); ok {
+			return v, true
+		}
+		u, ok := env.(unwrapper)
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		env = u.Unwrap()
+	}
+}
+
+// innermostEnv follows Unwrap from env to the Env at the bottom of the chain.
+func innermostEnv(env Env) Env {
+	for {
+		u, ok := env.(unwrapper)
+		if !ok {
+			return env
+		}
+		env = u.Unwrap()
+	}
+}
@@ -5,4 +5,7 @@ import "errors"
 var (
 	ErrNoEnvKey      = errors.New("env key missing")
 	ErrEscapeAttempt = errors.New("path escape attempt: operation would access path outside jail")
+	ErrSymlinkLoop   = errors.New("symlink loop detected")
+	ErrLocked        = errors.New("lock is held by another owner")
+	ErrLockTimeout   = errors.New("timed out waiting for lock")
 )
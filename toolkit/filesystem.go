@@ -2,12 +2,34 @@ package toolkit
 
 import (
 	"context"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"log/slog"
 )
 
+// File is an open file handle returned by FileSystem.Open, Create and
+// OpenFile. It allows streaming reads and writes without loading the whole
+// file into memory. *os.File satisfies this interface.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+
+	// Name returns the name of the file. TestEnv and MemEnv report the
+	// absolute path as seen through the Env, without any jail prefix.
+	Name() string
+
+	// Stat returns the os.FileInfo describing the open file.
+	Stat() (os.FileInfo, error)
+
+	// Sync commits the current contents of the file to stable storage.
+	Sync() error
+}
+
 // FileSystem defines the contract for filesystem operations.
 // Implementations may reflect the real filesystem (OsEnv) or provide
 // an in-memory view suitable for tests (TestEnv).
@@ -35,7 +57,44 @@ type FileSystem interface {
 
 	Symlink(oldname, newname string) error
 
+	// Lstat returns the os.FileInfo for the named file without following a
+	// final symlink. It is equivalent to Stat(name, false).
+	Lstat(name string) (os.FileInfo, error)
+
+	// Readlink returns the destination of the named symbolic link.
+	Readlink(name string) (string, error)
+
+	// Chmod changes the mode of the named file, following symlinks.
+	Chmod(name string, mode os.FileMode) error
+
+	// Chown changes the numeric uid and gid of the named file, following
+	// symlinks. It is not supported on Windows.
+	Chown(name string, uid, gid int) error
+
+	// Chtimes changes the access and modification times of the named file,
+	// following symlinks.
+	Chtimes(name string, atime, mtime time.Time) error
+
+	// AtomicWriteFile replaces the named file so readers observe either the
+	// old or the new contents, never a partial write. It is
+	// AtomicWriteFileWithOptions with default options.
 	AtomicWriteFile(rel string, data []byte, perm os.FileMode) error
+
+	// AtomicWriteFileWithOptions is AtomicWriteFile with control over
+	// permission handling and backups. A nil opts selects the defaults: an
+	// existing file keeps its mode and owner and no backup is made.
+	AtomicWriteFileWithOptions(rel string, data []byte, perm os.FileMode, opts *AtomicWriteOptions) error
+
+	// Open opens the named file for reading.
+	Open(rel string) (File, error)
+
+	// Create creates or truncates the named file and opens it for reading
+	// and writing.
+	Create(rel string) (File, error)
+
+	// OpenFile opens the named file with the given flags (os.O_RDONLY,
+	// os.O_APPEND, ...). If the file is created perm is applied to it.
+	OpenFile(rel string, flag int, perm os.FileMode) (File, error)
 }
 
 func AtomicWriteFile(ctx context.Context, rel string, data []byte, perm os.FileMode) error {
@@ -67,6 +126,37 @@ func AtomicWriteFile(ctx context.Context, rel string, data []byte, perm os.FileM
 	return nil
 }
 
+// AtomicWriteFileWithOptions atomically replaces the named file using the
+// Env stored in ctx. See FileSystem.AtomicWriteFileWithOptions.
+func AtomicWriteFileWithOptions(ctx context.Context, rel string, data []byte, perm os.FileMode, opts *AtomicWriteOptions) error {
+	env := EnvFromContext(ctx)
+	lg := getTookitLogger(ctx)
+
+	err := env.AtomicWriteFileWithOptions(rel, data, perm, opts)
+	if err != nil {
+		lg.Log(
+			ctx,
+			slog.LevelError,
+			"AtomicWriteFileWithOptions failed",
+			slog.String("envType", env.Name()),
+			slog.String("pwd", env.Get("PWD")),
+			slog.String("rel", rel),
+			slog.Any("error", err),
+		)
+		return err
+	}
+	lg.Log(
+		ctx,
+		slog.LevelDebug,
+		"AtomicWriteFileWithOptions success",
+		slog.String("envType", env.Name()),
+		slog.String("pwd", env.Get("PWD")),
+		slog.String("rel", rel),
+	)
+
+	return nil
+}
+
 // AbsPath returns a cleaned absolute path for the provided path. Behavior:
 // - If path is empty, returns empty string.
 // - Expands a leading tilde using ExpandPath with the Env from ctx.
@@ -400,3 +490,254 @@ func Symlink(ctx context.Context, oldname, newname string) error {
 
 	return nil
 }
+
+// Lstat returns the os.FileInfo for rel without following a final symlink
+// using the Env stored in ctx.
+func Lstat(ctx context.Context, rel string) (os.FileInfo, error) {
+	env := EnvFromContext(ctx)
+	lg := getTookitLogger(ctx)
+	info, err := env.Lstat(rel)
+	if err != nil {
+		lg.Log(
+			ctx,
+			slog.LevelError,
+			"Lstat failed",
+			slog.String("envType", env.Name()),
+			slog.String("pwd", env.Get("PWD")),
+			slog.String("rel", rel),
+			slog.Any("error", err),
+		)
+		return nil, err
+	}
+	lg.Log(
+		ctx,
+		slog.LevelDebug,
+		"Lstat success",
+		slog.String("envType", env.Name()),
+		slog.String("pwd", env.Get("PWD")),
+		slog.String("rel", rel),
+	)
+	return info, nil
+}
+
+// Readlink returns the destination of the symbolic link rel using the Env
+// stored in ctx. TestEnv reports absolute destinations without the jail
+// prefix.
+func Readlink(ctx context.Context, rel string) (string, error) {
+	env := EnvFromContext(ctx)
+	lg := getTookitLogger(ctx)
+	target, err := env.Readlink(rel)
+	if err != nil {
+		lg.Log(
+			ctx,
+			slog.LevelError,
+			"Readlink failed",
+			slog.String("envType", env.Name()),
+			slog.String("pwd", env.Get("PWD")),
+			slog.String("rel", rel),
+			slog.Any("error", err),
+		)
+		return "", err
+	}
+	lg.Log(
+		ctx,
+		slog.LevelDebug,
+		"Readlink success",
+		slog.String("envType", env.Name()),
+		slog.String("pwd", env.Get("PWD")),
+		slog.String("rel", rel),
+		slog.String("target", target),
+	)
+	return target, nil
+}
+
+// Chmod changes the mode of rel using the Env stored in ctx.
+func Chmod(ctx context.Context, rel string, mode os.FileMode) error {
+	env := EnvFromContext(ctx)
+	lg := getTookitLogger(ctx)
+	if err := env.Chmod(rel, mode); err != nil {
+		lg.Log(
+			ctx,
+			slog.LevelError,
+			"Chmod failed",
+			slog.String("envType", env.Name()),
+			slog.String("pwd", env.Get("PWD")),
+			slog.String("rel", rel),
+			slog.String("mode", mode.String()),
+			slog.Any("error", err),
+		)
+		return err
+	}
+	lg.Log(
+		ctx,
+		slog.LevelDebug,
+		"Chmod success",
+		slog.String("envType", env.Name()),
+		slog.String("pwd", env.Get("PWD")),
+		slog.String("rel", rel),
+		slog.String("mode", mode.String()),
+	)
+	return nil
+}
+
+// Chown changes the numeric uid and gid of rel using the Env stored in ctx.
+func Chown(ctx context.Context, rel string, uid, gid int) error {
+	env := EnvFromContext(ctx)
+	lg := getTookitLogger(ctx)
+	if err := env.Chown(rel, uid, gid); err != nil {
+		lg.Log(
+			ctx,
+			slog.LevelError,
+			"Chown failed",
+			slog.String("envType", env.Name()),
+			slog.String("pwd", env.Get("PWD")),
+			slog.String("rel", rel),
+			slog.Int("uid", uid),
+			slog.Int("gid", gid),
+			slog.Any("error", err),
+		)
+		return err
+	}
+	lg.Log(
+		ctx,
+		slog.LevelDebug,
+		"Chown success",
+		slog.String("envType", env.Name()),
+		slog.String("pwd", env.Get("PWD")),
+		slog.String("rel", rel),
+		slog.Int("uid", uid),
+		slog.Int("gid", gid),
+	)
+	return nil
+}
+
+// Chtimes changes the access and modification times of rel using the Env
+// stored in ctx.
+func Chtimes(ctx context.Context, rel string, atime, mtime time.Time) error {
+	env := EnvFromContext(ctx)
+	lg := getTookitLogger(ctx)
+	if err := env.Chtimes(rel, atime, mtime); err != nil {
+		lg.Log(
+			ctx,
+			slog.LevelError,
+			"Chtimes failed",
+			slog.String("envType", env.Name()),
+			slog.String("pwd", env.Get("PWD")),
+			slog.String("rel", rel),
+			slog.Time("atime", atime),
+			slog.Time("mtime", mtime),
+			slog.Any("error", err),
+		)
+		return err
+	}
+	lg.Log(
+		ctx,
+		slog.LevelDebug,
+		"Chtimes success",
+		slog.String("envType", env.Name()),
+		slog.String("pwd", env.Get("PWD")),
+		slog.String("rel", rel),
+		slog.Time("atime", atime),
+		slog.Time("mtime", mtime),
+	)
+	return nil
+}
+
+// Open opens the named file for reading using the Env stored in ctx. The
+// caller is responsible for closing the returned File.
+func Open(ctx context.Context, rel string) (File, error) {
+	env := EnvFromContext(ctx)
+	lg := getTookitLogger(ctx)
+
+	f, err := env.Open(rel)
+	if err != nil {
+		lg.Log(
+			ctx,
+			slog.LevelError,
+			"Open failed",
+			slog.String("envType", env.Name()),
+			slog.String("pwd", env.Get("PWD")),
+			slog.String("rel", rel),
+			slog.Any("error", err),
+		)
+		return nil, err
+	}
+
+	lg.Log(
+		ctx,
+		slog.LevelDebug,
+		"Open success",
+		slog.String("envType", env.Name()),
+		slog.String("pwd", env.Get("PWD")),
+		slog.String("rel", rel),
+	)
+	return f, nil
+}
+
+// Create creates or truncates the named file using the Env stored in ctx and
+// opens it for reading and writing. The caller is responsible for closing the
+// returned File.
+func Create(ctx context.Context, rel string) (File, error) {
+	env := EnvFromContext(ctx)
+	lg := getTookitLogger(ctx)
+
+	f, err := env.Create(rel)
+	if err != nil {
+		lg.Log(
+			ctx,
+			slog.LevelError,
+			"Create failed",
+			slog.String("envType", env.Name()),
+			slog.String("pwd", env.Get("PWD")),
+			slog.String("rel", rel),
+			slog.Any("error", err),
+		)
+		return nil, err
+	}
+
+	lg.Log(
+		ctx,
+		slog.LevelDebug,
+		"Create success",
+		slog.String("envType", env.Name()),
+		slog.String("pwd", env.Get("PWD")),
+		slog.String("rel", rel),
+	)
+	return f, nil
+}
+
+// OpenFile opens the named file with the provided flags and permissions using
+// the Env stored in ctx. The caller is responsible for closing the returned
+// File.
+func OpenFile(ctx context.Context, rel string, flag int, perm os.FileMode) (File, error) {
+	env := EnvFromContext(ctx)
+	lg := getTookitLogger(ctx)
+
+	f, err := env.OpenFile(rel, flag, perm)
+	if err != nil {
+		lg.Log(
+			ctx,
+			slog.LevelError,
+			"OpenFile failed",
+			slog.String("envType", env.Name()),
+			slog.String("pwd", env.Get("PWD")),
+			slog.String("rel", rel),
+			slog.Int("flag", flag),
+			slog.String("perm", perm.String()),
+			slog.Any("error", err),
+		)
+		return nil, err
+	}
+
+	lg.Log(
+		ctx,
+		slog.LevelDebug,
+		"OpenFile success",
+		slog.String("envType", env.Name()),
+		slog.String("pwd", env.Get("PWD")),
+		slog.String("rel", rel),
+		slog.Int("flag", flag),
+		slog.String("perm", perm.String()),
+	)
+	return f, nil
+}
@@ -2,8 +2,12 @@ package toolkit_test
 
 import (
 	"context"
+	"io"
+	"io/fs"
+	"os"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/jlrickert/cli-toolkit/mylog"
 	"github.com/jlrickert/cli-toolkit/toolkit"
@@ -393,3 +397,115 @@ func TestRelativePath(t *testing.T) {
 		})
 	}
 }
+
+func TestOpenFileStreaming(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := toolkit.WithEnv(t.Context(), newEnv(t))
+			require.NoError(t, toolkit.Mkdir(ctx, "~/logs", 0o755, true))
+
+			f, err := toolkit.Create(ctx, "~/logs/app.log")
+			require.NoError(t, err)
+			_, err = io.WriteString(f, "line one\n")
+			require.NoError(t, err)
+			require.NoError(t, f.Sync())
+			assert.Equal(t, "/home/testuser/logs/app.log", f.Name())
+			require.NoError(t, f.Close())
+
+			// Append through a second handle.
+			f, err = toolkit.OpenFile(ctx, "~/logs/app.log", os.O_WRONLY|os.O_APPEND, 0)
+			require.NoError(t, err)
+			_, err = io.WriteString(f, "line two\n")
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+
+			f, err = toolkit.Open(ctx, "~/logs/app.log")
+			require.NoError(t, err)
+			defer f.Close()
+
+			info, err := f.Stat()
+			require.NoError(t, err)
+			assert.Equal(t, int64(18), info.Size())
+
+			_, err = f.Seek(5, io.SeekStart)
+			require.NoError(t, err)
+			rest, err := io.ReadAll(f)
+			require.NoError(t, err)
+			assert.Equal(t, "one\nline two\n", string(rest))
+
+			_, err = f.Write([]byte("nope"))
+			assert.Error(t, err, "read only handle")
+
+			_, err = toolkit.OpenFile(ctx, "~/logs/app.log", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+			assert.ErrorIs(t, err, fs.ErrExist)
+
+			_, err = toolkit.Open(ctx, "~/logs/missing.log")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+		})
+	}
+}
+
+func TestFileMetadata(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permissions and symlinks are required")
+	}
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			env := newEnv(t)
+			ctx := toolkit.WithEnv(t.Context(), env)
+			require.NoError(t, toolkit.Mkdir(ctx, "~/bin", 0o755, true))
+			require.NoError(t, toolkit.WriteFile(ctx, "~/bin/tool", []byte("#!/bin/sh"), 0o644))
+			require.NoError(t, toolkit.Symlink(ctx, "/home/testuser/bin/tool", "~/tool"))
+
+			target, err := toolkit.Readlink(ctx, "~/tool")
+			require.NoError(t, err)
+			assert.Equal(t, "/home/testuser/bin/tool", target)
+			_, err = toolkit.Readlink(ctx, "~/bin/tool")
+			require.Error(t, err, "not a symlink")
+
+			info, err := toolkit.Lstat(ctx, "~/tool")
+			require.NoError(t, err)
+			assert.NotZero(t, info.Mode()&fs.ModeSymlink)
+
+			// Chmod and Chtimes follow the link to the target.
+			require.NoError(t, toolkit.Chmod(ctx, "~/tool", 0o755))
+			mtime := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+			require.NoError(t, toolkit.Chtimes(ctx, "~/tool", mtime, mtime))
+			info, err = toolkit.Lstat(ctx, "~/bin/tool")
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0o755), info.Mode())
+			assert.True(t, mtime.Equal(info.ModTime()))
+
+			require.NoError(t, toolkit.Chown(ctx, "~/bin/tool", os.Getuid(), os.Getgid()))
+			require.Error(t, toolkit.Chmod(ctx, "~/missing", 0o600))
+		})
+	}
+}
+
+func TestOsEnvStatNoFollow(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on windows")
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(dir+"/file", []byte("x"), 0o644))
+	require.NoError(t, os.Symlink(dir+"/file", dir+"/link"))
+
+	env := &toolkit.OsEnv{}
+	info, err := env.Stat(dir+"/link", false)
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&fs.ModeSymlink)
+	info, err = env.Stat(dir+"/link", true)
+	require.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+	info, err = env.Lstat(dir + "/link")
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&fs.ModeSymlink)
+}
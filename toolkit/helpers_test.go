@@ -0,0 +1,20 @@
+package toolkit_test
+
+import (
+	"testing"
+
+	"github.com/jlrickert/cli-toolkit/toolkit"
+)
+
+// allEnvs returns constructors for the Env implementations that tests run
+// against, keyed by subtest name.
+func allEnvs() map[string]func(t *testing.T) toolkit.Env {
+	return map[string]func(t *testing.T) toolkit.Env{
+		"test-env": func(t *testing.T) toolkit.Env {
+			return toolkit.NewTestEnv(t.TempDir(), "", "")
+		},
+		"mem-env": func(t *testing.T) toolkit.Env {
+			return toolkit.NewMemEnv(nil, "", "")
+		},
+	}
+}
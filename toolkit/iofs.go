@@ -0,0 +1,217 @@
+package toolkit
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+)
+
+// EnvFS adapts an Env to the standard library io/fs interfaces. It exposes
+// the directory tree below a root directory so the injected filesystem can be
+// handed to APIs such as template.ParseFS, fs.WalkDir, fs.Glob and http.FS.
+//
+// All access goes through the wrapped Env, so TestEnv jails and MemEnv trees
+// are respected. Names follow the io/fs conventions: they are slash
+// separated, unrooted and may not contain "." or ".." elements.
+type EnvFS struct {
+	env  Env
+	root string
+}
+
+// NewFS returns an EnvFS exposing the tree rooted at root within env. The
+// root is resolved once using env.ResolvePath so later changes to the Env
+// working directory do not affect the adapter.
+func NewFS(env Env, root string) *EnvFS {
+	if p, err := env.ResolvePath(root, false); err == nil {
+		root = p
+	}
+	return &EnvFS{env: env, root: root}
+}
+
+// path validates name and converts it to a path understood by the Env.
+func (f *EnvFS) path(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return filepath.Join(f.root, filepath.FromSlash(name)), nil
+}
+
+// wrapErr rewrites err so that the reported path is the io/fs name rather
+// than the Env path.
+func (f *EnvFS) wrapErr(op, name string, err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// Open implements fs.FS. Regular files are opened through Env.Open and
+// directories are returned as fs.ReadDirFile values.
+func (f *EnvFS) Open(name string) (fs.File, error) {
+	path, err := f.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.env.Stat(path, true)
+	if err != nil {
+		return nil, f.wrapErr("open", name, err)
+	}
+	if info.IsDir() {
+		return &envDirFile{fsys: f, name: name, path: path, info: info}, nil
+	}
+	file, err := f.env.Open(path)
+	if err != nil {
+		return nil, f.wrapErr("open", name, err)
+	}
+	return file, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (f *EnvFS) ReadFile(name string) ([]byte, error) {
+	path, err := f.path("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := f.env.ReadFile(path)
+	if err != nil {
+		return nil, f.wrapErr("readfile", name, err)
+	}
+	return data, nil
+}
+
+// ReadDir implements fs.ReadDirFS. Entries are sorted by filename.
+func (f *EnvFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	path, err := f.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := f.env.ReadDir(path)
+	if err != nil {
+		return nil, f.wrapErr("readdir", name, err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// Stat implements fs.StatFS. Symlinks are followed.
+func (f *EnvFS) Stat(name string) (fs.FileInfo, error) {
+	path, err := f.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.env.Stat(path, true)
+	if err != nil {
+		return nil, f.wrapErr("stat", name, err)
+	}
+	return info, nil
+}
+
+// Lstat implements fs.ReadLinkFS. Symlinks are not followed.
+func (f *EnvFS) Lstat(name string) (fs.FileInfo, error) {
+	path, err := f.path("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.env.Lstat(path)
+	if err != nil {
+		return nil, f.wrapErr("lstat", name, err)
+	}
+	return info, nil
+}
+
+// ReadLink implements fs.ReadLinkFS.
+func (f *EnvFS) ReadLink(name string) (string, error) {
+	path, err := f.path("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	target, err := f.env.Readlink(path)
+	if err != nil {
+		return "", f.wrapErr("readlink", name, err)
+	}
+	return target, nil
+}
+
+// Sub implements fs.SubFS by returning an EnvFS rooted at dir.
+func (f *EnvFS) Sub(dir string) (fs.FS, error) {
+	path, err := f.path("sub", dir)
+	if err != nil {
+		return nil, err
+	}
+	if dir == "." {
+		return f, nil
+	}
+	return &EnvFS{env: f.env, root: path}, nil
+}
+
+// envDirFile is the fs.ReadDirFile returned by EnvFS.Open for directories.
+type envDirFile struct {
+	fsys    *EnvFS
+	name    string
+	path    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	loaded  bool
+	closed  bool
+}
+
+func (d *envDirFile) Stat() (fs.FileInfo, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "stat", Path: d.name, Err: fs.ErrClosed}
+	}
+	return d.info, nil
+}
+
+func (d *envDirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *envDirFile) Close() error {
+	if d.closed {
+		return &fs.PathError{Op: "close", Path: d.name, Err: fs.ErrClosed}
+	}
+	d.closed = true
+	return nil
+}
+
+// ReadDir returns up to n entries following the fs.ReadDirFile contract.
+func (d *envDirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrClosed}
+	}
+	if !d.loaded {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.loaded = true
+	}
+	if n <= 0 {
+		out := d.entries
+		d.entries = nil
+		return out, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	out := d.entries[:n]
+	d.entries = d.entries[n:]
+	return out, nil
+}
+
+// Ensure EnvFS satisfies the io/fs interfaces.
+var (
+	_ fs.FS         = (*EnvFS)(nil)
+	_ fs.ReadDirFS  = (*EnvFS)(nil)
+	_ fs.ReadFileFS = (*EnvFS)(nil)
+	_ fs.ReadLinkFS = (*EnvFS)(nil)
+	_ fs.StatFS     = (*EnvFS)(nil)
+	_ fs.SubFS      = (*EnvFS)(nil)
+)
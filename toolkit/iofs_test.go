@@ -0,0 +1,63 @@
+package toolkit_test
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"text/template"
+
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedFS(t *testing.T, env toolkit.Env) {
+	t.Helper()
+	require.NoError(t, env.Mkdir("~/site/templates/partials", 0o755, true))
+	require.NoError(t, env.WriteFile("~/site/index.txt", []byte("index"), 0o644))
+	require.NoError(t, env.WriteFile("~/site/templates/page.tmpl",
+		[]byte(`page {{template "footer"}}`), 0o644))
+	require.NoError(t, env.WriteFile("~/site/templates/partials/footer.tmpl",
+		[]byte(`{{define "footer"}}footer{{end}}`), 0o644))
+}
+
+func TestEnvFS(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			env := newEnv(t)
+			seedFS(t, env)
+
+			fsys := toolkit.NewFS(env, "~/site")
+			require.NoError(t, fstest.TestFS(fsys,
+				"index.txt",
+				"templates/page.tmpl",
+				"templates/partials/footer.tmpl",
+			))
+
+			matches, err := fs.Glob(fsys, "templates/*.tmpl")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"templates/page.tmpl"}, matches)
+
+			tmpl, err := template.ParseFS(fsys, "templates/*.tmpl", "templates/partials/*.tmpl")
+			require.NoError(t, err)
+			var out strings.Builder
+			require.NoError(t, tmpl.ExecuteTemplate(&out, "page.tmpl", nil))
+			assert.Equal(t, "page footer", out.String())
+
+			sub, err := fs.Sub(fsys, "templates")
+			require.NoError(t, err)
+			data, err := fs.ReadFile(sub, "partials/footer.tmpl")
+			require.NoError(t, err)
+			assert.Contains(t, string(data), "footer")
+
+			_, err = fsys.Open("../outside")
+			assert.ErrorIs(t, err, fs.ErrInvalid)
+			_, err = fsys.Open("missing.txt")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+		})
+	}
+}
@@ -0,0 +1,402 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+)
+
+// DefaultLockPollInterval is the time Lock waits between attempts to take a
+// contended lock when LockOptions.PollInterval is zero.
+const DefaultLockPollInterval = 50 * time.Millisecond
+
+// LockOptions controls how Lock acquires a lock.
+type LockOptions struct {
+	// Shared requests a shared (read) lock. Any number of shared locks may
+	// be held at once while an exclusive lock excludes every other holder.
+	Shared bool
+
+	// Timeout bounds how long Lock waits for a contended lock. It is
+	// measured on the clock.Clock stored in the context so tests can expire
+	// it by advancing a TestClock. Zero tries exactly once and a negative
+	// value waits until the context is done.
+	Timeout time.Duration
+
+	// PollInterval is the time waited between attempts, measured on the
+	// injected clock like Timeout. Defaults to DefaultLockPollInterval.
+	PollInterval time.Duration
+}
+
+// Locker is implemented by Envs that manage locks themselves. TestEnv and
+// MemEnv implement it with an in-process lock table so contention can be
+// tested deterministically. Envs that do not implement Locker, such as
+// OsEnv, use lock files next to the locked path. Decorators that expose the
+// Env they wrap through an Unwrap method pass locks through to it.
+type Locker interface {
+	// TryLock attempts to take the lock on path without waiting. It returns
+	// a function releasing the lock, or an error wrapping ErrLocked when the
+	// lock is held by someone else.
+	TryLock(path string, shared bool) (unlock func() error, err error)
+}
+
+// FileLock is a held lock returned by Lock.
+type FileLock struct {
+	path   string
+	shared bool
+	once   sync.Once
+	unlock func() error
+}
+
+// Path returns the resolved path the lock protects.
+func (l *FileLock) Path() string {
+	return l.path
+}
+
+// Shared reports whether the lock is a shared lock.
+func (l *FileLock) Shared() bool {
+	return l.shared
+}
+
+// Unlock releases the lock. Calling Unlock more than once is a no-op.
+func (l *FileLock) Unlock() error {
+	var err error
+	l.once.Do(func() { err = l.unlock() })
+	return err
+}
+
+// Lock takes an advisory lock on path using the Env stored in ctx and
+// returns a handle that releases it. The locked file does not need to exist;
+// missing parent directories are created.
+//
+// When the lock is contended Lock retries until opts.Timeout elapses on the
+// injected clock, returning an error wrapping ErrLockTimeout, or until ctx is
+// done. A nil opts requests an exclusive lock that is tried once.
+//
+// With the lock file implementation used by OsEnv an exclusive lock is the
+// file path+".lock" and each shared holder owns a file named
+// path+".lock.shared.*". Every lock file records the holder PID; files left
+// behind by processes that no longer exist are treated as stale and removed.
+// Stale detection is best effort and assumes the lock files are not shared
+// between hosts.
+func Lock(ctx context.Context, path string, opts *LockOptions) (*FileLock, error) {
+	env := EnvFromContext(ctx)
+	lg := getTookitLogger(ctx)
+
+	if opts == nil {
+		opts = &LockOptions{}
+	}
+	l, err := acquireLock(ctx, env, path, opts)
+	if err != nil {
+		lg.Log(
+			ctx,
+			slog.LevelError,
+			"Lock failed",
+			slog.String("envType", env.Name()),
+			slog.String("pwd", env.Get("PWD")),
+			slog.String("path", path),
+			slog.Bool("shared", opts.Shared),
+			slog.Any("error", err),
+		)
+		return nil, err
+	}
+	lg.Log(
+		ctx,
+		slog.LevelDebug,
+		"Lock success",
+		slog.String("envType", env.Name()),
+		slog.String("pwd", env.Get("PWD")),
+		slog.String("path", l.path),
+		slog.Bool("shared", opts.Shared),
+	)
+	return l, nil
+}
+
+func acquireLock(ctx context.Context, env Env, path string, opts *LockOptions) (*FileLock, error) {
+	resolved, err := env.ResolvePath(path, false)
+	if err != nil {
+		return nil, err
+	}
+	// Locking leaves the locked file alone, so it bypasses decorators such
+	// as ReadOnlyEnv and RecordingEnv: the first Locker in the Unwrap chain
+	// takes the lock, or else lock files go to the innermost Env.
+	base := innermostEnv(env)
+	if err := base.Mkdir(filepath.Dir(resolved), 0o755, true); err != nil {
+		return nil, err
+	}
+
+	clk := clock.ClockFromContext(ctx)
+	tryLock := func() (func() error, error) {
+		return lockFileTryLock(base, clk, resolved, opts.Shared)
+	}
+	if l, ok := lookupEnv[Locker](env); ok {
+		tryLock = func() (func() error, error) {
+			return l.TryLock(resolved, opts.Shared)
+		}
+	}
+
+	poll := opts.PollInterval
+	if poll <= 0 {
+		poll = DefaultLockPollInterval
+	}
+	deadline := clk.Now().Add(opts.Timeout)
+	for {
+		unlock, err := tryLock()
+		if err == nil {
+			return &FileLock{path: resolved, shared: opts.Shared, unlock: unlock}, nil
+		}
+		if !errors.Is(err, ErrLocked) {
+			return nil, err
+		}
+		if opts.Timeout == 0 || (opts.Timeout > 0 && !clk.Now().Before(deadline)) {
+			return nil, fmt.Errorf("lock %s: %w", resolved, ErrLockTimeout)
+		}
+
+		timer := clk.NewTimer(poll)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+// lockSeq makes the names of shared lock files and stale lock tombstones
+// unique within the process.
+var lockSeq atomic.Uint64
+
+// lockFileGrace is how long a lock file without a readable PID counts as
+// held. Its creator may not have written the PID yet; after the grace period
+// the file is assumed to be left behind by a crash.
+const lockFileGrace = 10 * time.Second
+
+// lockFileTryLock implements a single lock attempt using lock files created
+// through env.
+//
+// A writer creates the exclusive file and then checks for readers, while a
+// reader creates its shared file and then checks for a writer. Whoever sees
+// the other side backs off, so a writer and a reader can never both succeed.
+func lockFileTryLock(env Env, clk clock.Clock, path string, shared bool) (func() error, error) {
+	excl := path + ".lock"
+	if shared {
+		name := fmt.Sprintf("%s.lock.shared.%d.%d", path, os.Getpid(), lockSeq.Add(1))
+		if err := createLockFile(env, name); err != nil {
+			return nil, err
+		}
+		if lockFileHeld(env, clk, excl) {
+			_ = env.Remove(name, false)
+			return nil, fmt.Errorf("lock %s: %w", path, ErrLocked)
+		}
+		return func() error { return env.Remove(name, false) }, nil
+	}
+
+	err := createLockFile(env, excl)
+	if errors.Is(err, fs.ErrExist) && !lockFileHeld(env, clk, excl) {
+		// The previous holder is gone; lockFileHeld removed its file.
+		err = createLockFile(env, excl)
+	}
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("lock %s: %w", path, ErrLocked)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := env.ReadDir(filepath.Dir(path))
+	if err != nil {
+		_ = env.Remove(excl, false)
+		return nil, err
+	}
+	prefix := filepath.Base(path) + ".lock.shared."
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		if lockFileHeld(env, clk, filepath.Join(filepath.Dir(path), e.Name())) {
+			_ = env.Remove(excl, false)
+			return nil, fmt.Errorf("lock %s: %w", path, ErrLocked)
+		}
+	}
+	return func() error { return env.Remove(excl, false) }, nil
+}
+
+// createLockFile exclusively creates name and records the current PID in
+// it. The error wraps fs.ErrExist when the file is already present.
+func createLockFile(env Env, name string) error {
+	return writeLockFile(env, name, []byte(fmt.Sprintf("%d\n", os.Getpid())))
+}
+
+// writeLockFile exclusively creates name with the given data. The error
+// wraps fs.ErrExist when the file is already present.
+func writeLockFile(env Env, name string, data []byte) error {
+	f, err := env.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = env.Remove(name, false)
+	}
+	return err
+}
+
+// lockFileState is the state of a lock file as seen by checkLockFile.
+type lockFileState int
+
+const (
+	lockFileMissing lockFileState = iota
+	lockFileLive
+	lockFileStale
+)
+
+// checkLockFile classifies the lock file name. A file whose PID belongs to a
+// live process is live, as is a file without a readable PID modified within
+// lockFileGrace. Anything else is stale.
+func checkLockFile(env Env, clk clock.Clock, name string) lockFileState {
+	info, err := env.Stat(name, false)
+	if errors.Is(err, fs.ErrNotExist) {
+		return lockFileMissing
+	}
+	if err != nil {
+		return lockFileLive
+	}
+	data, err := env.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return lockFileMissing
+	}
+	if err != nil {
+		return lockFileLive
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		if clk.Since(info.ModTime()) < lockFileGrace {
+			return lockFileLive
+		}
+		return lockFileStale
+	}
+	if processAlive(pid) {
+		return lockFileLive
+	}
+	return lockFileStale
+}
+
+// lockFileHeld reports whether the lock file name exists and is live
+// according to checkLockFile. Stale lock files are removed.
+//
+// Contenders may find the same stale file at once, so the file is first
+// renamed to a tombstone unique to this attempt: only one rename of the
+// stale file can succeed. If the renamed file turns out to be live, because
+// another contender already replaced the stale file with its own lock, it is
+// put back unless a new lock file has appeared in the meantime.
+func lockFileHeld(env Env, clk clock.Clock, name string) bool {
+	switch checkLockFile(env, clk, name) {
+	case lockFileMissing:
+		return false
+	case lockFileLive:
+		return true
+	}
+
+	tomb := fmt.Sprintf("%s.stale.%d.%d", name, os.Getpid(), lockSeq.Add(1))
+	if err := env.Rename(name, tomb); err != nil {
+		// Another contender claimed the stale file first.
+		return !errors.Is(err, fs.ErrNotExist)
+	}
+	if checkLockFile(env, clk, tomb) == lockFileLive {
+		restoreLockFile(env, tomb, name)
+		return true
+	}
+	_ = env.Remove(tomb, false)
+	return false
+}
+
+// restoreLockFile moves the live lock file tomb back to name. A rename would
+// replace a lock file created at name since tomb was renamed away, so the
+// file is recreated exclusively instead, keeping its data and modification
+// time. If name exists again it is left alone and tomb is dropped.
+func restoreLockFile(env Env, tomb, name string) {
+	info, err := env.Stat(tomb, false)
+	if err != nil {
+		return
+	}
+	data, err := env.ReadFile(tomb)
+	if err != nil {
+		return
+	}
+	err = writeLockFile(env, name, data)
+	if err == nil {
+		_ = env.Chtimes(name, info.ModTime(), info.ModTime())
+	}
+	if err == nil || errors.Is(err, fs.ErrExist) {
+		_ = env.Remove(tomb, false)
+	}
+}
+
+// lockTable is an in-process lock manager. TestEnv and MemEnv use it to
+// implement Locker without touching the filesystem.
+type lockTable struct {
+	mu   sync.Mutex
+	held map[string]*lockState
+}
+
+type lockState struct {
+	readers   int
+	exclusive bool
+}
+
+func newLockTable() *lockTable {
+	return &lockTable{held: make(map[string]*lockState)}
+}
+
+// tryLock takes the lock named key without waiting.
+func (t *lockTable) tryLock(key string, shared bool) (func() error, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st := t.held[key]
+	if st == nil {
+		st = &lockState{}
+		t.held[key] = st
+	}
+	if st.exclusive || (!shared && st.readers > 0) {
+		return nil, fmt.Errorf("lock %s: %w", key, ErrLocked)
+	}
+	if shared {
+		st.readers++
+	} else {
+		st.exclusive = true
+	}
+
+	return func() error {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if shared {
+			st.readers--
+		} else {
+			st.exclusive = false
+		}
+		if st.readers == 0 && !st.exclusive {
+			delete(t.held, key)
+		}
+		return nil
+	}, nil
+}
+
+// Ensure implementations satisfy the interfaces.
+var (
+	_ Locker = (*TestEnv)(nil)
+	_ Locker = (*MemEnv)(nil)
+)
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package toolkit
+
+import "os"
+
+// processAlive reports whether a process with the given PID exists.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return true
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
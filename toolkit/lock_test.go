@@ -0,0 +1,270 @@
+package toolkit_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockContention(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := toolkit.WithEnv(t.Context(), newEnv(t))
+			shared := &toolkit.LockOptions{Shared: true}
+
+			l, err := toolkit.Lock(ctx, "~/state/db.json", nil)
+			require.NoError(t, err)
+			assert.Equal(t, "/home/testuser/state/db.json", l.Path())
+
+			_, err = toolkit.Lock(ctx, "~/state/db.json", nil)
+			require.ErrorIs(t, err, toolkit.ErrLockTimeout)
+			_, err = toolkit.Lock(ctx, "~/state/db.json", shared)
+			require.ErrorIs(t, err, toolkit.ErrLockTimeout)
+
+			// Other paths are independent.
+			other, err := toolkit.Lock(ctx, "~/state/other.json", nil)
+			require.NoError(t, err)
+			require.NoError(t, other.Unlock())
+
+			require.NoError(t, l.Unlock())
+			require.NoError(t, l.Unlock(), "unlock is idempotent")
+
+			r1, err := toolkit.Lock(ctx, "~/state/db.json", shared)
+			require.NoError(t, err)
+			r2, err := toolkit.Lock(ctx, "~/state/db.json", shared)
+			require.NoError(t, err)
+			_, err = toolkit.Lock(ctx, "~/state/db.json", nil)
+			require.ErrorIs(t, err, toolkit.ErrLockTimeout)
+
+			require.NoError(t, r1.Unlock())
+			require.NoError(t, r2.Unlock())
+			l, err = toolkit.Lock(ctx, "~/state/db.json", nil)
+			require.NoError(t, err)
+			require.NoError(t, l.Unlock())
+		})
+	}
+}
+
+func TestLockTimeoutUsesClock(t *testing.T) {
+	t.Parallel()
+
+	clk := clock.NewTestClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx := toolkit.WithEnv(t.Context(), toolkit.NewMemEnv(clk, "", ""))
+	ctx = clock.WithClock(ctx, clk)
+	opts := &toolkit.LockOptions{Timeout: time.Minute, PollInterval: 30 * time.Second}
+
+	held, err := toolkit.Lock(ctx, "/var/lock/app", nil)
+	require.NoError(t, err)
+
+	// The waiter polls on the injected clock until it passes the timeout.
+	errc := make(chan error, 1)
+	go func() {
+		_, err := toolkit.Lock(ctx, "/var/lock/app", opts)
+		errc <- err
+	}()
+	for range 2 {
+		clk.BlockUntil(1)
+		select {
+		case err := <-errc:
+			t.Fatalf("lock returned before the clock advanced: %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+		clk.Advance(30 * time.Second)
+	}
+	require.ErrorIs(t, <-errc, toolkit.ErrLockTimeout)
+
+	// A waiter acquires the lock at its next poll once the holder releases
+	// it.
+	acquired := make(chan *toolkit.FileLock, 1)
+	go func() {
+		l, err := toolkit.Lock(ctx, "/var/lock/app", opts)
+		assert.NoError(t, err)
+		acquired <- l
+	}()
+	clk.BlockUntil(1)
+	require.NoError(t, held.Unlock())
+	clk.Advance(30 * time.Second)
+	l := <-acquired
+	require.NotNil(t, l)
+	require.NoError(t, l.Unlock())
+}
+
+func TestOsEnvLockFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	ctx := toolkit.WithEnv(t.Context(), &toolkit.OsEnv{})
+
+	l, err := toolkit.Lock(ctx, path, nil)
+	require.NoError(t, err)
+	data, err := os.ReadFile(path + ".lock")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%d\n", os.Getpid()), string(data))
+
+	_, err = toolkit.Lock(ctx, path, &toolkit.LockOptions{Shared: true})
+	require.ErrorIs(t, err, toolkit.ErrLockTimeout)
+	require.NoError(t, l.Unlock())
+	_, err = os.Stat(path + ".lock")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	r, err := toolkit.Lock(ctx, path, &toolkit.LockOptions{Shared: true})
+	require.NoError(t, err)
+	_, err = toolkit.Lock(ctx, path, nil)
+	require.ErrorIs(t, err, toolkit.ErrLockTimeout)
+	require.NoError(t, r.Unlock())
+
+	// Lock files left behind by a process that no longer exists are stale.
+	require.NoError(t, os.WriteFile(path+".lock", []byte("999999999\n"), 0o644))
+	require.NoError(t, os.WriteFile(path+".lock.shared.999999999.1", []byte("999999999\n"), 0o644))
+	l, err = toolkit.Lock(ctx, path, nil)
+	require.NoError(t, err)
+	require.NoError(t, l.Unlock())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+// pausingEnv pauses the first read of a file whose name starts with prefix
+// until resume is closed, after signalling reached.
+type pausingEnv struct {
+	toolkit.Env
+	prefix  string
+	once    sync.Once
+	reached chan struct{}
+	resume  chan struct{}
+}
+
+func newPausingEnv(env toolkit.Env, prefix string) *pausingEnv {
+	return &pausingEnv{
+		Env:     env,
+		prefix:  prefix,
+		reached: make(chan struct{}),
+		resume:  make(chan struct{}),
+	}
+}
+
+func (e *pausingEnv) ReadFile(name string) ([]byte, error) {
+	data, err := e.Env.ReadFile(name)
+	if strings.HasPrefix(name, e.prefix) {
+		e.once.Do(func() {
+			close(e.reached)
+			<-e.resume
+		})
+	}
+	return data, err
+}
+
+func TestOsEnvLockStaleTakeover(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	require.NoError(t, os.WriteFile(path+".lock", []byte("999999999\n"), 0o644))
+
+	// The slow contender reads the stale PID and stops before acting on it
+	// while the fast contender takes the lock over.
+	slow := newPausingEnv(&toolkit.OsEnv{}, path+".lock")
+	errc := make(chan error, 1)
+	go func() {
+		l, err := toolkit.Lock(toolkit.WithEnv(t.Context(), slow), path, nil)
+		if err == nil {
+			err = l.Unlock()
+		}
+		errc <- err
+	}()
+	<-slow.reached
+
+	fast, err := toolkit.Lock(toolkit.WithEnv(t.Context(), &toolkit.OsEnv{}), path, nil)
+	require.NoError(t, err)
+	close(slow.resume)
+	require.ErrorIs(t, <-errc, toolkit.ErrLockTimeout)
+
+	data, err := os.ReadFile(path + ".lock")
+	require.NoError(t, err, "the live lock must survive")
+	assert.Equal(t, fmt.Sprintf("%d\n", os.Getpid()), string(data))
+	require.NoError(t, fast.Unlock())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestOsEnvLockStaleTakeoverKeepsNewLock(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	require.NoError(t, os.WriteFile(path+".lock", []byte("999999999\n"), 0o644))
+
+	// The slow contender reads the stale PID, then renames the lock the
+	// fast contender took over in the meantime and stops after reading it
+	// back. A third contender then finds the lock free.
+	tombs := newPausingEnv(&toolkit.OsEnv{}, path+".lock.stale.")
+	slow := newPausingEnv(tombs, path+".lock")
+	errc := make(chan error, 1)
+	go func() {
+		l, err := toolkit.Lock(toolkit.WithEnv(t.Context(), slow), path, nil)
+		if err == nil {
+			err = l.Unlock()
+		}
+		errc <- err
+	}()
+	<-slow.reached
+
+	ctx := toolkit.WithEnv(t.Context(), &toolkit.OsEnv{})
+	fast, err := toolkit.Lock(ctx, path, nil)
+	require.NoError(t, err)
+	close(slow.resume)
+	<-tombs.reached
+
+	third, err := toolkit.Lock(ctx, path, nil)
+	require.NoError(t, err)
+	before, err := os.Stat(path + ".lock")
+	require.NoError(t, err)
+	close(tombs.resume)
+	require.ErrorIs(t, <-errc, toolkit.ErrLockTimeout)
+
+	after, err := os.Stat(path + ".lock")
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(before, after), "the new lock file must not be replaced")
+	require.NoError(t, third.Unlock())
+	_ = fast.Unlock()
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestOsEnvLockEmptyFileGrace(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	ctx := toolkit.WithEnv(t.Context(), &toolkit.OsEnv{})
+
+	// A lock file without a PID may belong to a holder that has not written
+	// it yet.
+	require.NoError(t, os.WriteFile(path+".lock", nil, 0o644))
+	_, err := toolkit.Lock(ctx, path, nil)
+	require.ErrorIs(t, err, toolkit.ErrLockTimeout)
+
+	// Once the grace period has passed, it was left behind by a crash.
+	clk := clock.NewTestClock(time.Now().Add(time.Minute))
+	l, err := toolkit.Lock(clock.WithClock(ctx, clk), path, nil)
+	require.NoError(t, err)
+	require.NoError(t, l.Unlock())
+}
@@ -0,0 +1,136 @@
+package toolkit
+
+import (
+	"maps"
+	"path/filepath"
+	"strings"
+)
+
+// Snapshot is a point-in-time copy of the variables, home, user, working
+// directory and filesystem of a TestEnv or MemEnv. The filesystem is kept in
+// memory with modes, symlinks and modification times. A snapshot may be
+// restored any number of times, into the Env it was taken from or into
+// another one, so expensive fixtures can be built once and reused.
+type Snapshot struct {
+	home string
+	user string
+	data map[string]string
+	// jailed holds the variables whose values pointed into the jail of the
+	// snapshotted Env. Their values in data are relative to that jail.
+	jailed map[string]bool
+	tree   *MemEnv
+}
+
+// snapshotOptions copies trees exactly, merging into the existing root.
+var snapshotOptions = &CopyOptions{Overwrite: true, PreserveTimes: true}
+
+// newSnapshot copies the tree of env into memory. The caller fills in the
+// variables.
+func newSnapshot(env Env) (*Snapshot, error) {
+	tree := NewMemEnv(nil, "", "")
+	if err := copyFS(tree, NewFS(env, string(filepath.Separator)), ".",
+		string(filepath.Separator), snapshotOptions); err != nil {
+		return nil, err
+	}
+	return &Snapshot{tree: tree}, nil
+}
+
+// restoreTree replaces the whole tree of env with the snapshot tree.
+func (s *Snapshot) restoreTree(env Env) error {
+	root := string(filepath.Separator)
+	entries, err := env.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := env.Remove(filepath.Join(root, e.Name()), true); err != nil {
+			return err
+		}
+	}
+	return copyFS(env, NewFS(s.tree, root), ".", root, snapshotOptions)
+}
+
+// setData records the variables data of an Env jailed at jail. Values that
+// point into the jail, such as the TMPDIR of a TestEnv, are stored relative
+// to it so they can be rebased on restore.
+func (s *Snapshot) setData(data map[string]string, jail string) {
+	s.data = maps.Clone(data)
+	s.jailed = make(map[string]bool)
+	if jail == "" {
+		return
+	}
+	sep := string(filepath.Separator)
+	for k, v := range s.data {
+		if v == jail || strings.HasPrefix(v, jail+sep) {
+			s.data[k] = sep + strings.TrimPrefix(strings.TrimPrefix(v, jail), sep)
+			s.jailed[k] = true
+		}
+	}
+}
+
+// restoreData returns a copy of the snapshot variables with values that
+// pointed into the snapshot jail rebased onto jail. An empty jail, as for a
+// MemEnv, leaves them relative to the root.
+func (s *Snapshot) restoreData(jail string) map[string]string {
+	data := maps.Clone(s.data)
+	for k := range s.jailed {
+		data[k] = filepath.Join(jail, data[k])
+	}
+	return data
+}
+
+// Snapshot captures the variables, home, user, working directory and the
+// full jail tree. The jail must be set.
+func (m *TestEnv) Snapshot() (*Snapshot, error) {
+	snap, err := newSnapshot(m)
+	if err != nil {
+		return nil, err
+	}
+	snap.home = m.home
+	snap.user = m.user
+	snap.setData(m.data, m.jail)
+	return snap, nil
+}
+
+// Restore replaces the variables, home, user, working directory and jail
+// contents with those captured in snap. Values that referred to the jail of
+// the snapshotted TestEnv, such as TMPDIR, are moved to this jail.
+func (m *TestEnv) Restore(snap *Snapshot) error {
+	if err := snap.restoreTree(m); err != nil {
+		return err
+	}
+	m.home = snap.home
+	m.user = snap.user
+	m.data = snap.restoreData(m.jail)
+	return nil
+}
+
+// Snapshot captures the variables, home, user, working directory and the
+// whole in-memory tree.
+func (m *MemEnv) Snapshot() (*Snapshot, error) {
+	snap, err := newSnapshot(m)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snap.home = m.home
+	snap.user = m.user
+	snap.setData(m.data, "")
+	return snap, nil
+}
+
+// Restore replaces the variables, home, user, working directory and tree
+// with those captured in snap. Values that referred to the jail of a
+// snapshotted TestEnv, such as TMPDIR, are moved to the root.
+func (m *MemEnv) Restore(snap *Snapshot) error {
+	if err := snap.restoreTree(m); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.home = snap.home
+	m.user = snap.user
+	m.data = snap.restoreData("")
+	return nil
+}
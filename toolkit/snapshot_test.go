@@ -0,0 +1,78 @@
+package toolkit_test
+
+import (
+	"io/fs"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type snapshotEnv interface {
+	toolkit.Env
+	Snapshot() (*toolkit.Snapshot, error)
+	Restore(snap *toolkit.Snapshot) error
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			env := newEnv(t).(snapshotEnv)
+			ctx := seedCopyTree(t, env)
+			require.NoError(t, env.Set("EDITOR", "vi"))
+			env.Setwd("~/src")
+
+			snap, err := env.Snapshot()
+			require.NoError(t, err)
+
+			require.NoError(t, toolkit.Remove(ctx, "~/src", true))
+			require.NoError(t, env.WriteFile("~/extra", []byte("x"), 0o644))
+			require.NoError(t, env.Set("EDITOR", "nano"))
+			require.NoError(t, env.SetHome("/elsewhere"))
+
+			require.NoError(t, env.Restore(snap))
+			assertCopiedTree(t, env, "~/src")
+			_, err = env.Stat("~/extra", false)
+			require.ErrorIs(t, err, fs.ErrNotExist)
+			assert.Equal(t, "vi", env.Get("EDITOR"))
+			wd, err := env.Getwd()
+			require.NoError(t, err)
+			assert.Equal(t, "/home/testuser/src", wd)
+
+			// A snapshot can be restored more than once.
+			require.NoError(t, env.Remove("~/src/secret", false))
+			require.NoError(t, env.Restore(snap))
+			assertCopiedTree(t, env, "~/src")
+		})
+	}
+}
+
+func TestSnapshotRestoreIntoOtherJail(t *testing.T) {
+	t.Parallel()
+
+	src := toolkit.NewTestEnv(t.TempDir(), "", "")
+	seedCopyTree(t, src)
+	snap, err := src.Snapshot()
+	require.NoError(t, err)
+
+	jail := t.TempDir()
+	dst := toolkit.NewTestEnv(jail, "", "")
+	require.NoError(t, dst.Restore(snap))
+	assertCopiedTree(t, dst, "~/src")
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, filepath.Join(jail, "tmp"), dst.Get("TMPDIR"))
+	}
+
+	mem := toolkit.NewMemEnv(nil, "", "")
+	require.NoError(t, mem.Restore(snap))
+	assertCopiedTree(t, mem, "~/src")
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, "/tmp", mem.Get("TMPDIR"), "host jail paths are not carried over")
+	}
+}
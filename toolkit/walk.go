@@ -0,0 +1,326 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// WalkDir walks the file tree rooted at root using the Env stored in ctx,
+// calling fn for each file or directory in the tree, including root. It
+// follows the contract of filepath.WalkDir: entries are visited in lexical
+// order, symlinks are not followed, fn may return filepath.SkipDir or
+// filepath.SkipAll, and paths passed to fn are root joined with the entry
+// names.
+//
+// Because all access goes through the Env, TestEnv jails and MemEnv trees are
+// respected.
+func WalkDir(ctx context.Context, root string, fn fs.WalkDirFunc) error {
+	return walkDir(ctx, "WalkDir", root, false, fn)
+}
+
+// WalkDirFollow is like WalkDir but descends into symlinks to directories,
+// including root. A symlink that points back at one of its ancestors is
+// reported to fn with an error wrapping ErrSymlinkLoop and is not descended
+// into.
+func WalkDirFollow(ctx context.Context, root string, fn fs.WalkDirFunc) error {
+	return walkDir(ctx, "WalkDirFollow", root, true, fn)
+}
+
+func walkDir(ctx context.Context, op, root string, followSymlinks bool, fn fs.WalkDirFunc) error {
+	env := EnvFromContext(ctx)
+	lg := getTookitLogger(ctx)
+
+	w := &walker{
+		ctx:       ctx,
+		env:       env,
+		follow:    followSymlinks,
+		fn:        fn,
+		ancestors: make(map[string]bool),
+	}
+	info, err := env.Stat(root, followSymlinks)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = w.walk(root, fs.FileInfoToDirEntry(info))
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		err = nil
+	}
+
+	if err != nil {
+		lg.Log(
+			ctx,
+			slog.LevelError,
+			op+" failed",
+			slog.String("envType", env.Name()),
+			slog.String("pwd", env.Get("PWD")),
+			slog.String("root", root),
+			slog.Any("error", err),
+		)
+		return err
+	}
+	lg.Log(
+		ctx,
+		slog.LevelDebug,
+		op+" success",
+		slog.String("envType", env.Name()),
+		slog.String("pwd", env.Get("PWD")),
+		slog.String("root", root),
+	)
+	return nil
+}
+
+// walker holds the state of a single WalkDir call.
+type walker struct {
+	ctx    context.Context
+	env    Env
+	follow bool
+	fn     fs.WalkDirFunc
+
+	// ancestors holds the resolved paths of the directories currently being
+	// walked. It is only populated when following symlinks.
+	ancestors map[string]bool
+}
+
+func (w *walker) walk(path string, d fs.DirEntry) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+
+	var real string
+	if w.follow && d.IsDir() {
+		if p, err := w.env.ResolvePath(path, true); err == nil {
+			real = p
+			if w.ancestors[real] {
+				err := w.fn(path, d, fmt.Errorf("walk %s: %w", path, ErrSymlinkLoop))
+				if err == filepath.SkipDir {
+					err = nil
+				}
+				return err
+			}
+		}
+	}
+
+	if err := w.fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	entries, err := w.env.ReadDir(path)
+	if err != nil {
+		err = w.fn(path, d, err)
+		if err == filepath.SkipDir {
+			err = nil
+		}
+		return err
+	}
+
+	if real != "" {
+		w.ancestors[real] = true
+		defer delete(w.ancestors, real)
+	}
+
+	for _, e := range entries {
+		child := filepath.Join(path, e.Name())
+		if w.follow && e.Type()&fs.ModeSymlink != 0 {
+			// Dangling links are reported as the link itself.
+			if info, err := w.env.Stat(child, true); err == nil {
+				e = &namedDirEntry{DirEntry: fs.FileInfoToDirEntry(info), name: e.Name()}
+			}
+		}
+		if err := w.walk(child, e); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// namedDirEntry overrides the name of a DirEntry. It is used to present the
+// target of a followed symlink under the name of the link.
+type namedDirEntry struct {
+	fs.DirEntry
+	name string
+}
+
+func (e *namedDirEntry) Name() string {
+	return e.name
+}
+
+// Glob returns the names of all files matching pattern using the Env stored
+// in ctx. The pattern syntax is that of filepath.Match with the addition of
+// "**", which as a complete path element matches zero or more directories.
+// For example "~/src/**/*.go" matches every Go file below ~/src.
+//
+// A leading tilde is expanded to the home directory. Matches are returned in
+// lexical order and otherwise in the same form as the pattern, so relative
+// patterns produce relative paths. A missing base directory matches
+// nothing. Other I/O errors, such as unreadable directories, and the error
+// of a done ctx are returned, as is filepath.ErrBadPattern for a malformed
+// pattern.
+func Glob(ctx context.Context, pattern string) ([]string, error) {
+	env := EnvFromContext(ctx)
+	lg := getTookitLogger(ctx)
+
+	matches, err := glob(ctx, pattern)
+	if err != nil {
+		lg.Log(
+			ctx,
+			slog.LevelError,
+			"Glob failed",
+			slog.String("envType", env.Name()),
+			slog.String("pwd", env.Get("PWD")),
+			slog.String("pattern", pattern),
+			slog.Any("error", err),
+		)
+		return nil, err
+	}
+	lg.Log(
+		ctx,
+		slog.LevelDebug,
+		"Glob success",
+		slog.String("envType", env.Name()),
+		slog.String("pwd", env.Get("PWD")),
+		slog.String("pattern", pattern),
+		slog.Int("count", len(matches)),
+	)
+	return matches, nil
+}
+
+func glob(ctx context.Context, pattern string) ([]string, error) {
+	env := EnvFromContext(ctx)
+
+	sep := string(filepath.Separator)
+	if p, err := ExpandPath(ctx, pattern); err == nil {
+		pattern = p
+	}
+	clean := filepath.Clean(pattern)
+	parts := strings.Split(clean, sep)
+
+	// Split the pattern into a literal base directory and the remaining
+	// pattern elements.
+	i := 0
+	for i < len(parts) && !hasGlobMeta(parts[i]) {
+		i++
+	}
+	base := strings.Join(parts[:i], sep)
+	pat := parts[i:]
+	for _, p := range pat {
+		if p == "**" {
+			continue
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(pat) == 0 {
+		if _, err := env.Stat(clean, false); errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		return []string{clean}, nil
+	}
+	if base == "" {
+		if filepath.IsAbs(clean) {
+			base = sep
+		} else {
+			base = "."
+		}
+	}
+
+	var matches []string
+	err := WalkDir(ctx, base, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == base && d == nil && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		rel, relErr := filepath.Rel(base, path)
+		if relErr != nil {
+			return nil
+		}
+		var name []string
+		if rel != "." {
+			name = strings.Split(rel, sep)
+		}
+		if ok, _ := matchGlobParts(pat, name); ok && rel != "." {
+			matches = append(matches, path)
+		}
+		if d.IsDir() && !globPrefixMatches(pat, name) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// hasGlobMeta reports whether s contains any of the magic characters
+// recognized by filepath.Match.
+func hasGlobMeta(s string) bool {
+	magic := `*?[`
+	if runtime.GOOS != "windows" {
+		magic = `*?[\`
+	}
+	return strings.ContainsAny(s, magic)
+}
+
+// matchGlobParts reports whether the path elements in name match the pattern
+// elements in pat. A "**" element matches zero or more path elements.
+func matchGlobParts(pat, name []string) (bool, error) {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			if len(pat) == 1 {
+				return true, nil
+			}
+			for i := 0; i <= len(name); i++ {
+				if ok, err := matchGlobParts(pat[1:], name[i:]); ok || err != nil {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		ok, err := filepath.Match(pat[0], name[0])
+		if err != nil || !ok {
+			return false, err
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+// globPrefixMatches reports whether some path below the directory name could
+// still match pat. It is used to prune the walk.
+func globPrefixMatches(pat, name []string) bool {
+	for len(name) > 0 {
+		if len(pat) == 0 {
+			return false
+		}
+		if pat[0] == "**" {
+			return true
+		}
+		if ok, _ := filepath.Match(pat[0], name[0]); !ok {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return true
+}
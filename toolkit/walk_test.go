@@ -0,0 +1,183 @@
+package toolkit_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedWalkTree(t *testing.T, env toolkit.Env) context.Context {
+	t.Helper()
+	for _, dir := range []string{"~/src/pkg/sub", "~/src/vendor", "~/docs"} {
+		require.NoError(t, env.Mkdir(dir, 0o755, true))
+	}
+	for _, file := range []string{
+		"~/src/main.go",
+		"~/src/pkg/a.go",
+		"~/src/pkg/a_test.go",
+		"~/src/pkg/sub/b.go",
+		"~/src/vendor/c.go",
+		"~/docs/readme.md",
+	} {
+		require.NoError(t, env.WriteFile(file, []byte(file), 0o644))
+	}
+	return toolkit.WithEnv(t.Context(), env)
+}
+
+func TestWalkDir(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := seedWalkTree(t, newEnv(t))
+
+			var visited []string
+			err := toolkit.WalkDir(ctx, "/home/testuser/src",
+				func(path string, d fs.DirEntry, err error) error {
+					require.NoError(t, err)
+					if d.Name() == "vendor" {
+						return filepath.SkipDir
+					}
+					visited = append(visited, path)
+					return nil
+				})
+			require.NoError(t, err)
+			assert.Equal(t, []string{
+				"/home/testuser/src",
+				"/home/testuser/src/main.go",
+				"/home/testuser/src/pkg",
+				"/home/testuser/src/pkg/a.go",
+				"/home/testuser/src/pkg/a_test.go",
+				"/home/testuser/src/pkg/sub",
+				"/home/testuser/src/pkg/sub/b.go",
+			}, visited)
+
+			err = toolkit.WalkDir(ctx, "missing",
+				func(path string, d fs.DirEntry, err error) error {
+					return err
+				})
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+		})
+	}
+}
+
+func TestWalkDirFollowSymlinks(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := seedWalkTree(t, newEnv(t))
+			require.NoError(t, toolkit.Symlink(ctx,
+				"/home/testuser/docs", "/home/testuser/src/pkg/docs"))
+			require.NoError(t, toolkit.Symlink(ctx,
+				"/home/testuser/src", "/home/testuser/src/pkg/sub/loop"))
+
+			var files []string
+			var loops int
+			err := toolkit.WalkDirFollow(ctx, "/home/testuser/src/pkg",
+				func(path string, d fs.DirEntry, err error) error {
+					if errors.Is(err, toolkit.ErrSymlinkLoop) {
+						loops++
+						return nil
+					}
+					require.NoError(t, err)
+					if !d.IsDir() {
+						files = append(files, path)
+					}
+					return nil
+				})
+			require.NoError(t, err)
+			assert.Contains(t, files, "/home/testuser/src/pkg/docs/readme.md")
+			assert.Contains(t, files, "/home/testuser/src/pkg/sub/loop/main.go")
+			assert.Equal(t, 1, loops)
+
+			// Without following, links are reported but not descended.
+			files = nil
+			err = toolkit.WalkDir(ctx, "/home/testuser/src/pkg",
+				func(path string, d fs.DirEntry, err error) error {
+					if !d.IsDir() {
+						files = append(files, path)
+					}
+					return nil
+				})
+			require.NoError(t, err)
+			assert.Contains(t, files, "/home/testuser/src/pkg/docs")
+			assert.NotContains(t, files, "/home/testuser/src/pkg/docs/readme.md")
+		})
+	}
+}
+
+func TestGlob(t *testing.T) {
+	t.Parallel()
+
+	for name, newEnv := range allEnvs() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := seedWalkTree(t, newEnv(t))
+
+			tests := []struct {
+				pattern string
+				want    []string
+			}{
+				{
+					pattern: "~/src/**/*.go",
+					want: []string{
+						"/home/testuser/src/main.go",
+						"/home/testuser/src/pkg/a.go",
+						"/home/testuser/src/pkg/a_test.go",
+						"/home/testuser/src/pkg/sub/b.go",
+						"/home/testuser/src/vendor/c.go",
+					},
+				},
+				{
+					pattern: "src/*/*_test.go",
+					want:    []string{"src/pkg/a_test.go"},
+				},
+				{
+					pattern: "/home/testuser/**/sub",
+					want:    []string{"/home/testuser/src/pkg/sub"},
+				},
+				{
+					pattern: "docs/readme.md",
+					want:    []string{"docs/readme.md"},
+				},
+				{
+					pattern: "docs/missing.md",
+					want:    nil,
+				},
+			}
+			for _, tc := range tests {
+				got, err := toolkit.Glob(ctx, tc.pattern)
+				require.NoError(t, err, tc.pattern)
+				assert.Equal(t, tc.want, got, tc.pattern)
+			}
+
+			_, err := toolkit.Glob(ctx, "src/[")
+			assert.ErrorIs(t, err, filepath.ErrBadPattern)
+
+			// A missing base matches nothing, but other errors are returned.
+			got, err := toolkit.Glob(ctx, "missing/**/*.go")
+			require.NoError(t, err)
+			assert.Empty(t, got)
+
+			faults := toolkit.NewFaultEnv(toolkit.EnvFromContext(ctx), &toolkit.FaultOptions{
+				Rules: []toolkit.FaultRule{{Op: "ReadDir", Path: "pkg", Err: fs.ErrPermission}},
+			})
+			_, err = toolkit.Glob(toolkit.WithEnv(ctx, faults), "~/src/**/*.go")
+			assert.ErrorIs(t, err, fs.ErrPermission)
+
+			canceled, cancel := context.WithCancel(ctx)
+			cancel()
+			_, err = toolkit.Glob(canceled, "~/src/**/*.go")
+			assert.ErrorIs(t, err, context.Canceled)
+		})
+	}
+}
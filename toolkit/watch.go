@@ -0,0 +1,519 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+)
+
+// WatchOp describes a set of file operations reported by a Watcher.
+type WatchOp uint32
+
+const (
+	// WatchCreate reports a new file, directory or symlink.
+	WatchCreate WatchOp = 1 << iota
+	// WatchWrite reports changed file contents.
+	WatchWrite
+	// WatchRemove reports a removed path.
+	WatchRemove
+	// WatchRename reports a path that was renamed away. The new name is
+	// reported separately as WatchCreate.
+	WatchRename
+	// WatchChmod reports changed attributes such as mode or times.
+	WatchChmod
+)
+
+// String returns the operations in op separated by "|".
+func (op WatchOp) String() string {
+	var parts []string
+	for _, o := range []struct {
+		op   WatchOp
+		name string
+	}{
+		{WatchCreate, "CREATE"},
+		{WatchWrite, "WRITE"},
+		{WatchRemove, "REMOVE"},
+		{WatchRename, "RENAME"},
+		{WatchChmod, "CHMOD"},
+	} {
+		if op&o.op != 0 {
+			parts = append(parts, o.name)
+		}
+	}
+	if len(parts) == 0 {
+		return "NONE"
+	}
+	return strings.Join(parts, "|")
+}
+
+// WatchEvent is a single change reported by a Watcher. Path is the changed
+// path as seen through the Env, so TestEnv events carry no jail prefix.
+type WatchEvent struct {
+	Path string
+	Op   WatchOp
+}
+
+func (e WatchEvent) String() string {
+	return fmt.Sprintf("%s %q", e.Op, e.Path)
+}
+
+// Watcher reports changes to watched paths. Watching a directory reports
+// changes to the directory itself and to its direct children; watches are
+// not recursive.
+type Watcher interface {
+	// Add starts watching path.
+	Add(path string) error
+
+	// Remove stops watching path.
+	Remove(path string) error
+
+	// Events returns the channel on which changes are delivered.
+	Events() <-chan WatchEvent
+
+	// Errors returns the channel on which watch errors are delivered.
+	Errors() <-chan error
+
+	// Close stops the watcher and closes both channels.
+	Close() error
+}
+
+// WatchOptions controls the Watcher returned by NewWatcher.
+type WatchOptions struct {
+	// Poll forces the polling implementation even when the Env provides a
+	// native watcher, for example on network filesystems where inotify does
+	// not see remote changes.
+	Poll bool
+
+	// PollInterval is the time between scans of the polling watcher,
+	// measured on the clock.Clock stored in the context. Defaults to
+	// DefaultWatchPollInterval.
+	PollInterval time.Duration
+
+	// Buffer is the capacity of the event channel. Defaults to
+	// DefaultWatchBuffer.
+	Buffer int
+}
+
+const (
+	// DefaultWatchPollInterval is the scan interval of the polling watcher.
+	DefaultWatchPollInterval = time.Second
+
+	// DefaultWatchBuffer is the default capacity of a watcher event channel.
+	DefaultWatchBuffer = 128
+)
+
+// ErrWatchOverflow is delivered on a watcher error channel when events were
+// dropped because the event channel was full.
+var ErrWatchOverflow = errors.New("watch event queue overflow")
+
+// WatcherProvider is implemented by Envs that supply a native Watcher.
+// OsEnv uses inotify on Linux and TestEnv delivers events synchronously as
+// files are changed through it. Decorators with an Unwrap method use the
+// Watcher of the Env they wrap, so a watcher on a DryRunEnv does not see
+// planned changes. NewWatcher falls back to polling when no Env in the chain
+// implements it.
+type WatcherProvider interface {
+	NewWatcher(opts *WatchOptions) (Watcher, error)
+}
+
+// NewWatcher returns a Watcher for the Env stored in ctx.
+func NewWatcher(ctx context.Context, opts *WatchOptions) (Watcher, error) {
+	env := EnvFromContext(ctx)
+	lg := getTookitLogger(ctx)
+
+	if opts == nil {
+		opts = &WatchOptions{}
+	}
+	var w Watcher
+	var err error
+	if p, ok := lookupEnv[WatcherProvider](env); ok && !opts.Poll {
+		w, err = p.NewWatcher(opts)
+	} else {
+		w = NewPollWatcher(ctx, opts)
+	}
+	if err != nil {
+		lg.Log(
+			ctx,
+			slog.LevelError,
+			"NewWatcher failed",
+			slog.String("envType", env.Name()),
+			slog.Any("error", err),
+		)
+		return nil, err
+	}
+	lg.Log(
+		ctx,
+		slog.LevelDebug,
+		"NewWatcher success",
+		slog.String("envType", env.Name()),
+		slog.String("watcher", fmt.Sprintf("%T", w)),
+	)
+	return w, nil
+}
+
+func watchBuffer(opts *WatchOptions) int {
+	if opts == nil || opts.Buffer <= 0 {
+		return DefaultWatchBuffer
+	}
+	return opts.Buffer
+}
+
+// watchQueue holds the channels shared by the watcher implementations.
+// Sends never block: when the event channel is full the event is dropped and
+// ErrWatchOverflow is reported instead.
+type watchQueue struct {
+	mu     sync.Mutex
+	events chan WatchEvent
+	errors chan error
+	closed bool
+}
+
+func newWatchQueue(buffer int) *watchQueue {
+	return &watchQueue{
+		events: make(chan WatchEvent, buffer),
+		errors: make(chan error, 1),
+	}
+}
+
+func (q *watchQueue) sendEvent(ev WatchEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	select {
+	case q.events <- ev:
+	default:
+		q.sendErrorLocked(fmt.Errorf("%s: %w", ev, ErrWatchOverflow))
+	}
+}
+
+func (q *watchQueue) sendError(err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.sendErrorLocked(err)
+	}
+}
+
+func (q *watchQueue) sendErrorLocked(err error) {
+	select {
+	case q.errors <- err:
+	default:
+	}
+}
+
+// close closes the channels. It reports false if they were already closed.
+func (q *watchQueue) close() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	q.closed = true
+	close(q.events)
+	close(q.errors)
+	return true
+}
+
+// PollWatcher is a Watcher that detects changes by periodically comparing
+// Stat results. It works with any Env and measures its interval on the
+// injected clock, so advancing a TestClock past the interval triggers a
+// scan. Poll scans immediately.
+type PollWatcher struct {
+	env      Env
+	clock    clock.Clock
+	interval time.Duration
+	queue    *watchQueue
+
+	mu      sync.Mutex
+	watches map[string]map[string]pollState
+	done    chan struct{}
+}
+
+// pollState is the part of a Stat result compared between scans.
+type pollState struct {
+	isDir   bool
+	mode    fs.FileMode
+	size    int64
+	modTime time.Time
+}
+
+// NewPollWatcher returns a polling Watcher for the Env stored in ctx.
+func NewPollWatcher(ctx context.Context, opts *WatchOptions) *PollWatcher {
+	interval := DefaultWatchPollInterval
+	if opts != nil && opts.PollInterval > 0 {
+		interval = opts.PollInterval
+	}
+	w := &PollWatcher{
+		env:      EnvFromContext(ctx),
+		clock:    clock.ClockFromContext(ctx),
+		interval: interval,
+		queue:    newWatchQueue(watchBuffer(opts)),
+		watches:  make(map[string]map[string]pollState),
+		done:     make(chan struct{}),
+	}
+	// The ticker is created before returning so that advancing a TestClock
+	// right after NewPollWatcher is not missed.
+	go w.run(w.clock.NewTicker(interval))
+	return w
+}
+
+// run scans on every tick of the clock until the watcher is closed.
+func (w *PollWatcher) run(ticker clock.Ticker) {
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C():
+			w.Poll()
+		}
+	}
+}
+
+// Add starts watching path. The current state is recorded so only later
+// changes are reported.
+func (w *PollWatcher) Add(path string) error {
+	p, err := w.env.ResolvePath(path, false)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.watches == nil {
+		return fs.ErrClosed
+	}
+	w.watches[p] = w.scan(p)
+	return nil
+}
+
+// Remove stops watching path.
+func (w *PollWatcher) Remove(path string) error {
+	p, err := w.env.ResolvePath(path, false)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.watches[p]; !ok {
+		return fmt.Errorf("watch remove %s: %w", path, fs.ErrNotExist)
+	}
+	delete(w.watches, p)
+	return nil
+}
+
+// Poll scans all watched paths now and delivers any changes.
+func (w *PollWatcher) Poll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for root, before := range w.watches {
+		after := w.scan(root)
+		for _, ev := range diffPollStates(before, after) {
+			w.queue.sendEvent(ev)
+		}
+		w.watches[root] = after
+	}
+}
+
+// scan returns the state of root and, when it is a directory, of its
+// direct children.
+func (w *PollWatcher) scan(root string) map[string]pollState {
+	states := make(map[string]pollState)
+	info, err := w.env.Stat(root, false)
+	if err != nil {
+		return states
+	}
+	states[root] = newPollState(info)
+	if !info.IsDir() {
+		return states
+	}
+	entries, err := w.env.ReadDir(root)
+	if err != nil {
+		w.queue.sendError(err)
+		return states
+	}
+	for _, e := range entries {
+		child := filepath.Join(root, e.Name())
+		if info, err := w.env.Stat(child, false); err == nil {
+			states[child] = newPollState(info)
+		}
+	}
+	return states
+}
+
+func newPollState(info fs.FileInfo) pollState {
+	return pollState{
+		isDir:   info.IsDir(),
+		mode:    info.Mode(),
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+}
+
+// diffPollStates returns the events turning before into after in path
+// order.
+func diffPollStates(before, after map[string]pollState) []WatchEvent {
+	var events []WatchEvent
+	for p, a := range after {
+		b, ok := before[p]
+		switch {
+		case !ok:
+			events = append(events, WatchEvent{Path: p, Op: WatchCreate})
+		case b.isDir != a.isDir:
+			events = append(events,
+				WatchEvent{Path: p, Op: WatchRemove},
+				WatchEvent{Path: p, Op: WatchCreate})
+		case !a.isDir && (b.size != a.size || !b.modTime.Equal(a.modTime)):
+			events = append(events, WatchEvent{Path: p, Op: WatchWrite})
+		case b.mode != a.mode:
+			events = append(events, WatchEvent{Path: p, Op: WatchChmod})
+		}
+	}
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			events = append(events, WatchEvent{Path: p, Op: WatchRemove})
+		}
+	}
+	// Stable so a replaced path is reported as removed before created.
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Path < events[j].Path
+	})
+	return events
+}
+
+// Events implements Watcher.
+func (w *PollWatcher) Events() <-chan WatchEvent {
+	return w.queue.events
+}
+
+// Errors implements Watcher.
+func (w *PollWatcher) Errors() <-chan error {
+	return w.queue.errors
+}
+
+// Close implements Watcher.
+func (w *PollWatcher) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.queue.close() {
+		return nil
+	}
+	close(w.done)
+	w.watches = nil
+	return nil
+}
+
+// watchHub delivers events for changes made through an Env to the watchers
+// created from it. TestEnv uses it so events are queued before the changing
+// call returns.
+type watchHub struct {
+	mu       sync.Mutex
+	watchers map[*hubWatcher]struct{}
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{watchers: make(map[*hubWatcher]struct{})}
+}
+
+func (h *watchHub) newWatcher(env Env, opts *WatchOptions) *hubWatcher {
+	w := &hubWatcher{
+		hub:   h,
+		env:   env,
+		queue: newWatchQueue(watchBuffer(opts)),
+		paths: make(map[string]bool),
+	}
+	h.mu.Lock()
+	h.watchers[w] = struct{}{}
+	h.mu.Unlock()
+	return w
+}
+
+// notify delivers an event for path to every watcher watching path or its
+// parent directory.
+func (h *watchHub) notify(path string, op WatchOp) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	dir := filepath.Dir(path)
+	for w := range h.watchers {
+		if w.watching(path) || w.watching(dir) {
+			w.queue.sendEvent(WatchEvent{Path: path, Op: op})
+		}
+	}
+}
+
+// hubWatcher is the Watcher returned for Envs backed by a watchHub.
+type hubWatcher struct {
+	hub   *watchHub
+	env   Env
+	queue *watchQueue
+
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+func (w *hubWatcher) watching(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.paths[path]
+}
+
+func (w *hubWatcher) Add(path string) error {
+	p, err := w.env.ResolvePath(path, false)
+	if err != nil {
+		return err
+	}
+	if _, err := w.env.Stat(p, false); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.paths[p] = true
+	return nil
+}
+
+func (w *hubWatcher) Remove(path string) error {
+	p, err := w.env.ResolvePath(path, false)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.paths[p] {
+		return fmt.Errorf("watch remove %s: %w", path, fs.ErrNotExist)
+	}
+	delete(w.paths, p)
+	return nil
+}
+
+func (w *hubWatcher) Events() <-chan WatchEvent {
+	return w.queue.events
+}
+
+func (w *hubWatcher) Errors() <-chan error {
+	return w.queue.errors
+}
+
+func (w *hubWatcher) Close() error {
+	w.hub.mu.Lock()
+	delete(w.hub.watchers, w)
+	w.hub.mu.Unlock()
+	w.queue.close()
+	return nil
+}
+
+// Ensure implementations satisfy the interfaces.
+var (
+	_ Watcher         = (*PollWatcher)(nil)
+	_ Watcher         = (*hubWatcher)(nil)
+	_ WatcherProvider = (*TestEnv)(nil)
+)
@@ -0,0 +1,183 @@
+//go:build linux
+
+package toolkit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// inotifyMask selects the inotify events translated into WatchEvents.
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_DELETE | syscall.IN_DELETE_SELF |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_MOVE_SELF
+
+// NewWatcher implements WatcherProvider using inotify.
+func (o *OsEnv) NewWatcher(opts *WatchOptions) (Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &inotifyWatcher{
+		env:   o,
+		fd:    fd,
+		file:  os.NewFile(uintptr(fd), "inotify"),
+		queue: newWatchQueue(watchBuffer(opts)),
+		paths: make(map[int32]string),
+		wds:   make(map[string]int32),
+		done:  make(chan struct{}),
+	}
+	go w.readEvents()
+	return w, nil
+}
+
+// inotifyWatcher is the Linux Watcher used by OsEnv. The inotify file
+// descriptor is non-blocking and registered with the runtime poller, so
+// closing the file unblocks the reader goroutine.
+type inotifyWatcher struct {
+	env   *OsEnv
+	fd    int
+	file  *os.File
+	queue *watchQueue
+	done  chan struct{}
+
+	mu     sync.Mutex
+	paths  map[int32]string
+	wds    map[string]int32
+	closed bool
+}
+
+func (w *inotifyWatcher) Add(path string) error {
+	p, err := w.env.ResolvePath(path, false)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return &fs.PathError{Op: "watch", Path: path, Err: fs.ErrClosed}
+	}
+	wd, err := syscall.InotifyAddWatch(w.fd, p, inotifyMask)
+	if err != nil {
+		return &fs.PathError{Op: "watch", Path: path, Err: err}
+	}
+	w.paths[int32(wd)] = p
+	w.wds[p] = int32(wd)
+	return nil
+}
+
+func (w *inotifyWatcher) Remove(path string) error {
+	p, err := w.env.ResolvePath(path, false)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wd, ok := w.wds[p]
+	if !ok {
+		return fmt.Errorf("watch remove %s: %w", path, fs.ErrNotExist)
+	}
+	delete(w.wds, p)
+	delete(w.paths, wd)
+	if _, err := syscall.InotifyRmWatch(w.fd, uint32(wd)); err != nil {
+		return &fs.PathError{Op: "watch remove", Path: path, Err: err}
+	}
+	return nil
+}
+
+func (w *inotifyWatcher) Events() <-chan WatchEvent {
+	return w.queue.events
+}
+
+func (w *inotifyWatcher) Errors() <-chan error {
+	return w.queue.errors
+}
+
+func (w *inotifyWatcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	err := w.file.Close()
+	<-w.done
+	w.queue.close()
+	return err
+}
+
+// readEvents decodes inotify records until the file is closed.
+func (w *inotifyWatcher) readEvents() {
+	defer close(w.done)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.queue.sendError(err)
+			}
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			start := off + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[start:start+nameLen]), "\x00")
+			off = start + nameLen
+			w.handle(wd, mask, name)
+		}
+	}
+}
+
+func (w *inotifyWatcher) handle(wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.queue.sendError(ErrWatchOverflow)
+		return
+	}
+
+	w.mu.Lock()
+	path, ok := w.paths[wd]
+	if ok && mask&syscall.IN_IGNORED != 0 {
+		delete(w.paths, wd)
+		delete(w.wds, path)
+	}
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+	if name != "" {
+		path = filepath.Join(path, name)
+	}
+
+	var op WatchOp
+	if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		op |= WatchCreate
+	}
+	if mask&syscall.IN_MODIFY != 0 {
+		op |= WatchWrite
+	}
+	if mask&(syscall.IN_DELETE|syscall.IN_DELETE_SELF) != 0 {
+		op |= WatchRemove
+	}
+	if mask&(syscall.IN_MOVED_FROM|syscall.IN_MOVE_SELF) != 0 {
+		op |= WatchRename
+	}
+	if mask&syscall.IN_ATTRIB != 0 {
+		op |= WatchChmod
+	}
+	if op != 0 {
+		w.queue.sendEvent(WatchEvent{Path: path, Op: op})
+	}
+}
+
+var _ WatcherProvider = (*OsEnv)(nil)
@@ -0,0 +1,160 @@
+package toolkit_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/jlrickert/cli-toolkit/clock"
+	"github.com/jlrickert/cli-toolkit/toolkit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// drainEvents returns the events already queued on w without waiting.
+func drainEvents(w toolkit.Watcher) []toolkit.WatchEvent {
+	var events []toolkit.WatchEvent
+	for {
+		select {
+		case ev := <-w.Events():
+			events = append(events, ev)
+		default:
+			return events
+		}
+	}
+}
+
+func TestTestEnvWatcherIsSynchronous(t *testing.T) {
+	t.Parallel()
+
+	env := toolkit.NewTestEnv(t.TempDir(), "", "")
+	ctx := toolkit.WithEnv(t.Context(), env)
+	require.NoError(t, env.Mkdir("~/config/nested", 0o755, true))
+
+	w, err := toolkit.NewWatcher(ctx, nil)
+	require.NoError(t, err)
+	defer w.Close()
+	require.NoError(t, w.Add("~/config"))
+
+	cfg := "/home/testuser/config/app.yaml"
+	require.NoError(t, toolkit.WriteFile(ctx, "~/config/app.yaml", []byte("a: 1"), 0o644))
+	require.NoError(t, toolkit.AtomicWriteFile(ctx, "~/config/app.yaml", []byte("a: 2"), 0o644))
+	require.NoError(t, toolkit.Rename(ctx, "~/config/app.yaml", "~/config/app.yml"))
+	require.NoError(t, toolkit.Remove(ctx, "~/config/app.yml", false))
+	// Children of subdirectories are not watched.
+	require.NoError(t, toolkit.WriteFile(ctx, "~/config/nested/x", []byte("x"), 0o644))
+
+	f, err := toolkit.Create(ctx, "~/config/log")
+	require.NoError(t, err)
+	_, err = f.Write([]byte("line\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	assert.Equal(t, []toolkit.WatchEvent{
+		{Path: cfg, Op: toolkit.WatchCreate},
+		{Path: cfg, Op: toolkit.WatchWrite},
+		{Path: cfg, Op: toolkit.WatchRename},
+		{Path: "/home/testuser/config/app.yml", Op: toolkit.WatchCreate},
+		{Path: "/home/testuser/config/app.yml", Op: toolkit.WatchRemove},
+		{Path: "/home/testuser/config/log", Op: toolkit.WatchCreate},
+		{Path: "/home/testuser/config/log", Op: toolkit.WatchWrite},
+	}, drainEvents(w))
+
+	require.NoError(t, w.Remove("~/config"))
+	require.NoError(t, toolkit.WriteFile(ctx, "~/config/app.yaml", []byte("a: 3"), 0o644))
+	assert.Empty(t, drainEvents(w))
+
+	require.NoError(t, w.Close())
+	_, ok := <-w.Events()
+	assert.False(t, ok, "events channel is closed")
+}
+
+func TestPollWatcher(t *testing.T) {
+	t.Parallel()
+
+	clk := clock.NewTestClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	env := toolkit.NewMemEnv(clk, "", "")
+	ctx := clock.WithClock(toolkit.WithEnv(t.Context(), env), clk)
+	require.NoError(t, env.Mkdir("~/config", 0o755, true))
+	require.NoError(t, env.WriteFile("~/config/app.yaml", []byte("a: 1"), 0o644))
+
+	w, err := toolkit.NewWatcher(ctx, &toolkit.WatchOptions{PollInterval: time.Minute})
+	require.NoError(t, err)
+	defer w.Close()
+	pw, ok := w.(*toolkit.PollWatcher)
+	require.True(t, ok, "MemEnv falls back to polling")
+	require.NoError(t, w.Add("~/config"))
+
+	clk.Advance(time.Second)
+	require.NoError(t, env.WriteFile("~/config/app.yaml", []byte("a: 22"), 0o644))
+	require.NoError(t, env.WriteFile("~/config/new.yaml", []byte("b"), 0o644))
+	pw.Poll()
+	assert.Equal(t, []toolkit.WatchEvent{
+		{Path: "/home/testuser/config/app.yaml", Op: toolkit.WatchWrite},
+		{Path: "/home/testuser/config/new.yaml", Op: toolkit.WatchCreate},
+	}, drainEvents(w))
+
+	// Advancing the clock past the interval triggers a scan.
+	require.NoError(t, env.Remove("~/config/new.yaml", false))
+	clk.Advance(time.Minute)
+	select {
+	case ev := <-w.Events():
+		assert.Equal(t, toolkit.WatchEvent{
+			Path: "/home/testuser/config/new.yaml",
+			Op:   toolkit.WatchRemove,
+		}, ev)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event after advancing the clock")
+	}
+}
+
+func TestPollWatcherWaitsOnClock(t *testing.T) {
+	t.Parallel()
+
+	clk := clock.NewTestClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	env := toolkit.NewMemEnv(clk, "", "")
+	ctx := clock.WithClock(toolkit.WithEnv(t.Context(), env), clk)
+	start := clk.Now()
+	clk.SetAutoAdvance(time.Second)
+
+	w := toolkit.NewPollWatcher(ctx, &toolkit.WatchOptions{PollInterval: time.Hour})
+	defer w.Close()
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, start, clk.Now(), "an idle watcher does not read the clock")
+}
+
+func TestOsEnvWatcher(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS != "linux" {
+		t.Skip("native watching is only implemented on linux")
+	}
+
+	dir := t.TempDir()
+	ctx := toolkit.WithEnv(t.Context(), &toolkit.OsEnv{})
+	w, err := toolkit.NewWatcher(ctx, nil)
+	require.NoError(t, err)
+	defer w.Close()
+	require.NoError(t, w.Add(dir))
+
+	path := filepath.Join(dir, "app.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("a: 1"), 0o644))
+
+	var ops toolkit.WatchOp
+	timeout := time.After(5 * time.Second)
+	for ops&(toolkit.WatchCreate|toolkit.WatchWrite) != toolkit.WatchCreate|toolkit.WatchWrite {
+		select {
+		case ev := <-w.Events():
+			assert.Equal(t, path, ev.Path)
+			ops |= ev.Op
+		case err := <-w.Errors():
+			t.Fatalf("watch error: %v", err)
+		case <-timeout:
+			t.Fatalf("missing events, got %s", ops)
+		}
+	}
+
+	require.NoError(t, w.Close())
+	require.NoError(t, w.Close())
+}